@@ -12,19 +12,21 @@ import (
 
 type createAccountRequest struct {
 	Currency    string `json:"currency"`
-	PhoneNumber string `json:"phone_number" binding:required,max="12"`
+	PhoneNumber string `json:"phone_number" binding:"required,max=12"`
+	Purpose     string `json:"purpose"`
 }
 
 // createAccountHandler godoc
 // @Summary Create a new account
-// @Description Creates a new account for the authenticated user with the provided currency and phone number
+// @Description Creates a new account for the authenticated user with the provided currency, phone number and purpose (current or savings).
+// @Description A user may hold several accounts up to the configured limit; with unique_per_currency only one per currency and purpose.
 // @Tags accounts
 // @Accept json
 // @Produce json
 // @Param account body createAccountRequest true "Account data"
 // @Security BearerAuth
 // @Success 201 {object} models.Account
-// @Failure 400 {object} map[string]string "Invalid input, user not found, account already exists, or invalid currency"
+// @Failure 400 {object} map[string]string "Invalid input, user not found, account already exists, accounts limit reached, or invalid currency"
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /accounts [post]
@@ -58,6 +60,7 @@ func createAccountHandler(ctx *gin.Context) {
 		UserID:      userID,
 		Currency:    req.Currency,
 		PhoneNumber: req.PhoneNumber,
+		Purpose:     req.Purpose,
 	}
 
 	err = service.CreateAccount(account)
@@ -68,6 +71,10 @@ func createAccountHandler(ctx *gin.Context) {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "such user does not exist, firstly create user"})
 		case errors.Is(err, errs.ErrAccountAlreadyExists):
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "account with such credentials already exits"})
+		case errors.Is(err, errs.ErrAccountLimitReached):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "accounts limit per user reached"})
+		case errors.Is(err, errs.ErrInvalidAccountPurpose):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "purpose must be current or savings"})
 		case errors.Is(err, errs.ErrInvalidCurrency):
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid currency was sent"})
 		default:
@@ -90,6 +97,7 @@ func createAccountHandler(ctx *gin.Context) {
 // @Success 200 {object} models.Account
 // @Failure 400 {object} map[string]string "Invalid input, account not found, or invalid currency"
 // @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "Currency cannot be changed on an account with balance or history, or an account in this currency already exists"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /accounts [patch]
 func updateAccountHandler(ctx *gin.Context) {
@@ -126,7 +134,7 @@ func updateAccountHandler(ctx *gin.Context) {
 		UserID:      userID,
 	}
 
-	newAccount, err := service.UpdateAccount(account)
+	newAccount, err := service.UpdateAccount(account, hasPermission(ctx, models.PermAccountsManage))
 	if err != nil {
 		logger.Error.Printf("%s: service.UpdateAccount: %v", op, err)
 		switch {
@@ -136,6 +144,12 @@ func updateAccountHandler(ctx *gin.Context) {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid currency was sent"})
 		case errors.Is(err, errs.ErrFraud):
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot change others account"})
+		case errors.Is(err, errs.ErrInsufficientFunds):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "balance cannot become negative"})
+		case errors.Is(err, errs.ErrCurrencyChange):
+			ctx.JSON(http.StatusConflict, gin.H{"error": "currency can be changed only on an empty account without transactions"})
+		case errors.Is(err, errs.ErrAccountAlreadyExists):
+			ctx.JSON(http.StatusConflict, gin.H{"error": "account in this currency and purpose already exists"})
 		default:
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		}
@@ -188,7 +202,7 @@ func deleteAccountHandler(ctx *gin.Context) {
 		return
 	}
 
-	err = service.DeleteAccount(req.ID, userID)
+	err = service.DeleteAccount(req.ID, userID, hasPermission(ctx, models.PermAccountsManage))
 	if err != nil {
 		logger.Error.Printf("%s: service.DeleteAccount: %v", op, err)
 		switch {
@@ -213,14 +227,14 @@ type getAccountByIDRequest struct {
 
 // getAccountByIDHandler godoc
 // @Summary Get an account by ID
-// @Description Retrieves an account by its ID for the authenticated user
+// @Description Retrieves an account by its ID. Accounts of other users need accounts.read.
 // @Tags accounts
 // @Accept json
 // @Produce json
 // @Param id path int true "Account ID"
 // @Security BearerAuth
 // @Success 200 {object} models.Account
-// @Failure 400 {object} map[string]string "Invalid input or account not found"
+// @Failure 400 {object} map[string]string "Invalid input, account not found or account of another user"
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /accounts/{id} [get]
@@ -235,12 +249,28 @@ func getAccountByIDHandler(ctx *gin.Context) {
 		return
 	}
 
-	user, err := service.GetAccountByID(req.ID)
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	user, err := service.GetAccountByID(req.ID, userID, hasPermission(ctx, models.PermAccountsRead))
 	if err != nil {
 		logger.Error.Printf("%s: service.GetAccountByID: %v", op, err)
 		switch {
 		case errors.Is(err, errs.ErrNotFound):
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "account not found"})
+		case errors.Is(err, errs.ErrFraud):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot access others account"})
 		default:
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		}
@@ -255,15 +285,19 @@ type getAccountByUserIDRequest struct {
 }
 
 // getAccountByUserIDHandler godoc
-// @Summary Get an account by user ID
-// @Description Retrieves an account by its ID for the authenticated user
+// @Summary Get accounts by user ID
+// @Description Retrieves a page of active accounts of the user. Accounts of other users need accounts.read.
 // @Tags accounts
 // @Accept json
 // @Produce json
 // @Param id path int true "User ID"
+// @Param limit query int false "Page size, default and maximum come from pagination_params"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param sort query string false "Sort field, prefix with - for descending order" Enums(id, -id, created_at, -created_at, balance, -balance)
+// @Param filter query string false "Filters as filter[field]=value, fields: user_id, currency, purpose"
 // @Security BearerAuth
-// @Success 200 {object} models.Account
-// @Failure 400 {object} map[string]string "Invalid input or account not found"
+// @Success 200 {object} models.Page[models.Account]
+// @Failure 400 {object} map[string]string "Invalid input, user not found, another user without accounts.read or invalid page parameters"
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /accounts/users/{id} [get]
@@ -278,65 +312,85 @@ func getAccountByUserIDHandler(ctx *gin.Context) {
 		return
 	}
 
-	user, err := service.GetAccountByUserID(req.ID)
+	page, err := bindPageParams(ctx)
 	if err != nil {
-		logger.Error.Printf("%s: service.GetAccountByID: %v", op, err)
+		logger.Error.Printf("%s: bindPageParams: %v", op, err)
+		respondPageError(ctx, err)
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	accounts, err := service.GetAccountsByUserID(req.ID, userID, hasPermission(ctx, models.PermAccountsRead), page)
+	if err != nil {
+		logger.Error.Printf("%s: service.GetAccountsByUserID: %v", op, err)
+		if respondPageError(ctx, err) {
+			return
+		}
 		switch {
 		case errors.Is(err, errs.ErrNotFound):
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "account with such user id not found"})
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "user with such id not found"})
+		case errors.Is(err, errs.ErrFraud):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot access others accounts"})
 		default:
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		}
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"account": user})
+	ctx.JSON(http.StatusOK, accounts)
 }
 
 // getInActiveAccountsHandler godoc
 // @Summary Get inactive accounts
-// @Description Retrieves a list of inactive accounts
+// @Description Retrieves a page of inactive accounts
 // @Tags accounts
 // @Accept json
 // @Produce json
+// @Param limit query int false "Page size, default and maximum come from pagination_params"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param sort query string false "Sort field, prefix with - for descending order" Enums(id, -id, created_at, -created_at, balance, -balance)
+// @Param filter query string false "Filters as filter[field]=value, fields: user_id, currency, purpose"
 // @Security BearerAuth
-// @Success 200 {array} models.Account
-// @Failure 400 {object} map[string]string "Invalid input or unauthorized"
+// @Success 200 {object} models.Page[models.Account]
+// @Failure 400 {object} map[string]string "Invalid page parameters"
 // @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /accounts/inactive [get]
-
 func getInActiveAccountsHandler(ctx *gin.Context) {
 	const op = "getInActiveAccountsHandler"
 
-	userIDAny, ok := ctx.Get(userIDCtx)
-	if !ok {
-		logger.Error.Printf("%s: userID absent in Context", op)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
-		return
-	}
-
-	userID, ok := userIDAny.(int)
-	if !ok {
-		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
-		return
-	}
-
-	if userID != service.AdminID {
-		logger.Error.Printf("%s: someone is trying to get others data, userID token: %d", op, userID)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+	page, err := bindPageParams(ctx)
+	if err != nil {
+		logger.Error.Printf("%s: bindPageParams: %v", op, err)
+		respondPageError(ctx, err)
 		return
 	}
 
-	users, err := service.GetInactiveAccounts()
+	accounts, err := service.GetInactiveAccounts(page)
 	if err != nil {
-		logger.Error.Printf("%s: service.GetInactiveUsers: %v", op, err)
+		logger.Error.Printf("%s: service.GetInactiveAccounts: %v", op, err)
+		if respondPageError(ctx, err) {
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"accounts": users})
+	ctx.JSON(http.StatusOK, accounts)
 }
 
 type getAccountByCurrencyRequest struct {
@@ -345,14 +399,18 @@ type getAccountByCurrencyRequest struct {
 
 // getAccountByCurrency godoc
 // @Summary Get accounts by currency
-// @Description Retrieves all accounts with the specified currency for the authenticated user
+// @Description Retrieves a page of active accounts with the specified currency. Without accounts.read only your own accounts are listed.
 // @Tags accounts
 // @Accept json
 // @Produce json
 // @Param currency body getAccountByCurrencyRequest true "Currency"
+// @Param limit query int false "Page size, default and maximum come from pagination_params"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param sort query string false "Sort field, prefix with - for descending order" Enums(id, -id, created_at, -created_at, balance, -balance)
+// @Param filter query string false "Filters as filter[field]=value, fields: user_id, currency, purpose"
 // @Security BearerAuth
-// @Success 200 {array} models.Account
-// @Failure 400 {object} map[string]string "Invalid input or invalid currency"
+// @Success 200 {object} models.Page[models.Account]
+// @Failure 400 {object} map[string]string "Invalid input, invalid currency or invalid page parameters"
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /accounts/currency [get]
@@ -367,9 +425,33 @@ func getAccountByCurrency(ctx *gin.Context) {
 		return
 	}
 
-	accounts, err := service.GetAccountsByCurrency(req.Currency)
+	page, err := bindPageParams(ctx)
+	if err != nil {
+		logger.Error.Printf("%s: bindPageParams: %v", op, err)
+		respondPageError(ctx, err)
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	accounts, err := service.GetAccountsByCurrency(req.Currency, userID, hasPermission(ctx, models.PermAccountsRead), page)
 	if err != nil {
 		logger.Error.Printf("%s: service.GetAccountsByCurrency: %v", op, err)
+		if respondPageError(ctx, err) {
+			return
+		}
 		switch {
 		case errors.Is(err, errs.ErrInvalidCurrency):
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid currency was sent"})
@@ -379,7 +461,7 @@ func getAccountByCurrency(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"accounts": accounts})
+	ctx.JSON(http.StatusOK, accounts)
 }
 
 type getAccountBalanceRequest struct {
@@ -424,7 +506,7 @@ func getAccountBalanceHandler(ctx *gin.Context) {
 		return
 	}
 
-	balance, err := service.GetAccountBalance(req.ID, userID, userID == service.AdminID)
+	balance, currency, err := service.GetAccountBalance(req.ID, userID, hasPermission(ctx, models.PermAccountsRead))
 	if err != nil {
 		logger.Error.Printf("%s: service.GetAccountBalance: %v", op, err)
 		switch {
@@ -438,5 +520,9 @@ func getAccountBalanceHandler(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"balance": balance})
+	ctx.JSON(http.StatusOK, gin.H{
+		"balance":   balance,
+		"currency":  currency,
+		"formatted": service.FormatMoney(balance, currency),
+	})
 }
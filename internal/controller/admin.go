@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"SB/internal/service"
+	"SB/logger"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// getReconciliationHandler godoc
+// @Summary Ledger reconciliation report
+// @Description Recomputes every account balance from ledger entries and reports drifts per account and currency
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.ReconciliationReport
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/reconciliation [get]
+func getReconciliationHandler(ctx *gin.Context) {
+	const op = "getReconciliationHandler"
+
+	report, err := service.Reconcile()
+	if err != nil {
+		logger.Error.Printf("%s: service.Reconcile: %v", op, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	if !report.Balanced {
+		logger.Warn.Printf("%s: ledger drift detected: %d accounts, %d unbalanced journals", op, len(report.Drifts), len(report.UnbalancedJournals))
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+// getPortfolioAtRiskHandler godoc
+// @Summary Credit portfolio at risk
+// @Description Outstanding principal of disbursed and defaulted credits per currency and delinquency bucket with PAR30, PAR60 and PAR90 ratios
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.PortfolioAtRiskReport
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/credits/portfolio-at-risk [get]
+func getPortfolioAtRiskHandler(ctx *gin.Context) {
+	const op = "getPortfolioAtRiskHandler"
+
+	report, err := service.GetPortfolioAtRisk()
+	if err != nil {
+		logger.Error.Printf("%s: service.GetPortfolioAtRisk: %v", op, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"report": report})
+}
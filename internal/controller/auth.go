@@ -0,0 +1,137 @@
+package controller
+
+import (
+	"SB/internal/errs"
+	"SB/internal/service"
+	"SB/logger"
+	"SB/utils"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// refreshTokenHandler godoc
+// @Summary Refresh tokens
+// @Description Exchanges a refresh token for a new access token and a new refresh token.
+// @Description Every refresh token can be used once; reusing an old one revokes the whole session.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param token body refreshTokenRequest true "Refresh token"
+// @Success 200 {object} models.TokenPair
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Invalid, expired or reused refresh token"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /auth/refresh [post]
+func refreshTokenHandler(ctx *gin.Context) {
+	const op = "refreshTokenHandler"
+
+	var req refreshTokenRequest
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	tokens, err := service.RefreshTokens(req.RefreshToken)
+	if err != nil {
+		logger.Error.Printf("%s: service.RefreshTokens: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrInvalidRefreshToken):
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired refresh token"})
+		case errors.Is(err, errs.ErrRefreshTokenReused):
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token was already used, please sign in again"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+type logoutRequest struct {
+	AllSessions bool `json:"all_sessions"`
+}
+
+// logoutHandler godoc
+// @Summary Log out
+// @Description Revokes the current access token and the refresh tokens of the session.
+// @Description With all_sessions the refresh tokens of every session of the user are revoked.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param logout body logoutRequest false "Logout options"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "Logged out"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /auth/logout [post]
+func logoutHandler(ctx *gin.Context) {
+	const op = "logoutHandler"
+
+	var req logoutRequest
+
+	if ctx.Request.ContentLength > 0 {
+		err := ctx.ShouldBindJSON(&req)
+		if err != nil {
+			logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+			return
+		}
+	}
+
+	claimsAny, ok := ctx.Get(claimsCtx)
+	if !ok {
+		logger.Error.Printf("%s: claims absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse token"})
+		return
+	}
+
+	claims, ok := claimsAny.(*utils.CustomClaims)
+	if !ok {
+		logger.Error.Printf("%s: claims conversion error: %v", op, claimsAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse token"})
+		return
+	}
+
+	err := service.Logout(claims.UserID, claims.ID, claims.SessionID, claims.ExpiresAt.Time, req.AllSessions)
+	if err != nil {
+		logger.Error.Printf("%s: service.Logout: %v", op, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// getJWKSHandler godoc
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying access tokens. Tokens carry the key ID in the kid header.
+// @Description A new key is published here before it starts signing; keys taken out of signing stay here until the tokens signed with them expire.
+// @Tags general
+// @Produce json
+// @Success 200 {object} models.JWKS
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /.well-known/jwks.json [get]
+func getJWKSHandler(ctx *gin.Context) {
+	const op = "getJWKSHandler"
+
+	jwks, err := service.GetJWKS()
+	if err != nil {
+		logger.Error.Printf("%s: service.GetJWKS: %v", op, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	ctx.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(service.JWKSMaxAge.Seconds())))
+	ctx.JSON(http.StatusOK, jwks)
+}
@@ -0,0 +1,777 @@
+package controller
+
+import (
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/service"
+	"SB/logger"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+type createCreditRequest struct {
+	AccountID      *int         `json:"account_id"`
+	Amount         models.Money `json:"amount" binding:"required"`
+	Currency       string       `json:"currency" binding:"required"`
+	DurationMonths int          `json:"duration_months" binding:"required"`
+	InterestRate   float64      `json:"interest_rate"`
+}
+
+// createCreditHandler godoc
+// @Summary Apply for a credit
+// @Description Creates a credit application in the pending status. The money is disbursed only after an admin approves it.
+// @Description If account_id is omitted, the borrower's current account in the credit currency is used on disbursement.
+// @Tags credits
+// @Accept json
+// @Produce json
+// @Param credit body createCreditRequest true "Credit application"
+// @Security BearerAuth
+// @Success 201 {object} models.Credit
+// @Failure 400 {object} map[string]string "Invalid input, invalid currency, amount, duration or rate"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Email or phone not verified"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /credits [post]
+func createCreditHandler(ctx *gin.Context) {
+	const op = "createCreditHandler"
+
+	var req createCreditRequest
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	credit := &models.Credit{
+		UserID:         userID,
+		AccountID:      req.AccountID,
+		Amount:         req.Amount,
+		Currency:       req.Currency,
+		DurationMonths: req.DurationMonths,
+		InterestRate:   req.InterestRate,
+	}
+
+	_, err = service.CreateCredit(credit)
+	if err != nil {
+		logger.Error.Printf("%s: service.CreateCredit: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrNotFound):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "user or account not found"})
+		case errors.Is(err, errs.ErrUserNotActive):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "user is not active"})
+		case errors.Is(err, errs.ErrInvalidCurrency):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid currency or account currency does not match"})
+		case errors.Is(err, errs.ErrInvalidAmount), errors.Is(err, errs.ErrInvalidDuration):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, errs.ErrInvalidInterestRate):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid interest rate"})
+		case errors.Is(err, errs.ErrFraud):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot use others account"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"credit": credit})
+}
+
+// getMyCreditsHandler godoc
+// @Summary Get my credits
+// @Description Returns a page of credits of the authenticated user in any status.
+// @Tags credits
+// @Produce json
+// @Param limit query int false "Page size, default and maximum come from pagination_params"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param sort query string false "Sort field, prefix with - for descending order" Enums(id, -id, created_at, -created_at, amount, -amount, outstanding, -outstanding, days_past_due, -days_past_due)
+// @Param filter query string false "Filters as filter[field]=value, fields: user_id, currency, status, delinquency_bucket"
+// @Security BearerAuth
+// @Success 200 {object} models.Page[models.Credit]
+// @Failure 400 {object} map[string]string "Invalid user ID or invalid page parameters"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /credits [get]
+func getMyCreditsHandler(ctx *gin.Context) {
+	const op = "getMyCreditsHandler"
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	page, err := bindPageParams(ctx)
+	if err != nil {
+		logger.Error.Printf("%s: bindPageParams: %v", op, err)
+		respondPageError(ctx, err)
+		return
+	}
+
+	credits, err := service.GetCreditsByUserID(userID, page)
+	if err != nil {
+		logger.Error.Printf("%s: service.GetCreditsByUserID: %v", op, err)
+		if respondPageError(ctx, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, errs.ErrNotFound), errors.Is(err, errs.ErrUserNotActive):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "user not found or not active"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, credits)
+}
+
+type creditIDRequest struct {
+	ID int `uri:"id" binding:"required,min=1"`
+}
+
+// getCreditByIDHandler godoc
+// @Summary Get credit by ID
+// @Description Returns a credit. Customers can see only their own credits.
+// @Tags credits
+// @Produce json
+// @Param id path int true "Credit ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Credit
+// @Failure 400 {object} map[string]string "Invalid ID, credit not found or belongs to another user"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /credits/{id} [get]
+func getCreditByIDHandler(ctx *gin.Context) {
+	const op = "getCreditByIDHandler"
+
+	var req creditIDRequest
+
+	err := ctx.ShouldBindUri(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid credit ID"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	credit, err := service.GetUserCredit(req.ID, userID, hasPermission(ctx, models.PermCreditsRead))
+	if err != nil {
+		logger.Error.Printf("%s: service.GetUserCredit: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrNotFound):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit not found"})
+		case errors.Is(err, errs.ErrFraud):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot view others credit"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"credit": credit})
+}
+
+// getCreditHistoryHandler godoc
+// @Summary Get credit status history
+// @Description Returns every status transition of a credit with the reason and who made it.
+// @Tags credits
+// @Produce json
+// @Param id path int true "Credit ID"
+// @Security BearerAuth
+// @Success 200 {array} models.CreditStatusChange
+// @Failure 400 {object} map[string]string "Invalid ID, credit not found or belongs to another user"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /credits/{id}/history [get]
+func getCreditHistoryHandler(ctx *gin.Context) {
+	const op = "getCreditHistoryHandler"
+
+	var req creditIDRequest
+
+	err := ctx.ShouldBindUri(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid credit ID"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	history, err := service.GetCreditStatusHistory(req.ID, userID, hasPermission(ctx, models.PermCreditsRead))
+	if err != nil {
+		logger.Error.Printf("%s: service.GetCreditStatusHistory: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrNotFound):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit not found"})
+		case errors.Is(err, errs.ErrFraud):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot view others credit"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"history": history})
+}
+
+// getCreditScheduleHandler godoc
+// @Summary Get credit repayment schedule
+// @Description Returns the annuity schedule stored at disbursement with paid amounts per installment.
+// @Description For applications that are not disbursed yet a preview from today's date is returned.
+// @Tags credits
+// @Produce json
+// @Param id path int true "Credit ID"
+// @Security BearerAuth
+// @Success 200 {array} models.CreditInstallment
+// @Failure 400 {object} map[string]string "Invalid ID, credit not found, rejected or belongs to another user"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /credits/{id}/schedule [get]
+func getCreditScheduleHandler(ctx *gin.Context) {
+	const op = "getCreditScheduleHandler"
+
+	var req creditIDRequest
+
+	err := ctx.ShouldBindUri(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid credit ID"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	schedule, err := service.GetCreditSchedule(req.ID, userID, hasPermission(ctx, models.PermCreditsRead))
+	if err != nil {
+		logger.Error.Printf("%s: service.GetCreditSchedule: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrNotFound):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit not found"})
+		case errors.Is(err, errs.ErrFraud):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot view others credit"})
+		case errors.Is(err, errs.ErrCreditNotActive):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit was rejected"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"schedule": schedule})
+}
+
+// approveCreditHandler godoc
+// @Summary Approve a credit application
+// @Description Approves a pending credit and disburses the money to the borrower's account in the same transaction.
+// @Tags credits
+// @Produce json
+// @Param id path int true "Credit ID"
+// @Param Idempotency-Key header string false "Key to safely retry the request"
+// @Security BearerAuth
+// @Success 200 {object} models.Credit
+// @Failure 400 {object} map[string]string "Invalid ID, credit not found, not pending, or no suitable borrower account in credit currency"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 409 {object} map[string]string "Request with the same idempotency key is in progress"
+// @Failure 422 {object} map[string]string "Idempotency key reused with a different request"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /credits/{id}/approve [post]
+func approveCreditHandler(ctx *gin.Context) {
+	const op = "approveCreditHandler"
+
+	var req creditIDRequest
+
+	err := ctx.ShouldBindUri(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid credit ID"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	credit, err := service.ApproveCredit(req.ID, userID)
+	if err != nil {
+		logger.Error.Printf("%s: service.ApproveCredit: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrNotFound):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit not found"})
+		case errors.Is(err, errs.ErrInvalidCreditTransition):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit is not pending"})
+		case errors.Is(err, errs.ErrNoAccountForCurrency), errors.Is(err, errs.ErrAccountNotActive):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "borrower has no active account in credit currency"})
+		case errors.Is(err, errs.ErrCreditAccountMismatch):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit account no longer belongs to the borrower or has another currency"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"credit": credit})
+}
+
+type rejectCreditRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// rejectCreditHandler godoc
+// @Summary Reject a credit application
+// @Description Rejects a pending credit. The reason is stored in the status history.
+// @Tags credits
+// @Accept json
+// @Produce json
+// @Param id path int true "Credit ID"
+// @Param reason body rejectCreditRequest true "Rejection reason"
+// @Security BearerAuth
+// @Success 200 {object} models.Credit
+// @Failure 400 {object} map[string]string "Invalid input, credit not found or not pending"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /credits/{id}/reject [post]
+func rejectCreditHandler(ctx *gin.Context) {
+	const op = "rejectCreditHandler"
+
+	var uri creditIDRequest
+
+	err := ctx.ShouldBindUri(&uri)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid credit ID"})
+		return
+	}
+
+	var req rejectCreditRequest
+
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	credit, err := service.RejectCredit(uri.ID, userID, req.Reason)
+	if err != nil {
+		logger.Error.Printf("%s: service.RejectCredit: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrNotFound):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit not found"})
+		case errors.Is(err, errs.ErrReasonRequired):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+		case errors.Is(err, errs.ErrInvalidCreditTransition):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit is not pending"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"credit": credit})
+}
+
+type repayCreditRequest struct {
+	AccountID int          `json:"account_id"`
+	Amount    models.Money `json:"amount" binding:"required"`
+}
+
+// repayCreditHandler godoc
+// @Summary Repay a credit
+// @Description Debits the amount from the borrower's account (the current account in the credit currency by default).
+// @Description The payment covers schedule installments in order, interest first and then principal.
+// @Description The credit becomes repaid when nothing is outstanding.
+// @Tags credits
+// @Accept json
+// @Produce json
+// @Param id path int true "Credit ID"
+// @Param payment body repayCreditRequest true "Payment"
+// @Param Idempotency-Key header string false "Key to safely retry the request"
+// @Security BearerAuth
+// @Success 200 {object} models.Credit
+// @Failure 400 {object} map[string]string "Invalid input, credit not active, overpayment or insufficient balance"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Email or phone not verified"
+// @Failure 409 {object} map[string]string "Request with the same idempotency key is in progress"
+// @Failure 422 {object} map[string]string "Idempotency key reused with a different request"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /credits/{id}/repay [post]
+func repayCreditHandler(ctx *gin.Context) {
+	const op = "repayCreditHandler"
+
+	var uri creditIDRequest
+
+	err := ctx.ShouldBindUri(&uri)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid credit ID"})
+		return
+	}
+
+	var req repayCreditRequest
+
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	credit, err := service.RepayCredit(uri.ID, req.AccountID, req.Amount, userID)
+	if err != nil {
+		logger.Error.Printf("%s: service.RepayCredit: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrNotFound):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit or account not found"})
+		case errors.Is(err, errs.ErrFraud):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot repay from others account"})
+		case errors.Is(err, errs.ErrCreditNotActive):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit is not active"})
+		case errors.Is(err, errs.ErrInvalidAmount):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
+		case errors.Is(err, errs.ErrOverpayment):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "amount exceeds outstanding debt"})
+		case errors.Is(err, errs.ErrInvalidCurrency):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "account currency must match credit currency"})
+		case errors.Is(err, errs.ErrNoAccountForCurrency):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "no account in credit currency"})
+		case errors.Is(err, errs.ErrInsufficientFunds):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "insufficient balance"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"credit": credit})
+}
+
+type prepayCreditRequest struct {
+	AccountID int          `json:"account_id"`
+	Amount    models.Money `json:"amount" binding:"required"`
+	Mode      string       `json:"mode" binding:"required"`
+}
+
+// prepayCreditHandler godoc
+// @Summary Prepay a credit
+// @Description Pays everything already due, then interest accrued in the current period, and the rest goes to principal.
+// @Description The remaining schedule is recalculated: reduce_term keeps the installment and shortens the term,
+// @Description reduce_installment keeps the term and lowers the installment. Paying the payoff amount closes the credit.
+// @Tags credits
+// @Accept json
+// @Produce json
+// @Param id path int true "Credit ID"
+// @Param payment body prepayCreditRequest true "Prepayment"
+// @Param Idempotency-Key header string false "Key to safely retry the request"
+// @Security BearerAuth
+// @Success 200 {object} models.Credit
+// @Failure 400 {object} map[string]string "Invalid input, invalid mode, amount too small or above payoff, insufficient balance"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Email or phone not verified"
+// @Failure 409 {object} map[string]string "Request with the same idempotency key is in progress"
+// @Failure 422 {object} map[string]string "Idempotency key reused with a different request"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /credits/{id}/prepay [post]
+func prepayCreditHandler(ctx *gin.Context) {
+	const op = "prepayCreditHandler"
+
+	var uri creditIDRequest
+
+	err := ctx.ShouldBindUri(&uri)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid credit ID"})
+		return
+	}
+
+	var req prepayCreditRequest
+
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	credit, err := service.PrepayCredit(uri.ID, req.AccountID, req.Amount, req.Mode, userID)
+	if err != nil {
+		logger.Error.Printf("%s: service.PrepayCredit: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrNotFound):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit or account not found"})
+		case errors.Is(err, errs.ErrFraud):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot repay from others account"})
+		case errors.Is(err, errs.ErrCreditNotActive):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit is not active"})
+		case errors.Is(err, errs.ErrNoCreditSchedule):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit has no schedule, use regular repayment"})
+		case errors.Is(err, errs.ErrInvalidPrepaymentMode), errors.Is(err, errs.ErrPrepaymentTooSmall):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, errs.ErrInvalidAmount):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
+		case errors.Is(err, errs.ErrOverpayment):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "amount exceeds payoff amount"})
+		case errors.Is(err, errs.ErrInvalidCurrency):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "account currency must match credit currency"})
+		case errors.Is(err, errs.ErrNoAccountForCurrency):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "no account in credit currency"})
+		case errors.Is(err, errs.ErrInsufficientFunds):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "insufficient balance"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"credit": credit})
+}
+
+type getPayoffQuoteRequest struct {
+	Date time.Time `form:"date" time_format:"2006-01-02"`
+}
+
+// getPayoffQuoteHandler godoc
+// @Summary Get a payoff quote
+// @Description Returns the amount that closes the credit on the given date (today by default):
+// @Description installments already due with penalties, interest accrued in the current period and remaining principal.
+// @Tags credits
+// @Produce json
+// @Param id path int true "Credit ID"
+// @Param date query string false "Payoff date, YYYY-MM-DD"
+// @Security BearerAuth
+// @Success 200 {object} models.PayoffQuote
+// @Failure 400 {object} map[string]string "Invalid ID or date, credit not found, not active or belongs to another user"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /credits/{id}/payoff [get]
+func getPayoffQuoteHandler(ctx *gin.Context) {
+	const op = "getPayoffQuoteHandler"
+
+	var uri creditIDRequest
+
+	err := ctx.ShouldBindUri(&uri)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid credit ID"})
+		return
+	}
+
+	var req getPayoffQuoteRequest
+
+	err = ctx.ShouldBindQuery(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindQuery: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "date must be in YYYY-MM-DD format"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	quote, err := service.GetPayoffQuote(uri.ID, userID, hasPermission(ctx, models.PermCreditsRead), req.Date)
+	if err != nil {
+		logger.Error.Printf("%s: service.GetPayoffQuote: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrNotFound):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit not found"})
+		case errors.Is(err, errs.ErrFraud):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot view others credit"})
+		case errors.Is(err, errs.ErrCreditNotActive):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit is not active"})
+		case errors.Is(err, errs.ErrNoCreditSchedule):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "credit has no schedule"})
+		case errors.Is(err, errs.ErrInvalidQuoteDate):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "date cannot be in the past"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"quote": quote})
+}
+
+type getCreditsByStatusRequest struct {
+	Status string `form:"status" binding:"required"`
+}
+
+// getCreditsByStatusHandler godoc
+// @Summary Get credits by status
+// @Description Returns a page of credits in the given status, e.g. pending applications waiting for a decision.
+// @Tags admin
+// @Produce json
+// @Param status query string true "Credit status" Enums(pending, approved, rejected, disbursed, repaid, defaulted)
+// @Param limit query int false "Page size, default and maximum come from pagination_params"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param sort query string false "Sort field, prefix with - for descending order" Enums(id, -id, created_at, -created_at, amount, -amount, outstanding, -outstanding, days_past_due, -days_past_due)
+// @Param filter query string false "Filters as filter[field]=value, fields: user_id, currency, status, delinquency_bucket"
+// @Security BearerAuth
+// @Success 200 {object} models.Page[models.Credit]
+// @Failure 400 {object} map[string]string "Invalid status or invalid page parameters"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/credits [get]
+func getCreditsByStatusHandler(ctx *gin.Context) {
+	const op = "getCreditsByStatusHandler"
+
+	var req getCreditsByStatusRequest
+
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindQuery: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "status is required"})
+		return
+	}
+
+	page, err := bindPageParams(ctx)
+	if err != nil {
+		logger.Error.Printf("%s: bindPageParams: %v", op, err)
+		respondPageError(ctx, err)
+		return
+	}
+
+	credits, err := service.GetCreditsByStatus(req.Status, page)
+	if err != nil {
+		logger.Error.Printf("%s: service.GetCreditsByStatus: %v", op, err)
+		if respondPageError(ctx, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, errs.ErrInvalidCreditStatus):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid credit status"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, credits)
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/service"
+	"SB/logger"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// getCurrenciesHandler godoc
+// @Summary Get currency registry
+// @Description Retrieves all currencies with ISO 4217 numeric code, minor-unit exponent and enabled flag
+// @Tags currencies
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Currency
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /currencies [get]
+func getCurrenciesHandler(ctx *gin.Context) {
+	const op = "getCurrenciesHandler"
+
+	currencies, err := service.GetCurrencies()
+	if err != nil {
+		logger.Error.Printf("%s: service.GetCurrencies: %v", op, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"currencies": currencies})
+}
+
+type saveCurrencyRequest struct {
+	NumericCode string `json:"numeric_code" binding:"required"`
+	Name        string `json:"name"`
+	MinorUnits  int    `json:"minor_units" binding:"min=0"`
+	Enabled     bool   `json:"enabled"`
+}
+
+// saveCurrencyHandler godoc
+// @Summary Add or update a currency
+// @Description Adds a currency to the registry or changes its precision and enabled flag
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param code path string true "ISO 4217 alphabetic code"
+// @Param currency body saveCurrencyRequest true "Currency data"
+// @Security BearerAuth
+// @Success 200 {object} models.Currency
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 409 {object} map[string]string "Minor units of a currency in use cannot change"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/currencies/{code} [put]
+func saveCurrencyHandler(ctx *gin.Context) {
+	const op = "saveCurrencyHandler"
+
+	var req saveCurrencyRequest
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	currency := &models.Currency{
+		Code:        ctx.Param("code"),
+		NumericCode: req.NumericCode,
+		Name:        req.Name,
+		MinorUnits:  req.MinorUnits,
+		Enabled:     req.Enabled,
+	}
+
+	err = service.SaveCurrency(currency)
+	if err != nil {
+		logger.Error.Printf("%s: service.SaveCurrency: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrInvalidCurrency):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid currency code, numeric code or minor units"})
+		case errors.Is(err, errs.ErrCurrencyInUse):
+			ctx.JSON(http.StatusConflict, gin.H{"error": "minor units cannot be changed while accounts, deposits or credits use the currency"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"currency": currency})
+}
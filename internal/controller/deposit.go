@@ -0,0 +1,584 @@
+package controller
+
+import (
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/service"
+	"SB/logger"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type createDepositRequest struct {
+	ProductID           int          `json:"product_id" binding:"required,min=1"`
+	AccountID           int          `json:"account_id"`
+	Amount              models.Money `json:"amount" binding:"required"`
+	DurationMonths      int          `json:"duration_months" binding:"required"`
+	PayoutAccountID     *int         `json:"payout_account_id"`
+	MaturityInstruction string       `json:"maturity_instruction"`
+}
+
+// createDepositHandler godoc
+// @Summary Open a deposit
+// @Description Opens a deposit of a product for one of the terms it offers. Currency and interest rate come from the product.
+// @Description The amount is moved from the user's account (the current account in the product currency by default).
+// @Description Interest accrues daily and is capitalized monthly or quarterly as the product defines;
+// @Description with payout_account_id it is paid to that account instead.
+// @Description maturity_instruction tells what happens at maturity: payout (default), rollover_with_interest or rollover_principal.
+// @Tags deposits
+// @Accept json
+// @Produce json
+// @Param deposit body createDepositRequest true "Deposit data"
+// @Param Idempotency-Key header string false "Key to safely retry the request"
+// @Security BearerAuth
+// @Success 201 {object} map[string]int
+// @Failure 400 {object} map[string]string "Invalid input, invalid currency, account not active or insufficient balance"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Email or phone not verified"
+// @Failure 409 {object} map[string]string "Request with the same idempotency key is in progress"
+// @Failure 422 {object} map[string]string "Idempotency key reused with a different request"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /deposits [post]
+func createDepositHandler(ctx *gin.Context) {
+	const op = "createDepositHandler"
+
+	var req createDepositRequest
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	deposit := &models.Deposit{
+		UserID:              userID,
+		ProductID:           &req.ProductID,
+		Amount:              req.Amount,
+		DurationMonths:      req.DurationMonths,
+		PayoutAccountID:     req.PayoutAccountID,
+		MaturityInstruction: req.MaturityInstruction,
+	}
+
+	depositID, err := service.CreateDeposit(deposit, req.AccountID)
+	if err != nil {
+		logger.Error.Printf("%s: service.CreateDeposit: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrNotFound):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "user, product or account not found"})
+		case errors.Is(err, errs.ErrUserNotActive):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "user is not active"})
+		case errors.Is(err, errs.ErrInvalidAmount):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
+		case errors.Is(err, errs.ErrDepositProductNotActive), errors.Is(err, errs.ErrInvalidDepositTerm),
+			errors.Is(err, errs.ErrDepositAmountOutOfRange), errors.Is(err, errs.ErrNoDepositRate):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, errs.ErrInvalidDuration):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid duration"})
+		case errors.Is(err, errs.ErrInvalidMaturityAction):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, errs.ErrInvalidCurrency):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid currency or account currency does not match"})
+		case errors.Is(err, errs.ErrNoAccountForCurrency):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "no account in deposit currency"})
+		case errors.Is(err, errs.ErrAccountNotActive):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "account is not active or belongs to another user"})
+		case errors.Is(err, errs.ErrInsufficientFunds):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "insufficient balance"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"deposit_id": depositID})
+}
+
+// getMyDepositsHandler godoc
+// @Summary Get my deposits
+// @Description Returns a page of active deposits of the authenticated user.
+// @Tags deposits
+// @Produce json
+// @Param limit query int false "Page size, default and maximum come from pagination_params"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param sort query string false "Sort field, prefix with - for descending order" Enums(id, -id, created_at, -created_at, expires_at, -expires_at, amount, -amount)
+// @Param filter query string false "Filters as filter[field]=value, fields: user_id, currency, product_id, maturity_instruction"
+// @Security BearerAuth
+// @Success 200 {object} models.Page[models.Deposit]
+// @Failure 400 {object} map[string]string "Invalid user ID or invalid page parameters"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /deposits [get]
+func getMyDepositsHandler(ctx *gin.Context) {
+	const op = "getMyDepositsHandler"
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	page, err := bindPageParams(ctx)
+	if err != nil {
+		logger.Error.Printf("%s: bindPageParams: %v", op, err)
+		respondPageError(ctx, err)
+		return
+	}
+
+	deposits, err := service.GetDepositsByUserID(userID, page)
+	if err != nil {
+		logger.Error.Printf("%s: service.GetDepositsByUserID: %v", op, err)
+		if respondPageError(ctx, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, errs.ErrUserNotActive):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "user not found or not active"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, deposits)
+}
+
+type depositIDRequest struct {
+	ID int `uri:"id" binding:"required,min=1"`
+}
+
+// getDepositByIDHandler godoc
+// @Summary Get deposit by ID
+// @Description Returns an active deposit. Customers can see only their own deposits.
+// @Tags deposits
+// @Produce json
+// @Param id path int true "Deposit ID"
+// @Security BearerAuth
+// @Success 200 {object} models.Deposit
+// @Failure 400 {object} map[string]string "Invalid ID, deposit not found or belongs to another user"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /deposits/{id} [get]
+func getDepositByIDHandler(ctx *gin.Context) {
+	const op = "getDepositByIDHandler"
+
+	var req depositIDRequest
+
+	err := ctx.ShouldBindUri(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid deposit ID"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	deposit, err := service.GetUserDeposit(req.ID, userID, hasPermission(ctx, models.PermDepositsRead))
+	if err != nil {
+		logger.Error.Printf("%s: service.GetUserDeposit: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrNotFound), errors.Is(err, errs.ErrDepositNotActive):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "deposit not found"})
+		case errors.Is(err, errs.ErrFraud):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot view others deposit"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"deposit": deposit})
+}
+
+type closeDepositRequest struct {
+	AccountID int `json:"account_id"`
+}
+
+// closeDepositHandler godoc
+// @Summary Close a deposit
+// @Description Pays the principal and interest of a matured deposit to the owner's account
+// @Description (the current account in the deposit currency by default).
+// @Tags deposits
+// @Accept json
+// @Produce json
+// @Param id path int true "Deposit ID"
+// @Param account body closeDepositRequest false "Payout account"
+// @Param Idempotency-Key header string false "Key to safely retry the request"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string "Invalid input, deposit not found, not matured or belongs to another user"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Email or phone not verified"
+// @Failure 409 {object} map[string]string "Request with the same idempotency key is in progress"
+// @Failure 422 {object} map[string]string "Idempotency key reused with a different request"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /deposits/{id}/close [post]
+func closeDepositHandler(ctx *gin.Context) {
+	const op = "closeDepositHandler"
+
+	var uri depositIDRequest
+
+	err := ctx.ShouldBindUri(&uri)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid deposit ID"})
+		return
+	}
+
+	var req closeDepositRequest
+
+	// Тело необязательно: без него выплата идёт на текущий счёт
+	if ctx.Request.ContentLength > 0 {
+		err = ctx.ShouldBindJSON(&req)
+		if err != nil {
+			logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+			return
+		}
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	err = service.CloseDeposit(uri.ID, req.AccountID, userID, hasPermission(ctx, models.PermDepositsManage))
+	if err != nil {
+		logger.Error.Printf("%s: service.CloseDeposit: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrNotFound), errors.Is(err, errs.ErrDepositNotActive):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "deposit not found or already closed"})
+		case errors.Is(err, errs.ErrFraud):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot close others deposit or pay out to others account"})
+		case errors.Is(err, errs.ErrDepositNotMatured):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "deposit has not matured yet, use early withdrawal"})
+		case errors.Is(err, errs.ErrNoAccountForCurrency):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "no account in deposit currency"})
+		case errors.Is(err, errs.ErrAccountNotActive):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "account is not active"})
+		case errors.Is(err, errs.ErrInvalidCurrency):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "account currency must match deposit currency"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "deposit closed successfully"})
+}
+
+func respondEarlyWithdrawalError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errs.ErrNotFound), errors.Is(err, errs.ErrDepositNotActive):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "deposit not found or already closed"})
+	case errors.Is(err, errs.ErrFraud):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot withdraw others deposit or pay out to others account"})
+	case errors.Is(err, errs.ErrEarlyCloseNotAllowed):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "deposit product does not allow early withdrawal"})
+	case errors.Is(err, errs.ErrDepositMatured):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "deposit has matured, close it instead"})
+	case errors.Is(err, errs.ErrNoAccountForCurrency):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "no account in deposit currency"})
+	case errors.Is(err, errs.ErrAccountNotActive):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "account is not active"})
+	case errors.Is(err, errs.ErrInvalidCurrency):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "account currency must match deposit currency"})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+	}
+}
+
+// getEarlyWithdrawalQuoteHandler godoc
+// @Summary Early withdrawal quote
+// @Description Shows what breaking the deposit today would pay: interest recalculated at the on-demand rate
+// @Description or reduced by the penalty of the product, interest already paid out and the net payout.
+// @Tags deposits
+// @Produce json
+// @Param id path int true "Deposit ID"
+// @Security BearerAuth
+// @Success 200 {object} models.EarlyWithdrawalQuote
+// @Failure 400 {object} map[string]string "Deposit not found, matured, early withdrawal not allowed or belongs to another user"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /deposits/{id}/early-withdrawal [get]
+func getEarlyWithdrawalQuoteHandler(ctx *gin.Context) {
+	const op = "getEarlyWithdrawalQuoteHandler"
+
+	var uri depositIDRequest
+
+	err := ctx.ShouldBindUri(&uri)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid deposit ID"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	quote, err := service.GetEarlyWithdrawalQuote(uri.ID, userID, hasPermission(ctx, models.PermDepositsRead))
+	if err != nil {
+		logger.Error.Printf("%s: service.GetEarlyWithdrawalQuote: %v", op, err)
+		respondEarlyWithdrawalError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"quote": quote})
+}
+
+// withdrawDepositEarlyHandler godoc
+// @Summary Withdraw a deposit early
+// @Description Closes the deposit before maturity and pays the net amount from the early withdrawal quote
+// @Description to the owner's account (the current account in the deposit currency by default).
+// @Tags deposits
+// @Accept json
+// @Produce json
+// @Param id path int true "Deposit ID"
+// @Param account body closeDepositRequest false "Payout account"
+// @Param Idempotency-Key header string false "Key to safely retry the request"
+// @Security BearerAuth
+// @Success 200 {object} models.EarlyWithdrawalQuote
+// @Failure 400 {object} map[string]string "Invalid input, deposit not found, matured, early withdrawal not allowed or belongs to another user"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Email or phone not verified"
+// @Failure 409 {object} map[string]string "Request with the same idempotency key is in progress"
+// @Failure 422 {object} map[string]string "Idempotency key reused with a different request"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /deposits/{id}/early-withdrawal [post]
+func withdrawDepositEarlyHandler(ctx *gin.Context) {
+	const op = "withdrawDepositEarlyHandler"
+
+	var uri depositIDRequest
+
+	err := ctx.ShouldBindUri(&uri)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid deposit ID"})
+		return
+	}
+
+	var req closeDepositRequest
+
+	// Тело необязательно: без него выплата идёт на текущий счёт
+	if ctx.Request.ContentLength > 0 {
+		err = ctx.ShouldBindJSON(&req)
+		if err != nil {
+			logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+			return
+		}
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	quote, err := service.WithdrawDepositEarly(uri.ID, req.AccountID, userID, hasPermission(ctx, models.PermDepositsManage))
+	if err != nil {
+		logger.Error.Printf("%s: service.WithdrawDepositEarly: %v", op, err)
+		respondEarlyWithdrawalError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "deposit withdrawn early", "quote": quote})
+}
+
+type previewDepositInterestRequest struct {
+	ProductID      int          `form:"product_id" binding:"required,min=1"`
+	Amount         models.Money `form:"amount" binding:"required"`
+	DurationMonths int          `form:"duration_months" binding:"required"`
+}
+
+// previewDepositInterestHandler godoc
+// @Summary Preview deposit interest
+// @Description Calculates the rate and the interest a deposit of the product would earn by maturity without opening it,
+// @Description including capitalization and the day count convention of the product.
+// @Tags deposits
+// @Produce json
+// @Param product_id query int true "Deposit product ID"
+// @Param amount query int true "Amount in minor units"
+// @Param duration_months query int true "Term in months"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string "Product not found, term not offered, amount outside limits"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /deposits/interest [get]
+func previewDepositInterestHandler(ctx *gin.Context) {
+	const op = "previewDepositInterestHandler"
+
+	var req previewDepositInterestRequest
+
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindQuery: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "product_id, amount and duration_months are required"})
+		return
+	}
+
+	interest, rate, product, err := service.PreviewDepositInterest(req.ProductID, req.Amount, req.DurationMonths)
+	if err != nil {
+		logger.Error.Printf("%s: service.PreviewDepositInterest: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrNotFound):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "deposit product not found"})
+		case errors.Is(err, errs.ErrInvalidAmount):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
+		case errors.Is(err, errs.ErrInvalidDuration):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid duration"})
+		case errors.Is(err, errs.ErrDepositProductNotActive), errors.Is(err, errs.ErrInvalidDepositTerm),
+			errors.Is(err, errs.ErrDepositAmountOutOfRange), errors.Is(err, errs.ErrNoDepositRate):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"interest_rate": rate,
+		"interest":      interest,
+		"total":         req.Amount + interest,
+		"currency":      product.Currency,
+		"formatted":     service.FormatMoney(req.Amount+interest, product.Currency),
+	})
+}
+
+type maturityInstructionRequest struct {
+	Instruction string `json:"instruction" binding:"required"`
+}
+
+// updateDepositMaturityHandler godoc
+// @Summary Change the maturity instruction
+// @Description Sets what happens to the deposit at maturity: payout pays principal and interest to the payout account
+// @Description (or the current account), rollover_with_interest opens a new term with the interest added,
+// @Description rollover_principal opens a new term for the principal and pays the interest out.
+// @Tags deposits
+// @Accept json
+// @Produce json
+// @Param id path int true "Deposit ID"
+// @Param instruction body maturityInstructionRequest true "Maturity instruction"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string "Invalid instruction, deposit not found or belongs to another user"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /deposits/{id}/maturity-instruction [patch]
+func updateDepositMaturityHandler(ctx *gin.Context) {
+	const op = "updateDepositMaturityHandler"
+
+	var uri depositIDRequest
+
+	err := ctx.ShouldBindUri(&uri)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid deposit ID"})
+		return
+	}
+
+	var req maturityInstructionRequest
+
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	err = service.UpdateDepositMaturityInstruction(uri.ID, userID, req.Instruction, hasPermission(ctx, models.PermDepositsManage))
+	if err != nil {
+		logger.Error.Printf("%s: service.UpdateDepositMaturityInstruction: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrInvalidMaturityAction):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, errs.ErrNotFound), errors.Is(err, errs.ErrDepositNotActive):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "deposit not found or already closed"})
+		case errors.Is(err, errs.ErrFraud):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot change others deposit"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "maturity instruction updated"})
+}
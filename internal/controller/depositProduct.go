@@ -0,0 +1,224 @@
+package controller
+
+import (
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/service"
+	"SB/logger"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type depositRateTierRequest struct {
+	TermMonths int          `json:"term_months" binding:"required"`
+	MinAmount  models.Money `json:"min_amount"`
+	Rate       float64      `json:"rate"`
+}
+
+type saveDepositProductRequest struct {
+	Name                string                   `json:"name" binding:"required"`
+	Currency            string                   `json:"currency" binding:"required"`
+	MinAmount           models.Money             `json:"min_amount" binding:"required"`
+	MaxAmount           models.Money             `json:"max_amount" binding:"required"`
+	AllowedTerms        []int64                  `json:"allowed_terms" binding:"required"`
+	EarlyWithdrawal     string                   `json:"early_withdrawal"`
+	EarlyWithdrawalRate float64                  `json:"early_withdrawal_rate"`
+	Compounding         string                   `json:"compounding"`
+	DayCount            string                   `json:"day_count"`
+	Active              *bool                    `json:"active"`
+	Rates               []depositRateTierRequest `json:"rates" binding:"required,dive"`
+}
+
+func (r saveDepositProductRequest) toModel() *models.DepositProduct {
+	product := &models.DepositProduct{
+		Name:                r.Name,
+		Currency:            r.Currency,
+		MinAmount:           r.MinAmount,
+		MaxAmount:           r.MaxAmount,
+		AllowedTerms:        r.AllowedTerms,
+		EarlyWithdrawal:     r.EarlyWithdrawal,
+		EarlyWithdrawalRate: r.EarlyWithdrawalRate,
+		Compounding:         r.Compounding,
+		DayCount:            r.DayCount,
+		Active:              r.Active == nil || *r.Active,
+	}
+	for _, rate := range r.Rates {
+		product.Rates = append(product.Rates, models.DepositRateTier{
+			TermMonths: rate.TermMonths,
+			MinAmount:  rate.MinAmount,
+			Rate:       rate.Rate,
+		})
+	}
+	return product
+}
+
+func respondDepositProductError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errs.ErrNotFound):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "deposit product not found"})
+	case errors.Is(err, errs.ErrInvalidCurrency):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid currency"})
+	case errors.Is(err, errs.ErrInvalidInterestRate):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid interest rate"})
+	case errors.Is(err, errs.ErrInvalidDepositProduct):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, errs.ErrDepositProductExists):
+		ctx.JSON(http.StatusConflict, gin.H{"error": "deposit product with this name already exists"})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+	}
+}
+
+// createDepositProductHandler godoc
+// @Summary Create a deposit product
+// @Description Adds a product to the deposit catalogue: currency, amount limits, allowed terms, rates by term and amount tier,
+// @Description early withdrawal policy, compounding frequency and day count convention (act_365 or 30_360).
+// @Description Every allowed term needs a rate from min_amount.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param product body saveDepositProductRequest true "Deposit product"
+// @Security BearerAuth
+// @Success 201 {object} models.DepositProduct
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 409 {object} map[string]string "Product with this name already exists"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/deposit-products [post]
+func createDepositProductHandler(ctx *gin.Context) {
+	const op = "createDepositProductHandler"
+
+	var req saveDepositProductRequest
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	product := req.toModel()
+
+	err = service.CreateDepositProduct(product)
+	if err != nil {
+		logger.Error.Printf("%s: service.CreateDepositProduct: %v", op, err)
+		respondDepositProductError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"product": product})
+}
+
+type depositProductIDRequest struct {
+	ID int `uri:"id" binding:"required,min=1"`
+}
+
+// updateDepositProductHandler godoc
+// @Summary Update a deposit product
+// @Description Replaces the product terms and rate table. Deposits that are already open keep their rate.
+// @Description Set active to false to stop offering the product.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "Deposit product ID"
+// @Param product body saveDepositProductRequest true "Deposit product"
+// @Security BearerAuth
+// @Success 200 {object} models.DepositProduct
+// @Failure 400 {object} map[string]string "Invalid input or product not found"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 409 {object} map[string]string "Product with this name already exists"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/deposit-products/{id} [put]
+func updateDepositProductHandler(ctx *gin.Context) {
+	const op = "updateDepositProductHandler"
+
+	var uri depositProductIDRequest
+
+	err := ctx.ShouldBindUri(&uri)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+
+	var req saveDepositProductRequest
+
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	product := req.toModel()
+	product.ID = uri.ID
+
+	err = service.UpdateDepositProduct(product)
+	if err != nil {
+		logger.Error.Printf("%s: service.UpdateDepositProduct: %v", op, err)
+		respondDepositProductError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"product": product})
+}
+
+// getDepositProductsHandler godoc
+// @Summary Deposit products catalogue
+// @Description Returns products that can be opened now with their terms and rates. Users with the products.manage permission also see inactive products.
+// @Tags deposits
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.DepositProduct
+// @Failure 400 {object} map[string]string "Invalid user ID"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /deposit-products [get]
+func getDepositProductsHandler(ctx *gin.Context) {
+	const op = "getDepositProductsHandler"
+
+	products, err := service.GetDepositProducts(!hasPermission(ctx, models.PermProductsManage))
+	if err != nil {
+		logger.Error.Printf("%s: service.GetDepositProducts: %v", op, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"products": products})
+}
+
+// getDepositProductByIDHandler godoc
+// @Summary Get deposit product by ID
+// @Tags deposits
+// @Produce json
+// @Param id path int true "Deposit product ID"
+// @Security BearerAuth
+// @Success 200 {object} models.DepositProduct
+// @Failure 400 {object} map[string]string "Invalid ID or product not found"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /deposit-products/{id} [get]
+func getDepositProductByIDHandler(ctx *gin.Context) {
+	const op = "getDepositProductByIDHandler"
+
+	var req depositProductIDRequest
+
+	err := ctx.ShouldBindUri(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid product ID"})
+		return
+	}
+
+	product, err := service.GetDepositProductByID(req.ID)
+	if err != nil {
+		logger.Error.Printf("%s: service.GetDepositProductByID: %v", op, err)
+		respondDepositProductError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"product": product})
+}
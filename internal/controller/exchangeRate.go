@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/service"
+	"SB/logger"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"time"
+)
+
+type createExchangeRateRequest struct {
+	BaseCurrency  string     `json:"base_currency" binding:"required"`
+	QuoteCurrency string     `json:"quote_currency" binding:"required"`
+	Rate          float64    `json:"rate" binding:"required"`
+	EffectiveAt   *time.Time `json:"effective_at"`
+}
+
+// createExchangeRateHandler godoc
+// @Summary Add an exchange rate
+// @Description Adds a rate for a currency pair valid from effective_at (now by default). Rates are never overwritten.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param rate body createExchangeRateRequest true "Exchange rate"
+// @Security BearerAuth
+// @Success 201 {object} models.ExchangeRate
+// @Failure 400 {object} map[string]string "Invalid input or invalid currency"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 409 {object} map[string]string "Rate for this moment already exists"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/exchange-rates [post]
+func createExchangeRateHandler(ctx *gin.Context) {
+	const op = "createExchangeRateHandler"
+
+	var req createExchangeRateRequest
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	rate := &models.ExchangeRate{
+		BaseCurrency:  req.BaseCurrency,
+		QuoteCurrency: req.QuoteCurrency,
+		Rate:          req.Rate,
+	}
+	if req.EffectiveAt != nil {
+		rate.EffectiveAt = *req.EffectiveAt
+	}
+
+	err = service.CreateExchangeRate(rate, userID)
+	if err != nil {
+		logger.Error.Printf("%s: service.CreateExchangeRate: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrInvalidCurrency):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid currency was sent"})
+		case errors.Is(err, errs.ErrInvalidExchangeRate):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "rate must be positive and currencies must differ"})
+		case errors.Is(err, errs.ErrExchangeRateExists):
+			ctx.JSON(http.StatusConflict, gin.H{"error": "rate for this moment already exists"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"rate": rate})
+}
+
+// importExchangeRatesHandler godoc
+// @Summary Bulk upload exchange rates from CSV
+// @Description Imports rates from a CSV file (multipart field "file" or raw text/csv body).
+// @Description Line format: base_currency,quote_currency,rate[,effective_at RFC3339]. Either all rates are imported or none.
+// @Tags admin
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file false "CSV file"
+// @Security BearerAuth
+// @Success 201 {object} map[string]int "Number of imported rates"
+// @Failure 400 {object} map[string]string "Invalid file"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 409 {object} map[string]string "Some rate already exists"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/exchange-rates/csv [post]
+func importExchangeRatesHandler(ctx *gin.Context) {
+	const op = "importExchangeRatesHandler"
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	var source io.Reader = ctx.Request.Body
+	if fileHeader, err := ctx.FormFile("file"); err == nil {
+		file, err := fileHeader.Open()
+		if err != nil {
+			logger.Error.Printf("%s: fileHeader.Open: %v", op, err)
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent file"})
+			return
+		}
+		defer file.Close()
+		source = file
+	}
+
+	imported, err := service.ImportExchangeRatesCSV(source, userID)
+	if err != nil {
+		logger.Error.Printf("%s: service.ImportExchangeRatesCSV: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrInvalidCurrency) || errors.Is(err, errs.ErrInvalidExchangeRate):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, errs.ErrExchangeRateExists):
+			ctx.JSON(http.StatusConflict, gin.H{"error": "some rate for this moment already exists"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"imported": imported})
+}
+
+type getExchangeRateHistoryRequest struct {
+	BaseCurrency  string `form:"base" binding:"required"`
+	QuoteCurrency string `form:"quote" binding:"required"`
+}
+
+// getExchangeRateHistoryHandler godoc
+// @Summary Exchange rate history
+// @Description Returns all rates of a currency pair, newest first
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param base query string true "Base currency"
+// @Param quote query string true "Quote currency"
+// @Security BearerAuth
+// @Success 200 {array} models.ExchangeRate
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/exchange-rates [get]
+func getExchangeRateHistoryHandler(ctx *gin.Context) {
+	const op = "getExchangeRateHistoryHandler"
+
+	var req getExchangeRateHistoryRequest
+	err := ctx.ShouldBindQuery(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindQuery: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	rates, err := service.GetExchangeRateHistory(req.BaseCurrency, req.QuoteCurrency)
+	if err != nil {
+		logger.Error.Printf("%s: service.GetExchangeRateHistory: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrInvalidCurrency):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid currency was sent"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"rates": rates})
+}
@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"SB/internal/errs"
+	"SB/internal/service"
+	"SB/logger"
+	"bytes"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+)
+
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"
+	idempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+// responseRecorder дублирует тело ответа, чтобы его можно было сохранить для повторов
+type responseRecorder struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotencyMiddleware обрабатывает заголовок Idempotency-Key на денежных операциях:
+// первый ответ сохраняется и отдаётся повторно при ретраях клиента.
+// В отпечаток входит фактический путь, а не шаблон маршрута: ключ, отправленный на /credits/1/repay,
+// не сработает для /credits/2/repay.
+// Должен стоять после checkUserAuthentication.
+func idempotencyMiddleware(c *gin.Context) {
+	const op = "idempotencyMiddleware"
+
+	key := c.GetHeader(idempotencyKeyHeader)
+	if key == "" {
+		c.Next()
+		return
+	}
+
+	userID, ok := c.Get(userIDCtx)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		logger.Error.Printf("%s: io.ReadAll: %v", op, err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	idempotencyKey, replay, err := service.BeginIdempotentRequest(userID.(int), key, c.Request.Method, c.Request.URL.Path, body)
+	if err != nil {
+		logger.Error.Printf("%s: service.BeginIdempotentRequest: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrInvalidIdempotencyKey):
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid idempotency key"})
+		case errors.Is(err, errs.ErrIdempotencyKeyReused):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "idempotency key was already used with a different request"})
+		case errors.Is(err, errs.ErrIdempotencyKeyInProgress):
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "request with this idempotency key is still in progress"})
+		default:
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	if replay {
+		c.Header(idempotentReplayedHeader, "true")
+		c.Data(*idempotencyKey.StatusCode, gin.MIMEJSON, idempotencyKey.ResponseBody)
+		c.Abort()
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: c.Writer, body: &bytes.Buffer{}}
+	c.Writer = recorder
+
+	// Обработчик упал с паникой: ключ освобождается, чтобы клиент мог повторить запрос, а панику дальше обрабатывает gin
+	defer func() {
+		if r := recover(); r != nil {
+			if err := service.ReleaseIdempotentRequest(idempotencyKey.ID); err != nil {
+				logger.Error.Printf("%s: service.ReleaseIdempotentRequest: %v", op, err)
+			}
+			panic(r)
+		}
+	}()
+
+	c.Next()
+
+	if err = service.CompleteIdempotentRequest(idempotencyKey.ID, c.Writer.Status(), recorder.body.Bytes()); err != nil {
+		logger.Error.Printf("%s: service.CompleteIdempotentRequest: %v", op, err)
+	}
+}
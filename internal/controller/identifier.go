@@ -0,0 +1,334 @@
+package controller
+
+import (
+	"SB/internal/errs"
+	"SB/internal/service"
+	"SB/logger"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// Ответ на ошибки идентификаторов для входа. Возвращает false, если ошибка другая
+func respondIdentifierError(ctx *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, errs.ErrInvalidUsername):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "username must be 3-32 characters: latin letters, digits, '.', '_' or '-', starting with a letter"})
+	case errors.Is(err, errs.ErrInvalidEmail):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid email"})
+	case errors.Is(err, errs.ErrInvalidPhone):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "phone must be in international format, e.g. +15551234567"})
+	case errors.Is(err, errs.ErrInvalidIdentifierKind):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "kind must be username, email or phone"})
+	case errors.Is(err, errs.ErrIdentifierTaken):
+		ctx.JSON(http.StatusConflict, gin.H{"error": "this username, email or phone is already taken"})
+	case errors.Is(err, errs.ErrIdentifierRequired):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "username cannot be removed, only changed"})
+	default:
+		return false
+	}
+	return true
+}
+
+// getIdentifiersHandler godoc
+// @Summary Login identifiers
+// @Description Username, email and phone of the authenticated user with their verification status
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.UserIdentifier
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /users/identifiers [get]
+func getIdentifiersHandler(ctx *gin.Context) {
+	const op = "getIdentifiersHandler"
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	identifiers, err := service.GetUserIdentifiers(userID)
+	if err != nil {
+		logger.Error.Printf("%s: service.GetUserIdentifiers: %v", op, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"identifiers": identifiers})
+}
+
+type identifierKindRequest struct {
+	Kind string `uri:"kind" binding:"required"`
+}
+
+type setIdentifierRequest struct {
+	Value string `json:"value" binding:"required"`
+}
+
+// setIdentifierHandler godoc
+// @Summary Set a login identifier
+// @Description Sets or changes the username, email or phone of the authenticated user.
+// @Description A new email or phone has to be verified before it can be used to sign in; setting the same value again keeps its status.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param kind path string true "username, email or phone"
+// @Param identifier body setIdentifierRequest true "New value"
+// @Security BearerAuth
+// @Success 200 {object} models.UserIdentifier
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "Already taken"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /users/identifiers/{kind} [put]
+func setIdentifierHandler(ctx *gin.Context) {
+	const op = "setIdentifierHandler"
+
+	var uri identifierKindRequest
+
+	err := ctx.ShouldBindUri(&uri)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid identifier kind"})
+		return
+	}
+
+	var req setIdentifierRequest
+
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	identifier, err := service.SetUserIdentifier(userID, uri.Kind, req.Value)
+	if err != nil {
+		logger.Error.Printf("%s: service.SetUserIdentifier: %v", op, err)
+		if !respondIdentifierError(ctx, err) {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"identifier": identifier})
+}
+
+// deleteIdentifierHandler godoc
+// @Summary Remove a login identifier
+// @Description Removes the email or phone of the authenticated user. The username cannot be removed.
+// @Tags users
+// @Produce json
+// @Param kind path string true "email or phone"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "Identifier not set"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /users/identifiers/{kind} [delete]
+func deleteIdentifierHandler(ctx *gin.Context) {
+	const op = "deleteIdentifierHandler"
+
+	var uri identifierKindRequest
+
+	err := ctx.ShouldBindUri(&uri)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid identifier kind"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	err = service.DeleteUserIdentifier(userID, uri.Kind)
+	if err != nil {
+		logger.Error.Printf("%s: service.DeleteUserIdentifier: %v", op, err)
+		if respondIdentifierError(ctx, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, errs.ErrNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "identifier is not set"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "identifier removed"})
+}
+
+// sendVerificationCodeHandler godoc
+// @Summary Send a verification code
+// @Description Sends a one-time code to the email or phone of the authenticated user. A new code cancels the previous one.
+// @Tags users
+// @Produce json
+// @Param kind path string true "email or phone"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Code sent, contains expires_at"
+// @Failure 400 {object} map[string]string "Invalid kind or identifier already verified"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "Identifier not set"
+// @Failure 409 {object} map[string]string "Value already verified by another user"
+// @Failure 429 {object} map[string]string "Code was sent recently"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /users/identifiers/{kind}/verification [post]
+func sendVerificationCodeHandler(ctx *gin.Context) {
+	const op = "sendVerificationCodeHandler"
+
+	var uri identifierKindRequest
+
+	err := ctx.ShouldBindUri(&uri)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid identifier kind"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	expiresAt, err := service.SendVerificationCode(userID, uri.Kind)
+	if err != nil {
+		logger.Error.Printf("%s: service.SendVerificationCode: %v", op, err)
+		if respondIdentifierError(ctx, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, errs.ErrIdentifierVerified):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "identifier is already verified"})
+		case errors.Is(err, errs.ErrNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "identifier is not set"})
+		case errors.Is(err, errs.ErrVerificationTooSoon):
+			ctx.JSON(http.StatusTooManyRequests, gin.H{"error": "verification code was sent recently, try again later"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "verification code sent", "expires_at": expiresAt})
+}
+
+type verifyIdentifierRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// verifyIdentifierHandler godoc
+// @Summary Verify an email or phone
+// @Description Confirms the email or phone of the authenticated user with the code sent to it.
+// @Description After too many wrong codes a new code has to be requested.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param kind path string true "email or phone"
+// @Param request body verifyIdentifierRequest true "Verification code"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string "Invalid input, invalid, expired or used up code"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "Value already verified by another user"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /users/identifiers/{kind}/verify [post]
+func verifyIdentifierHandler(ctx *gin.Context) {
+	const op = "verifyIdentifierHandler"
+
+	var uri identifierKindRequest
+
+	err := ctx.ShouldBindUri(&uri)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid identifier kind"})
+		return
+	}
+
+	var req verifyIdentifierRequest
+
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	err = service.ConfirmVerificationCode(userID, uri.Kind, req.Code)
+	if err != nil {
+		logger.Error.Printf("%s: service.ConfirmVerificationCode: %v", op, err)
+		if respondIdentifierError(ctx, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, errs.ErrInvalidVerificationCode):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid verification code"})
+		case errors.Is(err, errs.ErrVerificationCodeExpired):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "verification code is expired or used up, request a new one"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": uri.Kind + " verified"})
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"SB/internal/errs"
+	"SB/internal/service"
+	"SB/logger"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Ответ на заблокированный вход с заголовком Retry-After. Возвращает false, если ошибка другая
+func respondLoginBlocked(ctx *gin.Context, err error) bool {
+	var blocked *errs.LoginBlockedError
+	if !errors.As(err, &blocked) {
+		return false
+	}
+
+	retryAfter := int(math.Ceil(time.Until(blocked.RetryAt).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	ctx.Header("Retry-After", strconv.Itoa(retryAfter))
+
+	message := "too many failed sign-in attempts, try again later"
+	switch {
+	case errors.Is(err, errs.ErrLoginLocked):
+		message = "sign-in is temporarily locked after too many failed attempts"
+	case errors.Is(err, errs.ErrTOTPLocked):
+		message = "one-time codes are temporarily locked after too many wrong codes"
+	}
+	ctx.JSON(http.StatusTooManyRequests, gin.H{"error": message, "retry_after_seconds": retryAfter})
+	return true
+}
+
+// getLoginLocksHandler godoc
+// @Summary Active sign-in locks
+// @Description Users and client IPs that cannot sign in until locked_until because of failed attempts
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.LoginFailure
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/login-locks [get]
+func getLoginLocksHandler(ctx *gin.Context) {
+	const op = "getLoginLocksHandler"
+
+	locks, err := service.GetLoginLocks()
+	if err != nil {
+		logger.Error.Printf("%s: service.GetLoginLocks: %v", op, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"locks": locks})
+}
+
+type unlockLoginRequest struct {
+	UserID int    `json:"user_id" binding:"omitempty,min=1"`
+	IP     string `json:"ip"`
+}
+
+// unlockLoginHandler godoc
+// @Summary Unlock sign-in
+// @Description Removes the sign-in lock and resets failed attempts for a user or a client IP. Pass exactly one of user_id and ip.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param request body unlockLoginRequest true "User ID or IP"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "Unlocked"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 404 {object} map[string]string "No failed attempts recorded"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/login-locks/unlock [post]
+func unlockLoginHandler(ctx *gin.Context) {
+	const op = "unlockLoginHandler"
+
+	var req unlockLoginRequest
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	if (req.UserID == 0) == (req.IP == "") {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "pass either user_id or ip"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	if req.UserID != 0 {
+		err = service.UnlockUserLogin(req.UserID, userID)
+	} else {
+		err = service.UnlockIPLogin(req.IP, userID)
+	}
+	if err != nil {
+		logger.Error.Printf("%s: unlock sign-in: %v", op, err)
+		switch {
+		case errors.Is(err, errs.ErrInvalidIPAddress):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid ip"})
+		case errors.Is(err, errs.ErrNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": "no failed sign-in attempts recorded"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "sign-in unlocked"})
+}
@@ -1,15 +1,19 @@
 package controller
 
 import (
-	"SB/utils"
+	"SB/internal/service"
+	"SB/logger"
 	"github.com/gin-gonic/gin"
 	"net/http"
+	"slices"
 	"strings"
 )
 
 const (
 	authorizationHeader = "Authorization"
 	userIDCtx           = "userID"
+	permissionsCtx      = "permissions"
+	claimsCtx           = "claims"
 )
 
 func checkUserAuthentication(c *gin.Context) {
@@ -39,12 +43,70 @@ func checkUserAuthentication(c *gin.Context) {
 
 	accessToken := headerParts[1]
 
-	claims, err := utils.ParseToken(accessToken)
+	claims, err := service.ParseAccessToken(accessToken)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
+	revoked, err := service.IsTokenRevoked(claims.ID)
+	if err != nil {
+		logger.Error.Printf("checkUserAuthentication: service.IsTokenRevoked: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if revoked {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token has been revoked"})
+		return
+	}
+
 	c.Set(userIDCtx, claims.UserID)
+	c.Set(permissionsCtx, claims.Permissions)
+	c.Set(claimsCtx, claims)
+	c.Next()
+}
+
+// hasPermission проверяет право из токена текущего пользователя
+func hasPermission(c *gin.Context, permission string) bool {
+	permissions, _ := c.Get(permissionsCtx)
+	list, _ := permissions.([]string)
+	return slices.Contains(list, permission)
+}
+
+// requirePermission пропускает запрос только при наличии права, иначе 403
+func requirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasPermission(c, permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "permission denied",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// requireVerifiedContact пропускает операции с деньгами только пользователей с подтверждённой почтой или телефоном.
+// Должен стоять после checkUserAuthentication
+func requireVerifiedContact(c *gin.Context) {
+	userID, ok := c.Get(userIDCtx)
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	verified, err := service.HasVerifiedContacts(userID.(int))
+	if err != nil {
+		logger.Error.Printf("requireVerifiedContact: service.HasVerifiedContacts: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+	if !verified {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error":                 "verify your email or phone before moving money",
+			"verification_required": true,
+		})
+		return
+	}
 	c.Next()
 }
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"SB/internal/errs"
+	"SB/internal/models"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// Параметры страницы из query: limit, cursor, sort и filter[поле]=значение
+func bindPageParams(ctx *gin.Context) (models.PageParams, error) {
+	page := models.PageParams{
+		Cursor:  ctx.Query("cursor"),
+		Sort:    ctx.Query("sort"),
+		Filters: ctx.QueryMap("filter"),
+	}
+
+	if limit := ctx.Query("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value <= 0 {
+			return page, errs.ErrInvalidPageLimit
+		}
+		page.Limit = value
+	}
+	return page, nil
+}
+
+// Ответ на неверные параметры страницы. Возвращает false, если ошибка другая
+func respondPageError(ctx *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, errs.ErrInvalidPageLimit):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+	case errors.Is(err, errs.ErrInvalidCursor):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor, start again from the first page"})
+	case errors.Is(err, errs.ErrInvalidSortField):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "sorting by this field is not supported"})
+	case errors.Is(err, errs.ErrInvalidFilter):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid or unsupported filter"})
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"SB/internal/errs"
+	"SB/internal/service"
+	"SB/logger"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// Ответ на пароль, не прошедший политику. Возвращает false, если ошибка другая
+func respondPasswordError(ctx *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, errs.ErrPasswordTooShort):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "password is too short"})
+	case errors.Is(err, errs.ErrPasswordTooLong) || errors.Is(err, errs.ErrCreateHash):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "password is too long"})
+	case errors.Is(err, errs.ErrPasswordTooWeak):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "password must mix upper and lower case letters, digits and symbols as required"})
+	case errors.Is(err, errs.ErrPasswordBreached):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "password is known from data breaches, choose another one"})
+	case errors.Is(err, errs.ErrPasswordReused):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "password was used recently, choose another one"})
+	default:
+		return false
+	}
+	return true
+}
+
+type passwordResetRequest struct {
+	Login string `json:"login" binding:"required"`
+}
+
+// requestPasswordResetHandler godoc
+// @Summary Request a password reset
+// @Description Sends a password reset token to the verified email, or to the verified phone if there is no email.
+// @Description The response is the same whether the user exists or not.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body passwordResetRequest true "Username, email or phone"
+// @Success 202 {object} map[string]string
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /auth/password-reset [post]
+func requestPasswordResetHandler(ctx *gin.Context) {
+	const op = "requestPasswordResetHandler"
+
+	var req passwordResetRequest
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	err = service.RequestPasswordReset(req.Login)
+	if err != nil {
+		logger.Error.Printf("%s: service.RequestPasswordReset: %v", op, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{"message": "if the account exists, a reset token has been sent to its verified email or phone"})
+}
+
+type confirmPasswordResetRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// confirmPasswordResetHandler godoc
+// @Summary Reset the password
+// @Description Sets a new password with the token from POST /auth/password-reset and ends all sessions of the user.
+// @Description Users with two-factor authentication also send a one-time code in the X-OTP-Code header.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body confirmPasswordResetRequest true "Reset token and new password"
+// @Param X-OTP-Code header string false "TOTP or recovery code"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string "Invalid input, invalid or expired token, password rejected by the policy"
+// @Failure 401 {object} map[string]string "Invalid one-time code"
+// @Failure 403 {object} map[string]interface{} "Second factor required"
+// @Failure 429 {object} map[string]string "One-time codes are temporarily locked"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /auth/password-reset/confirm [post]
+func confirmPasswordResetHandler(ctx *gin.Context) {
+	const op = "confirmPasswordResetHandler"
+
+	var req confirmPasswordResetRequest
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	err = service.ResetPassword(req.Token, req.Password, ctx.GetHeader(otpCodeHeader))
+	if err != nil {
+		logger.Error.Printf("%s: service.ResetPassword: %v", op, err)
+		if respondStepUpError(ctx, err) || respondPasswordError(ctx, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, errs.ErrInvalidResetToken):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired reset token"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "password has been reset, please sign in again"})
+}
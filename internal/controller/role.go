@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"SB/internal/errs"
+	"SB/internal/service"
+	"SB/logger"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+func respondRoleError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errs.ErrNotFound):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "user not found"})
+	case errors.Is(err, errs.ErrInvalidRole):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "unknown role"})
+	case errors.Is(err, errs.ErrRoleNotGranted):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "user does not have this role"})
+	case errors.Is(err, errs.ErrLastAdmin):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot revoke the role from the last admin"})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+	}
+}
+
+// getRolesHandler godoc
+// @Summary List roles
+// @Description Returns all roles with their permissions
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} models.Role
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/roles [get]
+func getRolesHandler(ctx *gin.Context) {
+	const op = "getRolesHandler"
+
+	roles, err := service.GetRoles()
+	if err != nil {
+		logger.Error.Printf("%s: service.GetRoles: %v", op, err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+type userRolesRequest struct {
+	ID int `uri:"id" binding:"required,min=1"`
+}
+
+// getUserRolesHandler godoc
+// @Summary Get user roles
+// @Description Returns the roles granted to a user with who granted them and when
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Security BearerAuth
+// @Success 200 {array} models.UserRole
+// @Failure 400 {object} map[string]string "Invalid ID or user not found"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/users/{id}/roles [get]
+func getUserRolesHandler(ctx *gin.Context) {
+	const op = "getUserRolesHandler"
+
+	var req userRolesRequest
+
+	err := ctx.ShouldBindUri(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	roles, err := service.GetUserRoles(req.ID)
+	if err != nil {
+		logger.Error.Printf("%s: service.GetUserRoles: %v", op, err)
+		respondRoleError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+type grantRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// grantRoleHandler godoc
+// @Summary Grant a role
+// @Description Grants a role to a user. Granting a role the user already has does nothing.
+// @Description The new permissions are included in the user's token at the next sign-in or token refresh.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param role body grantRoleRequest true "Role"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "Role granted"
+// @Failure 400 {object} map[string]string "Invalid input, unknown role or user not found"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/users/{id}/roles [post]
+func grantRoleHandler(ctx *gin.Context) {
+	const op = "grantRoleHandler"
+
+	var uri userRolesRequest
+
+	err := ctx.ShouldBindUri(&uri)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid user ID"})
+		return
+	}
+
+	var req grantRoleRequest
+
+	err = ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	err = service.GrantRole(uri.ID, req.Role, userID)
+	if err != nil {
+		logger.Error.Printf("%s: service.GrantRole: %v", op, err)
+		respondRoleError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "role granted"})
+}
+
+type revokeRoleRequest struct {
+	ID   int    `uri:"id" binding:"required,min=1"`
+	Role string `uri:"role" binding:"required"`
+}
+
+// revokeRoleHandler godoc
+// @Summary Revoke a role
+// @Description Revokes a role from a user. The last admin cannot lose the admin role.
+// @Description Tokens issued before keep their permissions until they expire.
+// @Tags admin
+// @Produce json
+// @Param id path int true "User ID"
+// @Param role path string true "Role"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string "Role revoked"
+// @Failure 400 {object} map[string]string "Invalid input, unknown role, role not granted or last admin"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /admin/users/{id}/roles/{role} [delete]
+func revokeRoleHandler(ctx *gin.Context) {
+	const op = "revokeRoleHandler"
+
+	var req revokeRoleRequest
+
+	err := ctx.ShouldBindUri(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindUri: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	err = service.RevokeRole(req.ID, req.Role, userID)
+	if err != nil {
+		logger.Error.Printf("%s: service.RevokeRole: %v", op, err)
+		respondRoleError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "role revoked"})
+}
@@ -3,6 +3,7 @@ package controller
 import (
 	_ "SB/docs"
 	"SB/internal/configs"
+	"SB/internal/models"
 	"SB/logger"
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -32,15 +33,25 @@ import (
 
 func RunServer() error {
 	router := gin.Default()
+	if err := router.SetTrustedProxies(configs.AppSettings.AppParams.TrustedProxies); err != nil {
+		logger.Error.Printf("[controller] RunServer(): invalid trusted proxies: %s", err.Error())
+		return err
+	}
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	router.GET("/", Ping)
+	router.GET("/.well-known/jwks.json", getJWKSHandler)
 
 	authG := router.Group("/auth")
 	{
 		authG.POST("/sign-up", createUserHandler)
 		authG.POST("/sign-in", authenticateHandler)
+		authG.POST("/sign-in/totp", completeSignInHandler)
+		authG.POST("/refresh", refreshTokenHandler)
+		authG.POST("/password-reset", requestPasswordResetHandler)
+		authG.POST("/password-reset/confirm", confirmPasswordResetHandler)
+		authG.POST("/logout", checkUserAuthentication, logoutHandler)
 	}
 
 	userG := router.Group("/users", checkUserAuthentication)
@@ -48,9 +59,18 @@ func RunServer() error {
 		userG.PATCH("", updateUserHandler)
 		userG.DELETE("/:id", deleteUserHandler)
 		userG.GET("/:id", getUserByIDHandler)
-		userG.GET("/inactive", getInActiveUsersHandler)
-		userG.POST("/restore", restoreUserHandler)
+		userG.GET("/inactive", requirePermission(models.PermUsersRead), getInActiveUsersHandler)
+		userG.POST("/restore", requirePermission(models.PermUsersManage), restoreUserHandler)
 		userG.GET("/find", findUserByNameHandler)
+		userG.GET("/identifiers", getIdentifiersHandler)
+		userG.PUT("/identifiers/:kind", setIdentifierHandler)
+		userG.DELETE("/identifiers/:kind", deleteIdentifierHandler)
+		userG.POST("/identifiers/:kind/verification", sendVerificationCodeHandler)
+		userG.POST("/identifiers/:kind/verify", verifyIdentifierHandler)
+		userG.POST("/totp", enrollTOTPHandler)
+		userG.POST("/totp/confirm", confirmTOTPHandler)
+		userG.DELETE("/totp", disableTOTPHandler)
+		userG.POST("/totp/recovery-codes", regenerateRecoveryCodesHandler)
 	}
 
 	accountG := router.Group("/accounts", checkUserAuthentication)
@@ -60,14 +80,67 @@ func RunServer() error {
 		accountG.DELETE("/:id", deleteAccountHandler)
 		accountG.GET("/:id", getAccountByIDHandler)
 		accountG.GET("/users/:id", getAccountByUserIDHandler)
-		accountG.GET("/inactive", getInActiveAccountsHandler)
+		accountG.GET("/inactive", requirePermission(models.PermAccountsRead), getInActiveAccountsHandler)
 		accountG.GET("/currency", getAccountByCurrency)
 		accountG.GET("/:id/balance", getAccountBalanceHandler)
 	}
 
 	transferG := router.Group("/transfers", checkUserAuthentication)
 	{
-		transferG.POST("", createTransferHandler)
+		transferG.POST("", requireVerifiedContact, idempotencyMiddleware, createTransferHandler)
+	}
+
+	creditG := router.Group("/credits", checkUserAuthentication)
+	{
+		creditG.POST("", requireVerifiedContact, createCreditHandler)
+		creditG.GET("", getMyCreditsHandler)
+		creditG.GET("/:id", getCreditByIDHandler)
+		creditG.GET("/:id/history", getCreditHistoryHandler)
+		creditG.GET("/:id/schedule", getCreditScheduleHandler)
+		creditG.POST("/:id/approve", requirePermission(models.PermCreditsDecide), idempotencyMiddleware, approveCreditHandler)
+		creditG.POST("/:id/reject", requirePermission(models.PermCreditsDecide), rejectCreditHandler)
+		creditG.POST("/:id/repay", requireVerifiedContact, idempotencyMiddleware, repayCreditHandler)
+		creditG.POST("/:id/prepay", requireVerifiedContact, idempotencyMiddleware, prepayCreditHandler)
+		creditG.GET("/:id/payoff", getPayoffQuoteHandler)
+	}
+
+	depositG := router.Group("/deposits", checkUserAuthentication)
+	{
+		depositG.POST("", requireVerifiedContact, idempotencyMiddleware, createDepositHandler)
+		depositG.GET("", getMyDepositsHandler)
+		depositG.GET("/interest", previewDepositInterestHandler)
+		depositG.GET("/:id", getDepositByIDHandler)
+		depositG.POST("/:id/close", requireVerifiedContact, idempotencyMiddleware, closeDepositHandler)
+		depositG.GET("/:id/early-withdrawal", getEarlyWithdrawalQuoteHandler)
+		depositG.PATCH("/:id/maturity-instruction", updateDepositMaturityHandler)
+		depositG.POST("/:id/early-withdrawal", requireVerifiedContact, idempotencyMiddleware, withdrawDepositEarlyHandler)
+	}
+
+	depositProductG := router.Group("/deposit-products", checkUserAuthentication)
+	{
+		depositProductG.GET("", getDepositProductsHandler)
+		depositProductG.GET("/:id", getDepositProductByIDHandler)
+	}
+
+	router.GET("/currencies", checkUserAuthentication, getCurrenciesHandler)
+
+	adminG := router.Group("/admin", checkUserAuthentication)
+	{
+		adminG.GET("/reconciliation", requirePermission(models.PermReportsRead), getReconciliationHandler)
+		adminG.POST("/exchange-rates", requirePermission(models.PermCurrencyManage), createExchangeRateHandler)
+		adminG.POST("/exchange-rates/csv", requirePermission(models.PermCurrencyManage), importExchangeRatesHandler)
+		adminG.GET("/exchange-rates", requirePermission(models.PermReportsRead), getExchangeRateHistoryHandler)
+		adminG.PUT("/currencies/:code", requirePermission(models.PermCurrencyManage), saveCurrencyHandler)
+		adminG.GET("/credits", requirePermission(models.PermCreditsRead), getCreditsByStatusHandler)
+		adminG.GET("/credits/portfolio-at-risk", requirePermission(models.PermReportsRead), getPortfolioAtRiskHandler)
+		adminG.POST("/deposit-products", requirePermission(models.PermProductsManage), createDepositProductHandler)
+		adminG.PUT("/deposit-products/:id", requirePermission(models.PermProductsManage), updateDepositProductHandler)
+		adminG.GET("/roles", requirePermission(models.PermRolesManage), getRolesHandler)
+		adminG.GET("/users/:id/roles", requirePermission(models.PermRolesManage), getUserRolesHandler)
+		adminG.POST("/users/:id/roles", requirePermission(models.PermRolesManage), grantRoleHandler)
+		adminG.DELETE("/users/:id/roles/:role", requirePermission(models.PermRolesManage), revokeRoleHandler)
+		adminG.GET("/login-locks", requirePermission(models.PermUsersRead), getLoginLocksHandler)
+		adminG.POST("/login-locks/unlock", requirePermission(models.PermUsersManage), unlockLoginHandler)
 	}
 
 	if err := router.Run(configs.AppSettings.AppParams.PortRun); err != nil {
@@ -78,14 +151,15 @@ func RunServer() error {
 	return nil
 }
 
+// Ping godoc
+// @Summary Ping the server
+// @Description Check if the server is up and running
+// @Tags general
+// @Accept json
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router / [get]
 func Ping(c *gin.Context) {
-	// @Summary Ping the server
-	// @Description Check if the server is up and running
-	// @Tags general
-	// @Accept json
-	// @Produce json
-	// @Success 200 {object} map[string]string
-	// @Router / [get]
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Server is up and running",
 	})
@@ -0,0 +1,309 @@
+package controller
+
+import (
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/service"
+	"SB/logger"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// Заголовок с кодом второго фактора для операций, которые его требуют
+const otpCodeHeader = "X-OTP-Code"
+
+// Ответ на ошибки второго фактора при подтверждении операции. Возвращает false, если ошибка другая
+func respondStepUpError(ctx *gin.Context, err error) bool {
+	if respondLoginBlocked(ctx, err) {
+		return true
+	}
+	switch {
+	case errors.Is(err, errs.ErrStepUpRequired):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "one-time code required in " + otpCodeHeader + " header", "step_up_required": true})
+	case errors.Is(err, errs.ErrInvalidTOTPCode):
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid one-time code"})
+	default:
+		return false
+	}
+	return true
+}
+
+// Ответ на вход: токены или токен для второго шага
+func respondSignIn(ctx *gin.Context, result *models.SignInResult) {
+	if result.MFARequired {
+		ctx.JSON(http.StatusOK, gin.H{
+			"user":           result.User,
+			"mfa_required":   true,
+			"mfa_token":      result.MFAToken,
+			"mfa_expires_at": result.MFAExpiresAt,
+		})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"user": result.User, "token": result.Tokens.AccessToken, "tokens": result.Tokens})
+}
+
+type completeSignInRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// completeSignInHandler godoc
+// @Summary Finish sign-in with a one-time code
+// @Description Second step of sign-in for users with two-factor authentication.
+// @Description Accepts a code from the authenticator app or an unused recovery code.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body completeSignInRequest true "MFA token from /auth/sign-in and one-time code"
+// @Success 200 {object} map[string]interface{} "Contains user, access token and token pair"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Invalid code, or expired or exhausted MFA token"
+// @Failure 429 {object} map[string]string "Sign-in or one-time codes are temporarily locked"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /auth/sign-in/totp [post]
+func completeSignInHandler(ctx *gin.Context) {
+	const op = "completeSignInHandler"
+
+	var req completeSignInRequest
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	result, err := service.CompleteMFASignIn(req.MFAToken, req.Code, ctx.ClientIP())
+	if err != nil {
+		logger.Error.Printf("%s: service.CompleteMFASignIn: %v", op, err)
+		if respondLoginBlocked(ctx, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, errs.ErrInvalidMFAToken) || errors.Is(err, errs.ErrTOTPNotEnabled):
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "sign-in session expired, please sign in again"})
+		case errors.Is(err, errs.ErrInvalidTOTPCode):
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid one-time code"})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		}
+		return
+	}
+
+	respondSignIn(ctx, result)
+}
+
+type totpCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// Ответ на ошибки управления вторым фактором
+func respondTOTPError(ctx *gin.Context, err error) {
+	if respondLoginBlocked(ctx, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, errs.ErrTOTPNotEnabled):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "two-factor authentication is not enabled"})
+	case errors.Is(err, errs.ErrTOTPAlreadyEnabled):
+		ctx.JSON(http.StatusConflict, gin.H{"error": "two-factor authentication is already enabled"})
+	case errors.Is(err, errs.ErrInvalidTOTPCode):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "invalid one-time code"})
+	case errors.Is(err, errs.ErrNotFound):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "user not found"})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+	}
+}
+
+// enrollTOTPHandler godoc
+// @Summary Start two-factor authentication setup
+// @Description Generates a TOTP secret and an otpauth:// URI for the authenticator app.
+// @Description Two-factor authentication is enabled only after POST /users/totp/confirm.
+// @Tags users
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} models.TOTPEnrollment
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "Already enabled"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /users/totp [post]
+func enrollTOTPHandler(ctx *gin.Context) {
+	const op = "enrollTOTPHandler"
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	enrollment, err := service.StartTOTPEnrollment(userID)
+	if err != nil {
+		logger.Error.Printf("%s: service.StartTOTPEnrollment: %v", op, err)
+		respondTOTPError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"totp": enrollment})
+}
+
+// confirmTOTPHandler godoc
+// @Summary Confirm two-factor authentication setup
+// @Description Enables two-factor authentication with the first code from the authenticator app.
+// @Description Returns one-time recovery codes; they are shown only once.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body totpCodeRequest true "Code from the authenticator app"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Recovery codes"
+// @Failure 400 {object} map[string]string "Invalid input, invalid code or setup not started"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "Already enabled"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /users/totp/confirm [post]
+func confirmTOTPHandler(ctx *gin.Context) {
+	const op = "confirmTOTPHandler"
+
+	var req totpCodeRequest
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	codes, err := service.ConfirmTOTPEnrollment(userID, req.Code)
+	if err != nil {
+		logger.Error.Printf("%s: service.ConfirmTOTPEnrollment: %v", op, err)
+		respondTOTPError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// disableTOTPHandler godoc
+// @Summary Disable two-factor authentication
+// @Description Disables two-factor authentication; requires a current code or a recovery code.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body totpCodeRequest true "Code from the authenticator app or recovery code"
+// @Security BearerAuth
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string "Invalid input, invalid code or not enabled"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 429 {object} map[string]string "One-time codes are temporarily locked"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /users/totp [delete]
+func disableTOTPHandler(ctx *gin.Context) {
+	const op = "disableTOTPHandler"
+
+	var req totpCodeRequest
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	err = service.DisableTOTP(userID, req.Code)
+	if err != nil {
+		logger.Error.Printf("%s: service.DisableTOTP: %v", op, err)
+		respondTOTPError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "two-factor authentication disabled"})
+}
+
+// regenerateRecoveryCodesHandler godoc
+// @Summary Regenerate recovery codes
+// @Description Replaces all recovery codes with new ones; requires a current code or a recovery code.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param request body totpCodeRequest true "Code from the authenticator app or recovery code"
+// @Security BearerAuth
+// @Success 200 {object} map[string]interface{} "Recovery codes"
+// @Failure 400 {object} map[string]string "Invalid input, invalid code or not enabled"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 429 {object} map[string]string "One-time codes are temporarily locked"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /users/totp/recovery-codes [post]
+func regenerateRecoveryCodesHandler(ctx *gin.Context) {
+	const op = "regenerateRecoveryCodesHandler"
+
+	var req totpCodeRequest
+
+	err := ctx.ShouldBindJSON(&req)
+	if err != nil {
+		logger.Error.Printf("%s: ctx.ShouldBindJSON: %v", op, err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to read sent data"})
+		return
+	}
+
+	userIDAny, ok := ctx.Get(userIDCtx)
+	if !ok {
+		logger.Error.Printf("%s: userID absent in Context", op)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
+		return
+	}
+
+	userID, ok := userIDAny.(int)
+	if !ok {
+		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+		return
+	}
+
+	codes, err := service.RegenerateRecoveryCodes(userID, req.Code)
+	if err != nil {
+		logger.Error.Printf("%s: service.RegenerateRecoveryCodes: %v", op, err)
+		respondTOTPError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
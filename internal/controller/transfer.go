@@ -11,23 +11,31 @@ import (
 )
 
 type createTransferRequest struct {
-	FromAccountID int    `json:"from_account_id" binding:"required,min=1"`
-	ToAccountID   int    `json:"to_account_id" binding:"required,min=1"`
-	Amount        int    `json:"amount" binding:"required"`
-	Currency      string `json:"currency" binding:"required"`
+	FromAccountID int          `json:"from_account_id" binding:"required,min=1"`
+	ToAccountID   int          `json:"to_account_id" binding:"required,min=1"`
+	Amount        models.Money `json:"amount" binding:"required"`
+	Currency      string       `json:"currency" binding:"required"`
 }
 
 // createTransferHandler godoc
 // @Summary Create a new transfer
-// @Description Creates a transfer between two accounts for the authenticated user with the specified amount and currency
+// @Description Creates a transfer between two accounts for the authenticated user with the specified amount and currency.
+// @Description If the receiver's account has another currency, the amount is converted at the current exchange rate.
+// @Description Transfers above the configured threshold require a one-time code in the X-OTP-Code header when two-factor authentication is enabled.
 // @Tags transfers
 // @Accept json
 // @Produce json
 // @Param transfer body createTransferRequest true "Transfer data"
+// @Param Idempotency-Key header string false "Key to safely retry the request"
+// @Param X-OTP-Code header string false "TOTP or recovery code"
 // @Security BearerAuth
 // @Success 201 {object} models.Transfer
-// @Failure 400 {object} map[string]string "Invalid input, invalid user ID, mismatched currencies, or insufficient balance"
+// @Failure 400 {object} map[string]string "Invalid input, invalid user ID, unknown exchange rate, or insufficient balance"
 // @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Second factor required or email or phone not verified"
+// @Failure 409 {object} map[string]string "Request with the same idempotency key is in progress"
+// @Failure 422 {object} map[string]string "Idempotency key reused with a different request"
+// @Failure 429 {object} map[string]string "One-time codes are temporarily locked"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /transfers [post]
 func createTransferHandler(ctx *gin.Context) {
@@ -63,15 +71,24 @@ func createTransferHandler(ctx *gin.Context) {
 		Currency:      req.Currency,
 	}
 
-	result, err := service.CreateTransfer(trnx, userID)
+	result, err := service.CreateTransfer(trnx, userID, ctx.GetHeader(otpCodeHeader))
 	if err != nil {
 		logger.Error.Printf("%s: service.CreateTransferr: %v", op, err)
+		if respondStepUpError(ctx, err) {
+			return
+		}
 		switch {
 		case errors.Is(err, errs.ErrNotFound):
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "enter valid user_id"})
 		case errors.Is(err, errs.ErrInvalidCurrency):
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "currencies must match"})
-		case errors.Is(err, errs.ErrInsufficientBalance):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "currency must match sender's account currency"})
+		case errors.Is(err, errs.ErrExchangeRateNotFound):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "no exchange rate for these currencies"})
+		case errors.Is(err, errs.ErrInvalidAmount):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "amount is too small"})
+		case errors.Is(err, errs.ErrFraud):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot transfer from others account"})
+		case errors.Is(err, errs.ErrInsufficientBalance) || errors.Is(err, errs.ErrInsufficientFunds):
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "insufficient balance"})
 		default:
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
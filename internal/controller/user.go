@@ -12,18 +12,23 @@ import (
 
 type createUserRequest struct {
 	FullName string `json:"full_name"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Phone    string `json:"phone"`
 	Password string `json:"password"`
 }
 
 // createUserHandler godoc
 // @Summary Create a new user
-// @Description Creates a new user with the provided full name and password
+// @Description Creates a new user with the provided full name, username and password.
+// @Description Email and phone (E.164, e.g. +15551234567) are optional and can be used to sign in once verified.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param user body createUserRequest true "User data"
 // @Success 201 {object} models.User
-// @Failure 400 {object} map[string]string "Invalid input or user already exists"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 409 {object} map[string]string "Username, email or phone already taken"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /auth/sign-up [post]
 func createUserHandler(ctx *gin.Context) {
@@ -43,36 +48,40 @@ func createUserHandler(ctx *gin.Context) {
 		Password: req.Password,
 	}
 
-	err = service.CreateUser(user)
+	identifiers, err := service.CreateUser(user, req.Username, req.Email, req.Phone)
 	if err != nil {
 		logger.Error.Printf("%s: service.CreateUser: %v", op, err)
+		if respondIdentifierError(ctx, err) || respondPasswordError(ctx, err) {
+			return
+		}
 		switch {
-		case errors.Is(err, errs.ErrInvalidFullName) || errors.Is(err, errs.ErrPasswordTooShort):
+		case errors.Is(err, errs.ErrInvalidFullName):
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "check sent data for requirements"})
-		case errors.Is(err, errs.ErrUserAlreadyExists):
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "user with such credentials already exits"})
-		case errors.Is(err, errs.ErrCreateHash):
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "password too long"})
 		default:
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		}
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, gin.H{"user": user})
+	ctx.JSON(http.StatusCreated, gin.H{"user": user, "identifiers": identifiers})
 }
 
 // updateUserHandler godoc
 // @Summary Update a user
 // @Description Updates user information based on the provided ID and optional fields
+// @Description Changing the password requires current_password, and a one-time code in the X-OTP-Code header when two-factor authentication is enabled.
+// @Description A password change ends all other sessions: their refresh tokens are revoked.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param user body models.UpdateUser true "Updated user data"
+// @Param X-OTP-Code header string false "TOTP or recovery code"
 // @Security BearerAuth
 // @Success 202 {object} map[string]string
 // @Failure 400 {object} map[string]string "Invalid input or user not found"
 // @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]interface{} "Second factor required or current password is incorrect"
+// @Failure 429 {object} map[string]string "Too many wrong passwords or one-time codes, see Retry-After"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /users [patch]
 func updateUserHandler(ctx *gin.Context) {
@@ -106,16 +115,19 @@ func updateUserHandler(ctx *gin.Context) {
 		return
 	}
 
-	err = service.UpdateUser(&req)
+	err = service.UpdateUser(&req, ctx.GetHeader(otpCodeHeader), ctx.ClientIP())
 	if err != nil {
 		logger.Error.Printf("%s: service.UpdateUser: %v", op, err)
+		if respondStepUpError(ctx, err) || respondPasswordError(ctx, err) {
+			return
+		}
 		switch {
-		case errors.Is(err, errs.ErrInvalidFullName) || errors.Is(err, errs.ErrPasswordTooShort):
+		case errors.Is(err, errs.ErrInvalidFullName):
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "check sent data for requirements"})
+		case errors.Is(err, errs.ErrInvalidPassword):
+			ctx.JSON(http.StatusForbidden, gin.H{"error": "current password is incorrect"})
 		case errors.Is(err, errs.ErrNotFound):
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "user not found for update"})
-		case errors.Is(err, errs.ErrCreateHash):
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "new password is too long"})
 		default:
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		}
@@ -131,14 +143,14 @@ type deleteUserRequest struct {
 
 // deleteUserHandler godoc
 // @Summary Delete a user
-// @Description Deletes a user by ID
+// @Description Deletes a user by ID. The last admin cannot be deleted.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param id path int true "User ID"
 // @Security BearerAuth
 // @Success 202 {object} map[string]string
-// @Failure 400 {object} map[string]string "Invalid ID or user has dependencies"
+// @Failure 400 {object} map[string]string "Invalid ID, user has dependencies or is the last admin"
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /users/{id} [delete]
@@ -168,7 +180,7 @@ func deleteUserHandler(ctx *gin.Context) {
 		return
 	}
 
-	if userID != req.ID && userID != service.AdminID {
+	if userID != req.ID && !hasPermission(ctx, models.PermUsersManage) {
 		logger.Error.Printf("%s: someone is trying to change others data, userID token: %d userID request: %d", op, userID, req.ID)
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
 		return
@@ -184,6 +196,8 @@ func deleteUserHandler(ctx *gin.Context) {
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "user should pay for credits first"})
 		case errors.Is(err, errs.ErrDepositsExists):
 			ctx.JSON(http.StatusBadRequest, gin.H{"error": "delete deposit first"})
+		case errors.Is(err, errs.ErrLastAdmin):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "cannot delete the last admin"})
 		default:
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		}
@@ -238,63 +252,62 @@ func getUserByIDHandler(ctx *gin.Context) {
 
 // getInActiveUsersHandler godoc
 // @Summary Get inactive users
-// @Description Retrieves a list of inactive users
+// @Description Retrieves a page of inactive users
 // @Tags users
 // @Accept json
 // @Produce json
+// @Param limit query int false "Page size, default and maximum come from pagination_params"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param sort query string false "Sort field, prefix with - for descending order" Enums(id, -id, created_at, -created_at, full_name, -full_name)
 // @Security BearerAuth
-// @Success 200 {array} models.User
-// @Failure 400 {object} map[string]string "Invalid input or unauthorized"
+// @Success 200 {object} models.Page[models.User]
+// @Failure 400 {object} map[string]string "Invalid page parameters"
 // @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /users/inactive [get]
 func getInActiveUsersHandler(ctx *gin.Context) {
 	const op = "getInActiveUsersHandler"
 
-	userIDAny, ok := ctx.Get(userIDCtx)
-	if !ok {
-		logger.Error.Printf("%s: userID absent in Context", op)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
-		return
-	}
-
-	userID, ok := userIDAny.(int)
-	if !ok {
-		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
-		return
-	}
-
-	if userID != service.AdminID {
-		logger.Error.Printf("%s: someone is trying to get others data, userID token: %d", op, userID)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
+	page, err := bindPageParams(ctx)
+	if err != nil {
+		logger.Error.Printf("%s: bindPageParams: %v", op, err)
+		respondPageError(ctx, err)
 		return
 	}
 
-	users, err := service.GetInactiveUsers()
+	users, err := service.GetInactiveUsers(page)
 	if err != nil {
 		logger.Error.Printf("%s: service.GetInactiveUsers: %v", op, err)
+		if respondPageError(ctx, err) {
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"users": users})
+	ctx.JSON(http.StatusOK, users)
 }
 
 type authenticateRequest struct {
-	FullName string `json:"full_name" binding:"required"`
+	Login    string `json:"login" binding:"required"`
 	Password string `json:"password" binding:"required"`
 }
 
 // authenticateHandler godoc
 // @Summary Authenticate a user
-// @Description Authenticates a user with full name and password, returns a token
+// @Description Authenticates a user with a verified username, email or phone and password and starts a session.
+// @Description Returns a short-lived access token and a refresh token for POST /auth/refresh.
+// @Description If two-factor authentication is enabled, returns mfa_token instead; finish the sign-in with POST /auth/sign-in/totp.
+// @Description Repeated failures slow down further attempts and then lock sign-in for the user and the client IP for a while.
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param credentials body authenticateRequest true "User credentials"
-// @Success 200 {object} map[string]interface{} "Contains user and token"
-// @Failure 400 {object} map[string]string "Invalid credentials"
+// @Success 200 {object} map[string]interface{} "Contains user, access token and token pair, or an MFA challenge"
+// @Failure 400 {object} map[string]string "Invalid input"
+// @Failure 401 {object} map[string]string "Invalid login or password"
+// @Failure 429 {object} map[string]interface{} "Too many failed attempts, see Retry-After"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /auth/sign-in [post]
 func authenticateHandler(ctx *gin.Context) {
@@ -309,39 +322,40 @@ func authenticateHandler(ctx *gin.Context) {
 		return
 	}
 
-	token, user, err := service.AuthenticateUser(req.FullName, req.Password)
+	result, err := service.AuthenticateUser(req.Login, req.Password, ctx.ClientIP())
 	if err != nil {
 		logger.Error.Printf("%s: service.AuthenticateUser: %v", op, err)
+		if respondLoginBlocked(ctx, err) {
+			return
+		}
 		switch {
-		case errors.Is(err, errs.ErrNotFound):
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "user not found"})
-		case errors.Is(err, errs.ErrInvalidPassword):
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "incorrect password was entered"})
+		case errors.Is(err, errs.ErrInvalidCredentials):
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "invalid login or password"})
 		default:
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		}
 		return
-
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"user": user, "token": token})
+	respondSignIn(ctx, result)
 }
 
 type restoreUserRequest struct {
-	FullName string `json:"full_name" binding:"required"`
+	ID int `json:"id" binding:"required,min=1"`
 }
 
 // restoreUserHandler godoc
 // @Summary Restore a deleted user
-// @Description Restores a user by their full name
+// @Description Restores a deleted user by ID
 // @Tags users
 // @Accept json
 // @Produce json
-// @Param user body restoreUserRequest true "User full name"
+// @Param user body restoreUserRequest true "User ID"
 // @Security BearerAuth
 // @Success 200 {object} map[string]string
 // @Failure 400 {object} map[string]string "Invalid input or user not found"
 // @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Permission denied"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /users/restore [post]
 func restoreUserHandler(ctx *gin.Context) {
@@ -356,27 +370,7 @@ func restoreUserHandler(ctx *gin.Context) {
 		return
 	}
 
-	userIDAny, ok := ctx.Get(userIDCtx)
-	if !ok {
-		logger.Error.Printf("%s: userID absent in Context", op)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to parse userID"})
-		return
-	}
-
-	userID, ok := userIDAny.(int)
-	if !ok {
-		logger.Error.Printf("%s: userID conversion error: %v", op, userIDAny)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
-		return
-	}
-
-	if userID != service.AdminID {
-		logger.Error.Printf("%s: someone is trying to restore others data, userID token: %d", op, userID)
-		ctx.JSON(http.StatusBadRequest, gin.H{"error": "failed to convert userID to int"})
-		return
-	}
-
-	err = service.RestoreUser(req.FullName)
+	err = service.RestoreUser(req.ID)
 	if err != nil {
 		logger.Error.Printf("%s: service.RestoreUser: %v", op, err)
 		switch {
@@ -397,14 +391,17 @@ type findUserByNameRequest struct {
 
 // findUserByNameHandler godoc
 // @Summary Find users by name
-// @Description Retrieves users matching the provided full name
+// @Description Retrieves a page of users matching the provided full name
 // @Tags users
 // @Accept json
 // @Produce json
 // @Param user body findUserByNameRequest true "User full name"
+// @Param limit query int false "Page size, default and maximum come from pagination_params"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param sort query string false "Sort field, prefix with - for descending order" Enums(id, -id, created_at, -created_at, full_name, -full_name)
 // @Security BearerAuth
-// @Success 200 {array} models.User
-// @Failure 400 {object} map[string]string "Invalid input or user not found"
+// @Success 200 {object} models.Page[models.User]
+// @Failure 400 {object} map[string]string "Invalid input, invalid name or invalid page parameters"
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /users/find [get]
@@ -420,17 +417,27 @@ func findUserByNameHandler(ctx *gin.Context) {
 		return
 	}
 
-	users, err := service.FindUserByName(req.FullName)
+	page, err := bindPageParams(ctx)
+	if err != nil {
+		logger.Error.Printf("%s: bindPageParams: %v", op, err)
+		respondPageError(ctx, err)
+		return
+	}
+
+	users, err := service.FindUserByName(req.FullName, page)
 	if err != nil {
 		logger.Error.Printf("%s: service.FindUserByName: %v", op, err)
+		if respondPageError(ctx, err) {
+			return
+		}
 		switch {
-		case errors.Is(err, errs.ErrNotFound):
-			ctx.JSON(http.StatusBadRequest, gin.H{"error": "user not found"})
+		case errors.Is(err, errs.ErrInvalidFullName):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "name must be from 3 to 50 characters"})
 		default:
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
 		}
 		return
 	}
 
-	ctx.JSON(http.StatusOK, gin.H{"users": users})
+	ctx.JSON(http.StatusOK, users)
 }
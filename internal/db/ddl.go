@@ -1,6 +1,9 @@
 package db
 
-import "SB/logger"
+import (
+	"SB/internal/configs"
+	"SB/logger"
+)
 
 func InitMigrations() error {
 	usersTableQuery := `
@@ -26,6 +29,7 @@ func InitMigrations() error {
 	phone_number VARCHAR NOT NULL,
 	balance BIGINT NOT NULL DEFAULT 0,
 	currency VARCHAR(3) NOT NULL,
+	purpose VARCHAR NOT NULL DEFAULT 'current',
 	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 	updated_at TIMESTAMP,
 	deleted_at TIMESTAMP,
@@ -38,6 +42,16 @@ func InitMigrations() error {
 		return err
 	}
 
+	accountsAlterQuery := `
+		ALTER TABLE accounts ADD COLUMN IF NOT EXISTS purpose VARCHAR NOT NULL DEFAULT 'current';
+		CREATE INDEX IF NOT EXISTS accounts_user_id_idx ON accounts(user_id);`
+
+	_, err = db.Exec(accountsAlterQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during alter accounts table: %v", err.Error())
+		return err
+	}
+
 	transactionsTableQuery := `
 		CREATE TABLE IF NOT EXISTS transactions (
 	id SERIAL PRIMARY KEY,
@@ -45,6 +59,9 @@ func InitMigrations() error {
 	to_account_id INT REFERENCES accounts(id),
 	amount BIGINT NOT NULL CHECK (amount > 0),
 	currency char(3) not null, 
+	to_amount BIGINT,
+	to_currency char(3),
+	exchange_rate NUMERIC(18,8) NOT NULL DEFAULT 1,
 	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );`
 
@@ -54,6 +71,21 @@ func InitMigrations() error {
 		return err
 	}
 
+	// Переводы между валютами: сумма зачисления, валюта получателя и применённый курс
+	transactionsAlterQuery := `
+		ALTER TABLE transactions
+		    ADD COLUMN IF NOT EXISTS to_amount BIGINT,
+		    ADD COLUMN IF NOT EXISTS to_currency char(3),
+		    ADD COLUMN IF NOT EXISTS exchange_rate NUMERIC(18,8) NOT NULL DEFAULT 1;
+		UPDATE transactions SET to_amount = amount, to_currency = currency
+		WHERE to_amount IS NULL;`
+
+	_, err = db.Exec(transactionsAlterQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during alter transactions table: %v", err.Error())
+		return err
+	}
+
 	creditsTableQuery := `
 		CREATE TABLE IF NOT EXISTS credits (
 	id SERIAL PRIMARY KEY,
@@ -72,6 +104,83 @@ func InitMigrations() error {
 		logger.Error.Printf("[db] InitMigrations(): error during create credits table: %v", err.Error())
 		return err
 	}
+
+	// Жизненный цикл кредита: заявка -> решение -> выдача -> погашение
+	creditsAlterQuery := `
+		ALTER TABLE credits
+		    ADD COLUMN IF NOT EXISTS account_id INT REFERENCES accounts(id),
+		    ADD COLUMN IF NOT EXISTS outstanding BIGINT NOT NULL DEFAULT 0 CHECK (outstanding >= 0),
+		    ADD COLUMN IF NOT EXISTS status VARCHAR NOT NULL DEFAULT 'pending',
+		    ADD COLUMN IF NOT EXISTS rejection_reason TEXT,
+		    ADD COLUMN IF NOT EXISTS decided_by INT REFERENCES users(id),
+		    ADD COLUMN IF NOT EXISTS disbursed_at TIMESTAMP,
+		    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+		CREATE INDEX IF NOT EXISTS credits_user_id_idx ON credits(user_id);
+		CREATE INDEX IF NOT EXISTS credits_status_idx ON credits(status);`
+
+	_, err = db.Exec(creditsAlterQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during alter credits table: %v", err.Error())
+		return err
+	}
+
+	creditStatusHistoryQuery := `
+		CREATE TABLE IF NOT EXISTS credit_status_history (
+	id SERIAL PRIMARY KEY,
+	credit_id INT NOT NULL REFERENCES credits(id) ON DELETE CASCADE,
+	from_status VARCHAR,
+	to_status VARCHAR NOT NULL,
+	reason TEXT,
+	changed_by INT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);`
+
+	_, err = db.Exec(creditStatusHistoryQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during create credit_status_history table: %v", err.Error())
+		return err
+	}
+
+	creditInstallmentsQuery := `
+		CREATE TABLE IF NOT EXISTS credit_installments (
+	id SERIAL PRIMARY KEY,
+	credit_id INT NOT NULL REFERENCES credits(id) ON DELETE CASCADE,
+	number INT NOT NULL,
+	due_date DATE NOT NULL,
+	payment BIGINT NOT NULL,
+	principal BIGINT NOT NULL,
+	interest BIGINT NOT NULL,
+	principal_paid BIGINT NOT NULL DEFAULT 0,
+	interest_paid BIGINT NOT NULL DEFAULT 0,
+	balance BIGINT NOT NULL,
+	status VARCHAR NOT NULL DEFAULT 'pending',
+	paid_at TIMESTAMP,
+	UNIQUE (credit_id, number)
+);`
+
+	_, err = db.Exec(creditInstallmentsQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during create credit_installments table: %v", err.Error())
+		return err
+	}
+
+	// Просрочка: неустойка по платежам и корзина просрочки кредита
+	delinquencyAlterQuery := `
+		ALTER TABLE credit_installments
+		    ADD COLUMN IF NOT EXISTS penalty BIGINT NOT NULL DEFAULT 0,
+		    ADD COLUMN IF NOT EXISTS penalty_paid BIGINT NOT NULL DEFAULT 0,
+		    ADD COLUMN IF NOT EXISTS penalty_accrued_on DATE;
+		ALTER TABLE credits
+		    ADD COLUMN IF NOT EXISTS days_past_due INT NOT NULL DEFAULT 0,
+		    ADD COLUMN IF NOT EXISTS delinquency_bucket VARCHAR NOT NULL DEFAULT 'current';
+		CREATE INDEX IF NOT EXISTS credit_installments_open_idx ON credit_installments(due_date) WHERE status <> 'paid';`
+
+	_, err = db.Exec(delinquencyAlterQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during alter tables for delinquency: %v", err.Error())
+		return err
+	}
+
 	depositsTableQuery := `
 		CREATE TABLE IF NOT EXISTS deposits (
 	id SERIAL PRIMARY KEY,
@@ -106,12 +215,39 @@ func InitMigrations() error {
 		return err
 	}
 
+	// Журнала ещё нет - значит, балансы счетов до сих пор менялись без проводок
+	var ledgerExisted bool
+	err = db.Get(&ledgerExisted, `SELECT to_regclass('ledger_journals') IS NOT NULL`)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during check ledger_journals table: %v", err.Error())
+		return err
+	}
+
+	ledgerJournalsQuery := `
+		CREATE TABLE IF NOT EXISTS ledger_journals (
+		    id bigserial primary key,
+		    operation varchar not null,
+		    reference_id int,
+		    created_at timestamp default current_timestamp
+		)`
+
+	_, err = db.Exec(ledgerJournalsQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during create ledger_journals table: %v", err.Error())
+		return err
+	}
+
 	entryQuery := `
 		CREATE TABLE IF NOT EXISTS entries (
 		    id bigserial primary key, 
-		    account_id bigint not null,
+		    journal_id bigint references ledger_journals(id),
+		    account_id bigint,
+		    system_account varchar,
 		    amount bigint not null,
-		    created_at timestamp default current_timestamp
+		    currency char(3),
+		    exchange_rate numeric(18,8),
+		    created_at timestamp default current_timestamp,
+		    CHECK ((account_id IS NULL) <> (system_account IS NULL))
 		)`
 
 	_, err = db.Exec(entryQuery)
@@ -120,5 +256,489 @@ func InitMigrations() error {
 		return err
 	}
 
+	// Для баз, созданных до появления журнала проводок
+	entryAlterQuery := `
+		ALTER TABLE entries
+		    ADD COLUMN IF NOT EXISTS journal_id bigint references ledger_journals(id),
+		    ADD COLUMN IF NOT EXISTS system_account varchar,
+		    ADD COLUMN IF NOT EXISTS currency char(3),
+		    ADD COLUMN IF NOT EXISTS exchange_rate NUMERIC(18,8),
+		    ALTER COLUMN account_id DROP NOT NULL;
+		CREATE INDEX IF NOT EXISTS entries_account_id_idx ON entries(account_id);
+		CREATE INDEX IF NOT EXISTS entries_journal_id_idx ON entries(journal_id);
+		UPDATE entries e SET currency = a.currency
+		FROM accounts a
+		WHERE e.account_id = a.id AND e.currency IS NULL;`
+
+	_, err = db.Exec(entryAlterQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during alter entries table: %v", err.Error())
+		return err
+	}
+
+	// Один раз при появлении журнала: разница между балансом счёта и его прежними записями
+	// проводится как входящий остаток против кассы банка, иначе сверка покажет расхождение по каждому счёту
+	if !ledgerExisted {
+		openingBalancesQuery := `
+		WITH diffs AS (
+			SELECT a.id, a.currency,
+			       a.balance - COALESCE((SELECT SUM(e.amount) FROM entries e WHERE e.account_id = a.id), 0) AS amount
+			FROM accounts a
+		), journals AS (
+			INSERT INTO ledger_journals (operation, reference_id)
+			SELECT 'opening_balance', id FROM diffs WHERE amount <> 0
+			RETURNING id, reference_id
+		)
+		INSERT INTO entries (journal_id, account_id, system_account, amount, currency)
+		SELECT j.id, d.id, NULL, d.amount, d.currency FROM journals j JOIN diffs d ON d.id = j.reference_id
+		UNION ALL
+		SELECT j.id, NULL, 'bank_cash', -d.amount, d.currency FROM journals j JOIN diffs d ON d.id = j.reference_id;`
+
+		_, err = db.Exec(openingBalancesQuery)
+		if err != nil {
+			logger.Error.Printf("[db] InitMigrations(): error during post opening balances: %v", err.Error())
+			return err
+		}
+	}
+
+	idempotencyKeysQuery := `
+		CREATE TABLE IF NOT EXISTS idempotency_keys (
+	id SERIAL PRIMARY KEY,
+	idempotency_key VARCHAR(255) NOT NULL,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	method VARCHAR(10) NOT NULL,
+	path VARCHAR NOT NULL,
+	fingerprint VARCHAR(64) NOT NULL,
+	status_code INT,
+	response_body BYTEA,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	UNIQUE (user_id, idempotency_key)
+);`
+	_, err = db.Exec(idempotencyKeysQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during create idempotency_keys table: %v", err.Error())
+		return err
+	}
+
+	exchangeRatesQuery := `
+		CREATE TABLE IF NOT EXISTS exchange_rates (
+	id SERIAL PRIMARY KEY,
+	base_currency VARCHAR(3) NOT NULL,
+	quote_currency VARCHAR(3) NOT NULL,
+	rate NUMERIC(18,8) NOT NULL CHECK (rate > 0),
+	effective_at TIMESTAMP NOT NULL,
+	created_by INT REFERENCES users(id),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (base_currency, quote_currency, effective_at)
+);`
+	_, err = db.Exec(exchangeRatesQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during create exchange_rates table: %v", err.Error())
+		return err
+	}
+
+	currenciesQuery := `
+		CREATE TABLE IF NOT EXISTS currencies (
+	code VARCHAR(3) PRIMARY KEY,
+	numeric_code VARCHAR(3) NOT NULL UNIQUE,
+	name VARCHAR NOT NULL DEFAULT '',
+	minor_units INT NOT NULL CHECK (minor_units >= 0),
+	enabled BOOLEAN NOT NULL DEFAULT TRUE
+);
+		INSERT INTO currencies (code, numeric_code, name, minor_units) VALUES
+	('USD', '840', 'US Dollar', 2),
+	('EUR', '978', 'Euro', 2),
+	('RUB', '643', 'Russian Ruble', 2)
+		ON CONFLICT (code) DO NOTHING;`
+	_, err = db.Exec(currenciesQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during create currencies table: %v", err.Error())
+		return err
+	}
+
+	depositProductsQuery := `
+		CREATE TABLE IF NOT EXISTS deposit_products (
+	id SERIAL PRIMARY KEY,
+	name VARCHAR NOT NULL UNIQUE,
+	currency VARCHAR(3) NOT NULL REFERENCES currencies(code),
+	min_amount BIGINT NOT NULL CHECK (min_amount > 0),
+	max_amount BIGINT NOT NULL,
+	allowed_terms INT[] NOT NULL,
+	early_withdrawal VARCHAR NOT NULL DEFAULT 'not_allowed',
+	early_withdrawal_rate NUMERIC(7,4) NOT NULL DEFAULT 0,
+	compounding VARCHAR NOT NULL DEFAULT 'none',
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP,
+	CHECK (max_amount >= min_amount)
+);
+
+		CREATE TABLE IF NOT EXISTS deposit_product_rates (
+	id SERIAL PRIMARY KEY,
+	product_id INT NOT NULL REFERENCES deposit_products(id) ON DELETE CASCADE,
+	term_months INT NOT NULL,
+	min_amount BIGINT NOT NULL DEFAULT 0,
+	rate NUMERIC(5,2) NOT NULL CHECK (rate >= 0),
+	UNIQUE (product_id, term_months, min_amount)
+);
+
+		ALTER TABLE deposits ADD COLUMN IF NOT EXISTS product_id INT REFERENCES deposit_products(id);`
+
+	_, err = db.Exec(depositProductsQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during create deposit_products table: %v", err.Error())
+		return err
+	}
+
+	depositAccrualQuery := `
+		ALTER TABLE deposit_products ADD COLUMN IF NOT EXISTS day_count VARCHAR NOT NULL DEFAULT 'act_365';
+		ALTER TABLE deposits
+		    ADD COLUMN IF NOT EXISTS compounding VARCHAR NOT NULL DEFAULT 'none',
+		    ADD COLUMN IF NOT EXISTS day_count VARCHAR NOT NULL DEFAULT 'act_365',
+		    ADD COLUMN IF NOT EXISTS payout_account_id INT REFERENCES accounts(id),
+		    ADD COLUMN IF NOT EXISTS capitalized_interest BIGINT NOT NULL DEFAULT 0,
+		    ADD COLUMN IF NOT EXISTS paid_interest BIGINT NOT NULL DEFAULT 0,
+		    ADD COLUMN IF NOT EXISTS accrued_interest BIGINT NOT NULL DEFAULT 0,
+		    ADD COLUMN IF NOT EXISTS interest_period_start DATE,
+		    ADD COLUMN IF NOT EXISTS accrued_until DATE;
+		UPDATE deposits
+		SET interest_period_start = created_at::date, accrued_until = created_at::date
+		WHERE accrued_until IS NULL;
+		CREATE INDEX IF NOT EXISTS deposits_accrual_idx ON deposits(accrued_until) WHERE active = TRUE;`
+
+	_, err = db.Exec(depositAccrualQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during alter tables for deposit accrual: %v", err.Error())
+		return err
+	}
+
+	depositEarlyWithdrawalQuery := `
+		ALTER TABLE deposits
+		    ADD COLUMN IF NOT EXISTS early_withdrawal VARCHAR,
+		    ADD COLUMN IF NOT EXISTS early_withdrawal_rate NUMERIC(7,4) NOT NULL DEFAULT 0;
+		UPDATE deposits
+		SET early_withdrawal = COALESCE((SELECT p.early_withdrawal FROM deposit_products p WHERE p.id = deposits.product_id), 'not_allowed'),
+		    early_withdrawal_rate = COALESCE((SELECT p.early_withdrawal_rate FROM deposit_products p WHERE p.id = deposits.product_id), 0)
+		WHERE early_withdrawal IS NULL;
+		ALTER TABLE deposits
+		    ALTER COLUMN early_withdrawal SET DEFAULT 'not_allowed',
+		    ALTER COLUMN early_withdrawal SET NOT NULL;`
+
+	_, err = db.Exec(depositEarlyWithdrawalQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during alter deposits for early withdrawal: %v", err.Error())
+		return err
+	}
+
+	depositMaturityQuery := `
+		ALTER TABLE deposits
+		    ADD COLUMN IF NOT EXISTS maturity_instruction VARCHAR NOT NULL DEFAULT 'payout',
+		    ADD COLUMN IF NOT EXISTS rolled_over_from INT REFERENCES deposits(id);
+		CREATE INDEX IF NOT EXISTS deposits_maturity_idx ON deposits(expires_at) WHERE active = TRUE;`
+
+	_, err = db.Exec(depositMaturityQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during alter deposits for maturity instructions: %v", err.Error())
+		return err
+	}
+
+	rolesQuery := `
+		CREATE TABLE IF NOT EXISTS roles (
+	name VARCHAR PRIMARY KEY,
+	description VARCHAR NOT NULL DEFAULT ''
+);
+
+		CREATE TABLE IF NOT EXISTS permissions (
+	name VARCHAR PRIMARY KEY,
+	description VARCHAR NOT NULL DEFAULT ''
+);
+
+		CREATE TABLE IF NOT EXISTS role_permissions (
+	role VARCHAR NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+	permission VARCHAR NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+	PRIMARY KEY (role, permission)
+);
+
+		CREATE TABLE IF NOT EXISTS user_roles (
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role VARCHAR NOT NULL REFERENCES roles(name),
+	granted_by INT REFERENCES users(id),
+	granted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (user_id, role)
+);
+
+		INSERT INTO roles (name, description) VALUES
+	('customer', 'Works with own accounts, credits and deposits'),
+	('operator', 'Back office: reviews customers and decides on credits'),
+	('admin', 'Full access including products, currencies and roles'),
+	('auditor', 'Read-only access to customer data and reports')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO permissions (name, description) VALUES
+	('users.read', 'View any user'),
+	('users.manage', 'Delete and restore any user'),
+	('accounts.read', 'View any account and balance'),
+	('accounts.manage', 'Change and delete any account, adjust balances'),
+	('credits.read', 'View any credit and credit lists'),
+	('credits.decide', 'Approve and reject credit applications'),
+	('deposits.read', 'View any deposit'),
+	('deposits.manage', 'Close and change any deposit'),
+	('products.manage', 'Manage deposit products'),
+	('currencies.manage', 'Manage currencies and exchange rates'),
+	('reports.read', 'Reconciliation, portfolio and exchange rate reports'),
+	('roles.manage', 'Grant and revoke roles')
+		ON CONFLICT (name) DO NOTHING;
+
+		INSERT INTO role_permissions (role, permission)
+		SELECT 'admin', name FROM permissions
+		UNION ALL
+		SELECT 'operator', unnest(ARRAY['users.read', 'accounts.read', 'credits.read', 'credits.decide', 'deposits.read', 'deposits.manage'])
+		UNION ALL
+		SELECT 'auditor', unnest(ARRAY['users.read', 'accounts.read', 'credits.read', 'deposits.read', 'reports.read'])
+		ON CONFLICT DO NOTHING;
+
+		INSERT INTO user_roles (user_id, role)
+		SELECT u.id, 'customer' FROM users u
+		WHERE NOT EXISTS (SELECT 1 FROM user_roles r WHERE r.user_id = u.id)
+		ON CONFLICT DO NOTHING;`
+
+	_, err = db.Exec(rolesQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during create roles tables: %v", err.Error())
+		return err
+	}
+
+	tokensQuery := `
+		CREATE TABLE IF NOT EXISTS refresh_tokens (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	session_id VARCHAR NOT NULL,
+	token_hash VARCHAR NOT NULL UNIQUE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP,
+	replaced_by INT REFERENCES refresh_tokens(id) ON DELETE SET NULL
+);
+		CREATE INDEX IF NOT EXISTS refresh_tokens_session_idx ON refresh_tokens(session_id);
+		CREATE INDEX IF NOT EXISTS refresh_tokens_user_idx ON refresh_tokens(user_id) WHERE revoked_at IS NULL;
+
+		CREATE TABLE IF NOT EXISTS revoked_tokens (
+	jti VARCHAR PRIMARY KEY,
+	user_id INT REFERENCES users(id) ON DELETE CASCADE,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);`
+
+	_, err = db.Exec(tokensQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during create token tables: %v", err.Error())
+		return err
+	}
+
+	signingKeysQuery := `
+		CREATE TABLE IF NOT EXISTS signing_keys (
+	kid VARCHAR PRIMARY KEY,
+	algorithm VARCHAR NOT NULL,
+	private_key BYTEA NOT NULL,
+	public_key BYTEA NOT NULL,
+	encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP NOT NULL,
+	activates_at TIMESTAMP NOT NULL,
+	retired_at TIMESTAMP,
+	expires_at TIMESTAMP
+);
+
+		-- Таблица из первой версии: ключи хранились открыто и подписывали сразу после создания
+		ALTER TABLE signing_keys
+			ADD COLUMN IF NOT EXISTS encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+			ADD COLUMN IF NOT EXISTS activates_at TIMESTAMP;
+		UPDATE signing_keys SET activates_at = created_at WHERE activates_at IS NULL;
+		ALTER TABLE signing_keys ALTER COLUMN activates_at SET NOT NULL;`
+
+	_, err = db.Exec(signingKeysQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during create signing_keys table: %v", err.Error())
+		return err
+	}
+
+	totpQuery := `
+		CREATE TABLE IF NOT EXISTS user_totp (
+	user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	secret VARCHAR NOT NULL,
+	confirmed_at TIMESTAMP,
+	last_step BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+		CREATE TABLE IF NOT EXISTS totp_recovery_codes (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash VARCHAR NOT NULL,
+	used_at TIMESTAMP
+);
+		CREATE INDEX IF NOT EXISTS totp_recovery_codes_user_idx ON totp_recovery_codes(user_id);
+
+		CREATE TABLE IF NOT EXISTS mfa_challenges (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	token_hash VARCHAR NOT NULL UNIQUE,
+	expires_at TIMESTAMP NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	used_at TIMESTAMP
+);`
+
+	_, err = db.Exec(totpQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during create two-factor tables: %v", err.Error())
+		return err
+	}
+
+	loginFailuresQuery := `
+		CREATE TABLE IF NOT EXISTS login_failures (
+	scope VARCHAR NOT NULL,
+	subject VARCHAR NOT NULL,
+	failed_count INT NOT NULL DEFAULT 0,
+	last_failed_at TIMESTAMP NOT NULL,
+	locked_until TIMESTAMP,
+	PRIMARY KEY (scope, subject)
+);
+
+		ALTER TABLE audit_logs ADD COLUMN IF NOT EXISTS details TEXT;`
+
+	_, err = db.Exec(loginFailuresQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during create login_failures table: %v", err.Error())
+		return err
+	}
+
+	userIdentifiersQuery := `
+		CREATE TABLE IF NOT EXISTS user_identifiers (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	kind VARCHAR NOT NULL,
+	value VARCHAR NOT NULL,
+	verified_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (user_id, kind)
+);
+
+		-- Значение занято только подтверждённым идентификатором: неподтверждённую почту или телефон
+		-- могут указать несколько пользователей, достаётся она тому, кто первым подтвердит
+		ALTER TABLE user_identifiers DROP CONSTRAINT IF EXISTS user_identifiers_kind_value_key;
+		CREATE UNIQUE INDEX IF NOT EXISTS user_identifiers_verified_key
+			ON user_identifiers(kind, value) WHERE verified_at IS NOT NULL;`
+
+	_, err = db.Exec(userIdentifiersQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during create user_identifiers table: %v", err.Error())
+		return err
+	}
+
+	// Пользователи, созданные до появления логинов, входили по полному имени. Их имя пользователя -
+	// полное имя в нижнем регистре, если оно подходит под правила и не совпадает с чужим
+	usernamesFromNamesQuery := `
+		INSERT INTO user_identifiers (user_id, kind, value, verified_at)
+		SELECT u.id, 'username', lower(btrim(u.full_name)), CURRENT_TIMESTAMP
+		FROM users u
+		WHERE NOT EXISTS (SELECT 1 FROM user_identifiers i WHERE i.user_id = u.id AND i.kind = 'username')
+		  AND lower(btrim(u.full_name)) ~ '^[a-z][a-z0-9._-]{2,31}$'
+		  AND lower(btrim(u.full_name)) !~ '^user[0-9]+$'
+		  AND (SELECT count(*) FROM users o WHERE lower(btrim(o.full_name)) = lower(btrim(u.full_name))) = 1
+		ON CONFLICT DO NOTHING;`
+
+	_, err = db.Exec(usernamesFromNamesQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during backfill usernames: %v", err.Error())
+		return err
+	}
+
+	// Остальные получают user<ID>: о новом логине им нужно сообщить, см. README
+	usernamesFallbackQuery := `
+		INSERT INTO user_identifiers (user_id, kind, value, verified_at)
+		SELECT u.id, 'username', 'user' || u.id, CURRENT_TIMESTAMP
+		FROM users u
+		WHERE NOT EXISTS (SELECT 1 FROM user_identifiers i WHERE i.user_id = u.id AND i.kind = 'username')
+		ON CONFLICT DO NOTHING;`
+
+	result, err := db.Exec(usernamesFallbackQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during backfill usernames: %v", err.Error())
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows > 0 {
+		logger.Warn.Printf("[db] InitMigrations(): %d users got the username user<ID> instead of their full name, let them know", rows)
+	}
+
+	verificationCodesQuery := `
+		CREATE TABLE IF NOT EXISTS verification_codes (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	kind VARCHAR NOT NULL,
+	target VARCHAR NOT NULL,
+	code_hash VARCHAR NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	used_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL
+);
+		CREATE INDEX IF NOT EXISTS verification_codes_user_kind_idx ON verification_codes(user_id, kind);`
+
+	_, err = db.Exec(verificationCodesQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during create verification_codes table: %v", err.Error())
+		return err
+	}
+
+	passwordQuery := `
+		CREATE TABLE IF NOT EXISTS password_history (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	password_hash VARCHAR NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+		CREATE INDEX IF NOT EXISTS password_history_user_idx ON password_history(user_id);
+
+		CREATE TABLE IF NOT EXISTS password_resets (
+	id SERIAL PRIMARY KEY,
+	user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	token_hash VARCHAR NOT NULL UNIQUE,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL
+);`
+
+	_, err = db.Exec(passwordQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during create password tables: %v", err.Error())
+		return err
+	}
+
+	// Один счёт на валюту и назначение - только если это включено в конфиге
+	accountsUniqueQuery := `
+		DROP INDEX IF EXISTS accounts_user_currency_purpose_key;`
+	if configs.AppSettings.AccountParams.UniquePerCurrency {
+		accountsUniqueQuery = `
+		CREATE UNIQUE INDEX IF NOT EXISTS accounts_user_currency_purpose_key
+			ON accounts(user_id, currency, purpose) WHERE deleted_at IS NULL;`
+	}
+
+	_, err = db.Exec(accountsUniqueQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during create accounts unique index: %v", err.Error())
+		return err
+	}
+
+	totpFailuresQuery := `
+		ALTER TABLE user_totp
+			ADD COLUMN IF NOT EXISTS failed_attempts INT NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS locked_until TIMESTAMP;`
+
+	_, err = db.Exec(totpFailuresQuery)
+	if err != nil {
+		logger.Error.Printf("[db] InitMigrations(): error during alter user_totp table: %v", err.Error())
+		return err
+	}
+
 	return nil
 }
@@ -19,7 +19,8 @@ func ConnectDB() error {
 							user=%s 
 							password=%s 
 							dbname=%s 
-							sslmode=disable`,
+							sslmode=disable
+							TimeZone=UTC`,
 		cfg.Host,
 		cfg.Port,
 		cfg.User,
@@ -1,6 +1,9 @@
 package errs
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	ErrDBUnavailable        = errors.New("db is not available at the moment")
@@ -10,8 +13,8 @@ var (
 	ErrCreditNotActive      = errors.New("credit is not active")
 	ErrInvalidFullName      = errors.New("invalid full name")
 	ErrPasswordTooShort     = errors.New("password too short")
-	ErrUserAlreadyExists    = errors.New("user with this name already exists")
 	ErrInvalidPassword      = errors.New("invalid password")
+	ErrInvalidCredentials   = errors.New("invalid login or password")
 	ErrInvalidCurrency      = errors.New("invalid currency")
 	ErrInvalidInterestRate  = errors.New("interest rate must be between 0.0 and 100.0")
 	ErrInsufficientFunds    = errors.New("insufficient funds")
@@ -28,4 +31,85 @@ var (
 	ErrFraud                = errors.New("someone is trying to break in to our system")
 	ErrNoZeroBalance        = errors.New("cannot delete account with non-zero balance")
 	ErrInsufficientBalance  = errors.New("insufficient balance")
+	ErrUnbalancedJournal    = errors.New("ledger journal entries do not balance")
+	ErrPostingCurrency      = errors.New("ledger entry currency does not match the account currency")
+	ErrCurrencyInUse        = errors.New("minor units of a currency in use cannot be changed")
+	ErrCurrencyChange       = errors.New("currency can be changed only on an empty account without ledger entries")
+
+	ErrInvalidIdempotencyKey    = errors.New("invalid idempotency key")
+	ErrIdempotencyKeyReused     = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyKeyInProgress = errors.New("request with this idempotency key is still in progress")
+	ErrExchangeRateNotFound     = errors.New("exchange rate not found")
+	ErrExchangeRateExists       = errors.New("exchange rate for this moment already exists")
+	ErrInvalidExchangeRate      = errors.New("invalid exchange rate")
+	ErrAccountLimitReached      = errors.New("accounts limit per user reached")
+	ErrInvalidAccountPurpose    = errors.New("invalid account purpose")
+	ErrNoAccountForCurrency     = errors.New("user has no active account in this currency")
+	ErrInvalidCreditTransition  = errors.New("credit cannot move to this status")
+	ErrInvalidCreditStatus      = errors.New("invalid credit status")
+	ErrCreditAccountMismatch    = errors.New("credit account belongs to another user or has another currency")
+	ErrReasonRequired           = errors.New("reason is required")
+	ErrOverpayment              = errors.New("payment exceeds outstanding amount")
+	ErrInvalidPrepaymentMode    = errors.New("prepayment mode must be reduce_term or reduce_installment")
+	ErrPrepaymentTooSmall       = errors.New("prepayment must cover amounts due and accrued interest")
+	ErrNoCreditSchedule         = errors.New("credit has no repayment schedule")
+	ErrInvalidQuoteDate         = errors.New("quote date cannot be in the past")
+	ErrInvalidDepositProduct    = errors.New("invalid deposit product")
+	ErrDepositProductExists     = errors.New("deposit product with this name already exists")
+	ErrDepositProductNotActive  = errors.New("deposit product is not active")
+	ErrInvalidDepositTerm       = errors.New("term is not offered by the deposit product")
+	ErrDepositAmountOutOfRange  = errors.New("amount is outside the deposit product limits")
+	ErrNoDepositRate            = errors.New("deposit product has no rate for this term and amount")
+	ErrDepositNotMatured        = errors.New("deposit has not matured yet")
+	ErrDepositMatured           = errors.New("deposit has already matured")
+	ErrInvalidMaturityAction    = errors.New("maturity instruction must be payout, rollover_with_interest or rollover_principal")
+	ErrInvalidRole              = errors.New("unknown role")
+	ErrRoleNotGranted           = errors.New("user does not have this role")
+	ErrLastAdmin                = errors.New("cannot revoke the last admin role")
+	ErrInvalidRefreshToken      = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused       = errors.New("refresh token was already used")
+	ErrTOTPNotEnabled           = errors.New("two-factor authentication is not enabled")
+	ErrTOTPAlreadyEnabled       = errors.New("two-factor authentication is already enabled")
+	ErrInvalidTOTPCode          = errors.New("invalid two-factor code")
+	ErrStepUpRequired           = errors.New("two-factor code is required for this operation")
+	ErrInvalidMFAToken          = errors.New("invalid or expired sign-in challenge")
+	ErrTOTPLocked               = errors.New("one-time codes are temporarily locked after too many wrong codes")
+	ErrLoginThrottled           = errors.New("too many failed sign-in attempts, try again later")
+	ErrLoginLocked              = errors.New("sign-in is temporarily locked")
+	ErrInvalidIPAddress         = errors.New("invalid IP address")
+	ErrInvalidUsername          = errors.New("invalid username")
+	ErrInvalidEmail             = errors.New("invalid email")
+	ErrInvalidPhone             = errors.New("invalid phone number")
+	ErrInvalidIdentifierKind    = errors.New("invalid login identifier kind")
+	ErrIdentifierTaken          = errors.New("login identifier is already taken")
+	ErrIdentifierRequired       = errors.New("username cannot be removed")
+	ErrIdentifierVerified       = errors.New("login identifier is already verified")
+	ErrInvalidVerificationCode  = errors.New("invalid verification code")
+	ErrVerificationCodeExpired  = errors.New("verification code is expired or used up")
+	ErrVerificationTooSoon      = errors.New("verification code was sent recently")
+	ErrContactNotVerified       = errors.New("contact details are not verified")
+	ErrPasswordTooLong          = errors.New("password too long")
+	ErrPasswordTooWeak          = errors.New("password does not meet the character requirements")
+	ErrPasswordBreached         = errors.New("password is known from data breaches")
+	ErrPasswordReused           = errors.New("password was used recently")
+	ErrInvalidResetToken        = errors.New("invalid or expired password reset token")
+	ErrInvalidPageLimit         = errors.New("limit must be a positive number")
+	ErrInvalidCursor            = errors.New("invalid page cursor")
+	ErrInvalidSortField         = errors.New("sorting by this field is not supported")
+	ErrInvalidFilter            = errors.New("invalid or unsupported filter")
 )
+
+// Вход или проверка второго фактора временно запрещены: Reason - ErrLoginThrottled, ErrLoginLocked
+// или ErrTOTPLocked, RetryAt - когда можно повторить
+type LoginBlockedError struct {
+	Reason  error
+	RetryAt time.Time
+}
+
+func (e *LoginBlockedError) Error() string {
+	return e.Reason.Error()
+}
+
+func (e *LoginBlockedError) Unwrap() error {
+	return e.Reason
+}
@@ -2,12 +2,19 @@ package models
 
 import "time"
 
+// Назначение счёта: у пользователя может быть по счёту на каждую валюту и назначение
+const (
+	AccountPurposeCurrent = "current"
+	AccountPurposeSavings = "savings"
+)
+
 type Account struct {
 	ID          int        `db:"id"`
 	UserID      int        `db:"user_id"`
 	PhoneNumber string     `db:"phone_number"`
-	Balance     int64      `db:"balance"`
+	Balance     Money      `db:"balance"`
 	Currency    string     `db:"currency"`
+	Purpose     string     `db:"purpose"`
 	CreatedAt   time.Time  `db:"created_at"`
 	UpdatedAt   *time.Time `db:"updated_at"`
 	DeletedAt   *time.Time `db:"deleted_at"`
@@ -17,7 +24,7 @@ type Account struct {
 type UpdateAccount struct {
 	ID          int     `json:"id"`
 	PhoneNumber *string `json:"phone_number"`
-	Balance     *int64  `json:"balance"`
+	Balance     *Money  `json:"balance"`
 	Currency    *string `json:"currency"`
 	UserID      int     `json:"-"`
 }
@@ -8,5 +8,6 @@ type AuditLog struct {
 	Entity    string    `db:"entity"`
 	EntityID  int       `db:"entity_id"`
 	UserID    int       `db:"user_id"`
+	Details   *string   `db:"details"`
 	Timestamp time.Time `db:"timestamp"`
 }
@@ -1,14 +1,27 @@
 package models
 
 type Configs struct {
-	AuthParams     AuthParams     `json:"auth_params"`
-	LogParams      LogParams      `json:"log_params"`
-	AppParams      AppParams      `json:"app_params"`
-	PostgresParams PostgresParams `json:"postgres_params"`
+	AuthParams         AuthParams         `json:"auth_params"`
+	LogParams          LogParams          `json:"log_params"`
+	AppParams          AppParams          `json:"app_params"`
+	PostgresParams     PostgresParams     `json:"postgres_params"`
+	IdempotencyParams  IdempotencyParams  `json:"idempotency_params"`
+	FxParams           FxParams           `json:"fx_params"`
+	AccountParams      AccountParams      `json:"account_params"`
+	CreditParams       CreditParams       `json:"credit_params"`
+	SchedulerParams    SchedulerParams    `json:"scheduler_params"`
+	MFAParams          MFAParams          `json:"mfa_params"`
+	LoginParams        LoginParams        `json:"login_params"`
+	NotifierParams     NotifierParams     `json:"notifier_params"`
+	VerificationParams VerificationParams `json:"verification_params"`
+	PasswordParams     PasswordParams     `json:"password_params"`
+	PaginationParams   PaginationParams   `json:"pagination_params"`
 }
 type AuthParams struct {
-	JwtSecretKey  string `json:"jwt_secret_key"`
-	JwtTtlMinutes int    `json:"jwt_ttl_minutes"`
+	JwtTtlMinutes    int    `json:"jwt_ttl_minutes"`
+	RefreshTtlHours  int    `json:"refresh_ttl_hours"`
+	SigningAlgorithm string `json:"signing_algorithm"`
+	KeyRotationDays  int    `json:"key_rotation_days"`
 }
 
 type LogParams struct {
@@ -30,6 +43,8 @@ type AppParams struct {
 	AppVersion string `json:"app_version"`
 	PortRun    string `json:"port_run"`
 	GinMode    string `json:"gin_mode"`
+	// Адреса прокси, которым можно верить в X-Forwarded-For; пусто - клиентом считается адрес соединения
+	TrustedProxies []string `json:"trusted_proxies"`
 }
 
 type PostgresParams struct {
@@ -38,3 +53,74 @@ type PostgresParams struct {
 	Port     string `json:"port"`
 	Database string `json:"database"`
 }
+
+type IdempotencyParams struct {
+	TtlHours int `json:"ttl_hours"`
+}
+
+type FxParams struct {
+	Provider       string `json:"provider"`
+	ApiURL         string `json:"api_url"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+type AccountParams struct {
+	MaxAccountsPerUser int  `json:"max_accounts_per_user"`
+	UniquePerCurrency  bool `json:"unique_per_currency"`
+}
+
+type CreditParams struct {
+	PenaltyRate float64 `json:"penalty_rate"`
+}
+
+type SchedulerParams struct {
+	IntervalMinutes int `json:"interval_minutes"`
+}
+
+type MFAParams struct {
+	Issuer              string `json:"issuer"`
+	ChallengeTtlMinutes int    `json:"challenge_ttl_minutes"`
+	MaxAttempts         int    `json:"max_attempts"`
+	RecoveryCodes       int    `json:"recovery_codes"`
+	StepUpThreshold     Money  `json:"step_up_threshold"`
+	StepUpCurrency      string `json:"step_up_currency"`
+	MaxFailures         int    `json:"max_failures"`
+	LockoutMinutes      int    `json:"lockout_minutes"`
+}
+
+type LoginParams struct {
+	MaxFailures          int `json:"max_failures"`
+	IPMaxFailures        int `json:"ip_max_failures"`
+	FailureWindowMinutes int `json:"failure_window_minutes"`
+	LockoutMinutes       int `json:"lockout_minutes"`
+	BaseDelaySeconds     int `json:"base_delay_seconds"`
+	MaxDelaySeconds      int `json:"max_delay_seconds"`
+}
+
+type NotifierParams struct {
+	Provider string `json:"provider"`
+	FilePath string `json:"file_path"`
+}
+
+type VerificationParams struct {
+	CodeTtlMinutes int `json:"code_ttl_minutes"`
+	MaxAttempts    int `json:"max_attempts"`
+	ResendSeconds  int `json:"resend_seconds"`
+}
+
+type PasswordParams struct {
+	MinLength       int    `json:"min_length"`
+	RequireUpper    bool   `json:"require_upper"`
+	RequireLower    bool   `json:"require_lower"`
+	RequireDigit    bool   `json:"require_digit"`
+	RequireSymbol   bool   `json:"require_symbol"`
+	DenylistFile    string `json:"denylist_file"`
+	HistorySize     int    `json:"history_size"`
+	BcryptCost      int    `json:"bcrypt_cost"`
+	ResetTtlMinutes int    `json:"reset_ttl_minutes"`
+}
+
+type PaginationParams struct {
+	DefaultLimit int `json:"default_limit"`
+	MaxLimit     int `json:"max_limit"`
+}
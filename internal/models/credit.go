@@ -2,14 +2,70 @@ package models
 
 import "time"
 
+// Статусы жизненного цикла кредита
+const (
+	CreditStatusPending   = "pending"
+	CreditStatusApproved  = "approved"
+	CreditStatusRejected  = "rejected"
+	CreditStatusDisbursed = "disbursed"
+	CreditStatusRepaid    = "repaid"
+	CreditStatusDefaulted = "defaulted"
+)
+
+// Что делать с графиком после досрочного погашения
+const (
+	PrepaymentReduceTerm        = "reduce_term"
+	PrepaymentReduceInstallment = "reduce_installment"
+)
+
+// Корзины просрочки по числу дней с даты самого раннего неоплаченного платежа
+const (
+	DelinquencyCurrent = "current"
+	Delinquency1To30   = "1-30"
+	Delinquency31To60  = "31-60"
+	Delinquency61To90  = "61-90"
+	Delinquency90Plus  = "90+"
+)
+
 type Credit struct {
-	ID             int        `db:"id"`
-	UserID         int        `db:"user_id"`
-	Amount         int64      `db:"amount"`
-	Currency       string     `db:"currency"`
-	DurationMonths int        `db:"duration_months"`
-	InterestRate   float64    `db:"interest_rate"`
-	CreatedAt      time.Time  `db:"created_at"`
-	ApprovedAt     *time.Time `db:"approved_at"`
-	Active         bool       `db:"active"`
+	ID                int        `db:"id"`
+	UserID            int        `db:"user_id"`
+	AccountID         *int       `db:"account_id"`
+	Amount            Money      `db:"amount"`
+	Outstanding       Money      `db:"outstanding"`
+	Currency          string     `db:"currency"`
+	DurationMonths    int        `db:"duration_months"`
+	InterestRate      float64    `db:"interest_rate"`
+	Status            string     `db:"status"`
+	DaysPastDue       int        `db:"days_past_due"`
+	DelinquencyBucket string     `db:"delinquency_bucket"`
+	RejectionReason   *string    `db:"rejection_reason"`
+	DecidedBy         *int       `db:"decided_by"`
+	CreatedAt         time.Time  `db:"created_at"`
+	ApprovedAt        *time.Time `db:"approved_at"`
+	DisbursedAt       *time.Time `db:"disbursed_at"`
+	UpdatedAt         *time.Time `db:"updated_at"`
+	Active            bool       `db:"active"`
+}
+
+// Запись истории смены статусов кредита
+type CreditStatusChange struct {
+	ID         int       `db:"id"`
+	CreditID   int       `db:"credit_id"`
+	FromStatus *string   `db:"from_status"`
+	ToStatus   string    `db:"to_status"`
+	Reason     *string   `db:"reason"`
+	ChangedBy  int       `db:"changed_by"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+// Сумма полного досрочного погашения на дату
+type PayoffQuote struct {
+	CreditID        int       `json:"credit_id"`
+	AsOf            time.Time `json:"as_of"`
+	Currency        string    `json:"currency"`
+	DueAmount       Money     `json:"due_amount"`
+	AccruedInterest Money     `json:"accrued_interest"`
+	Principal       Money     `json:"principal"`
+	Total           Money     `json:"total"`
 }
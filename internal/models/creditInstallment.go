@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Статусы платежа по графику
+const (
+	InstallmentStatusPending = "pending"
+	InstallmentStatusPartial = "partial"
+	InstallmentStatusPaid    = "paid"
+	InstallmentStatusOverdue = "overdue"
+)
+
+// Платёж по графику погашения кредита. Все суммы в минимальных единицах валюты кредита
+type CreditInstallment struct {
+	ID               int        `db:"id" json:"id"`
+	CreditID         int        `db:"credit_id" json:"credit_id"`
+	Number           int        `db:"number" json:"number"`
+	DueDate          time.Time  `db:"due_date" json:"due_date"`
+	Payment          Money      `db:"payment" json:"payment"`
+	Principal        Money      `db:"principal" json:"principal"`
+	Interest         Money      `db:"interest" json:"interest"`
+	PrincipalPaid    Money      `db:"principal_paid" json:"principal_paid"`
+	InterestPaid     Money      `db:"interest_paid" json:"interest_paid"`
+	Penalty          Money      `db:"penalty" json:"penalty"`
+	PenaltyPaid      Money      `db:"penalty_paid" json:"penalty_paid"`
+	PenaltyAccruedOn *time.Time `db:"penalty_accrued_on" json:"penalty_accrued_on"`
+	Balance          Money      `db:"balance" json:"balance"`
+	Status           string     `db:"status" json:"status"`
+	PaidAt           *time.Time `db:"paid_at" json:"paid_at"`
+}
+
+// Просроченные тело и проценты, на которые начисляется неустойка
+func (i CreditInstallment) Overdue() Money {
+	return i.Principal - i.PrincipalPaid + i.Interest - i.InterestPaid
+}
+
+// Остаток к оплате по платежу вместе с неустойкой
+func (i CreditInstallment) Due() Money {
+	return i.Overdue() + i.Penalty - i.PenaltyPaid
+}
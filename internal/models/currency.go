@@ -0,0 +1,10 @@
+package models
+
+// Currency - запись справочника валют ISO 4217
+type Currency struct {
+	Code        string `db:"code" json:"code"`
+	NumericCode string `db:"numeric_code" json:"numeric_code"`
+	Name        string `db:"name" json:"name"`
+	MinorUnits  int    `db:"minor_units" json:"minor_units"`
+	Enabled     bool   `db:"enabled" json:"enabled"`
+}
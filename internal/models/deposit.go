@@ -2,14 +2,60 @@ package models
 
 import "time"
 
+// Правила подсчёта дней для начисления процентов
+const (
+	DayCountAct365 = "act_365"
+	DayCount30360  = "30_360"
+)
+
+// Что сделать с депозитом в дату окончания срока
+const (
+	MaturityPayout               = "payout"
+	MaturityRolloverWithInterest = "rollover_with_interest"
+	MaturityRolloverPrincipal    = "rollover_principal"
+)
+
 type Deposit struct {
-	ID             int       `db:"id"`
-	UserID         int       `db:"user_id"`
-	Amount         int64     `db:"amount"`
-	Currency       string    `db:"currency"`
-	InterestRate   float64   `db:"interest_rate"`
-	DurationMonths int       `db:"duration_months"`
-	CreatedAt      time.Time `db:"created_at"`
-	ExpiresAt      time.Time `db:"expires_at"`
-	Active         bool      `db:"active"`
+	ID                  int        `db:"id"`
+	UserID              int        `db:"user_id"`
+	ProductID           *int       `db:"product_id"`
+	Amount              Money      `db:"amount"`
+	Currency            string     `db:"currency"`
+	InterestRate        float64    `db:"interest_rate"`
+	DurationMonths      int        `db:"duration_months"`
+	CreatedAt           time.Time  `db:"created_at"`
+	ExpiresAt           time.Time  `db:"expires_at"`
+	Active              bool       `db:"active"`
+	Compounding         string     `db:"compounding"`
+	DayCount            string     `db:"day_count"`
+	PayoutAccountID     *int       `db:"payout_account_id"`
+	CapitalizedInterest Money      `db:"capitalized_interest"`
+	PaidInterest        Money      `db:"paid_interest"`
+	AccruedInterest     Money      `db:"accrued_interest"`
+	InterestPeriodStart *time.Time `db:"interest_period_start"`
+	AccruedUntil        *time.Time `db:"accrued_until"`
+	EarlyWithdrawal     string     `db:"early_withdrawal"`
+	EarlyWithdrawalRate float64    `db:"early_withdrawal_rate"`
+	MaturityInstruction string     `db:"maturity_instruction"`
+	RolledOverFrom      *int       `db:"rolled_over_from"`
+}
+
+// Сумма, на которую начисляются проценты: тело вместе с капитализированными процентами
+func (d Deposit) Principal() Money {
+	return d.Amount + d.CapitalizedInterest
+}
+
+// Расчёт досрочного расторжения депозита на дату
+type EarlyWithdrawalQuote struct {
+	DepositID      int       `json:"deposit_id"`
+	AsOf           time.Time `json:"as_of"`
+	Currency       string    `json:"currency"`
+	Policy         string    `json:"policy"`
+	PolicyRate     float64   `json:"policy_rate"`
+	Principal      Money     `json:"principal"`
+	InterestEarned Money     `json:"interest_earned"`
+	InterestPaid   Money     `json:"interest_paid"`
+	Interest       Money     `json:"interest"`
+	Penalty        Money     `json:"penalty"`
+	Payout         Money     `json:"payout"`
 }
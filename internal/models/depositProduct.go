@@ -0,0 +1,48 @@
+package models
+
+import (
+	"github.com/lib/pq"
+	"time"
+)
+
+// Политика досрочного расторжения депозита: запрещено, проценты пересчитываются по ставке до востребования
+// (early_withdrawal_rate годовых) или удерживается штраф - early_withdrawal_rate процентов от начисленных процентов
+const (
+	EarlyWithdrawalNotAllowed   = "not_allowed"
+	EarlyWithdrawalOnDemandRate = "on_demand_rate"
+	EarlyWithdrawalPenalty      = "penalty"
+)
+
+// Периодичность капитализации процентов (или выплаты на привязанный счёт)
+const (
+	CompoundingNone      = "none"
+	CompoundingMonthly   = "monthly"
+	CompoundingQuarterly = "quarterly"
+)
+
+// Депозитный продукт: условия, на которых клиент может открыть депозит
+type DepositProduct struct {
+	ID                  int               `db:"id" json:"id"`
+	Name                string            `db:"name" json:"name"`
+	Currency            string            `db:"currency" json:"currency"`
+	MinAmount           Money             `db:"min_amount" json:"min_amount"`
+	MaxAmount           Money             `db:"max_amount" json:"max_amount"`
+	AllowedTerms        pq.Int64Array     `db:"allowed_terms" json:"allowed_terms"`
+	EarlyWithdrawal     string            `db:"early_withdrawal" json:"early_withdrawal"`
+	EarlyWithdrawalRate float64           `db:"early_withdrawal_rate" json:"early_withdrawal_rate"`
+	Compounding         string            `db:"compounding" json:"compounding"`
+	DayCount            string            `db:"day_count" json:"day_count"`
+	Active              bool              `db:"active" json:"active"`
+	CreatedAt           time.Time         `db:"created_at" json:"created_at"`
+	UpdatedAt           *time.Time        `db:"updated_at" json:"updated_at"`
+	Rates               []DepositRateTier `db:"-" json:"rates"`
+}
+
+// Ставка продукта для срока и суммы от MinAmount
+type DepositRateTier struct {
+	ID         int     `db:"id" json:"-"`
+	ProductID  int     `db:"product_id" json:"-"`
+	TermMonths int     `db:"term_months" json:"term_months"`
+	MinAmount  Money   `db:"min_amount" json:"min_amount"`
+	Rate       float64 `db:"rate" json:"rate"`
+}
@@ -3,8 +3,12 @@ package models
 import "time"
 
 type Entry struct {
-	ID        int       `json:"id"`
-	AccountID int       `json:"account_id"`
-	Amount    int       `json:"amount"`
-	CreatedAt time.Time `json:"created_at"`
+	ID            int       `db:"id" json:"id"`
+	JournalID     *int64    `db:"journal_id" json:"journal_id"`
+	AccountID     *int      `db:"account_id" json:"account_id"`
+	SystemAccount *string   `db:"system_account" json:"system_account,omitempty"`
+	Amount        Money     `db:"amount" json:"amount"`
+	Currency      string    `db:"currency" json:"currency"`
+	ExchangeRate  *float64  `db:"exchange_rate" json:"exchange_rate,omitempty"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
 }
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type ExchangeRate struct {
+	ID            int       `db:"id" json:"id"`
+	BaseCurrency  string    `db:"base_currency" json:"base_currency"`
+	QuoteCurrency string    `db:"quote_currency" json:"quote_currency"`
+	Rate          float64   `db:"rate" json:"rate"`
+	EffectiveAt   time.Time `db:"effective_at" json:"effective_at"`
+	CreatedBy     int       `db:"created_by" json:"created_by"`
+	CreatedAt     time.Time `db:"created_at" json:"created_at"`
+}
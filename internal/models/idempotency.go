@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type IdempotencyKey struct {
+	ID           int       `db:"id"`
+	Key          string    `db:"idempotency_key"`
+	UserID       int       `db:"user_id"`
+	Method       string    `db:"method"`
+	Path         string    `db:"path"`
+	Fingerprint  string    `db:"fingerprint"`
+	StatusCode   *int      `db:"status_code"`
+	ResponseBody []byte    `db:"response_body"`
+	CreatedAt    time.Time `db:"created_at"`
+	ExpiresAt    time.Time `db:"expires_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Виды идентификаторов для входа
+const (
+	IdentifierUsername = "username"
+	IdentifierEmail    = "email"
+	IdentifierPhone    = "phone"
+)
+
+// Идентификатор для входа. Значение хранится в нормализованном виде и уникально среди идентификаторов своего вида.
+// Войти можно только по подтверждённому (verified_at), имя пользователя подтверждено сразу
+type UserIdentifier struct {
+	ID         int        `db:"id" json:"-"`
+	UserID     int        `db:"user_id" json:"user_id"`
+	Kind       string     `db:"kind" json:"kind"`
+	Value      string     `db:"value" json:"value"`
+	VerifiedAt *time.Time `db:"verified_at" json:"verified_at"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Системные (внутренние) счета банка, участвующие в проводках
+const (
+	SystemAccountBankCash        = "bank_cash"
+	SystemAccountInterestExpense = "interest_expense"
+	SystemAccountInterestIncome  = "interest_income"
+	SystemAccountPenaltyIncome   = "penalty_income"
+	SystemAccountLoanBook        = "loan_book"
+	SystemAccountDepositsHeld    = "deposits_held"
+	SystemAccountInterestPayable = "interest_payable"
+	SystemAccountFxClearing      = "fx_clearing"
+)
+
+// Типы операций, по которым формируются проводки
+const (
+	OperationTransfer           = "transfer"
+	OperationDepositOpen        = "deposit_open"
+	OperationDepositPayout      = "deposit_payout"
+	OperationDepositAccrual     = "deposit_interest_accrual"
+	OperationDepositCapitalize  = "deposit_interest_capitalization"
+	OperationDepositInterest    = "deposit_interest_payout"
+	OperationDepositEarlyClose  = "deposit_early_withdrawal"
+	OperationDepositRollover    = "deposit_rollover"
+	OperationCreditDisbursement = "credit_disbursement"
+	OperationCreditRepayment    = "credit_repayment"
+	OperationCreditPrepayment   = "credit_prepayment"
+	OperationBalanceAdjustment  = "balance_adjustment"
+	OperationOpeningBalance     = "opening_balance"
+)
+
+// LedgerJournal объединяет сбалансированный набор записей одной операции
+type LedgerJournal struct {
+	ID          int64     `db:"id" json:"id"`
+	Operation   string    `db:"operation" json:"operation"`
+	ReferenceID *int      `db:"reference_id" json:"reference_id"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	Entries     []Entry   `db:"-" json:"entries"`
+}
+
+// Posting - одна сторона проводки: либо счёт клиента (AccountID), либо системный счёт (SystemAccount).
+// ExchangeRate заполняется для записей конвертации
+type Posting struct {
+	AccountID     int
+	SystemAccount string
+	Amount        Money
+	Currency      string
+	ExchangeRate  *float64
+}
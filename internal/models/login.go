@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// По чему считаются неудачные попытки входа
+const (
+	LoginScopeUser = "user"
+	LoginScopeIP   = "ip"
+)
+
+// Счётчик неудачных попыток входа для пользователя (subject - ID) или адреса клиента (subject - IP).
+// Время хранится в UTC
+type LoginFailure struct {
+	Scope        string     `db:"scope" json:"scope"`
+	Subject      string     `db:"subject" json:"subject"`
+	FailedCount  int        `db:"failed_count" json:"failed_count"`
+	LastFailedAt time.Time  `db:"last_failed_at" json:"last_failed_at"`
+	LockedUntil  *time.Time `db:"locked_until" json:"locked_until,omitempty"`
+}
@@ -0,0 +1,47 @@
+package models
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money - денежная сумма в минимальных единицах валюты (центы, копейки и т.д.).
+// В БД и JSON всегда хранится целым числом, в основную единицу переводится только при форматировании
+type Money int64
+
+// Перевести сумму в основных единицах (например 12.34 USD) в минимальные единицы с округлением
+func MoneyFromMajor(major float64, minorUnits int) Money {
+	return Money(math.Round(major * math.Pow10(minorUnits)))
+}
+
+// Пересчитать сумму по курсу с учётом разной точности валют, округление половины от нуля
+func (m Money) Convert(rate float64, fromMinorUnits, toMinorUnits int) Money {
+	return Money(math.Round(float64(m) * rate * math.Pow10(toMinorUnits-fromMinorUnits)))
+}
+
+// Умножить на коэффициент (например, процентную ставку) с округлением до минимальной единицы
+func (m Money) MulRound(factor float64) Money {
+	return Money(math.Round(float64(m) * factor))
+}
+
+// Отформатировать сумму с точностью валюты, например "-1234.50"
+func (m Money) Format(minorUnits int) string {
+	sign := ""
+	value := int64(m)
+	if value < 0 {
+		sign = "-"
+		value = -value
+	}
+
+	if minorUnits <= 0 {
+		return sign + strconv.FormatInt(value, 10)
+	}
+
+	digits := strconv.FormatInt(value, 10)
+	if len(digits) <= minorUnits {
+		digits = strings.Repeat("0", minorUnits-len(digits)+1) + digits
+	}
+	point := len(digits) - minorUnits
+	return sign + digits[:point] + "." + digits[point:]
+}
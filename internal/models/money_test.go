@@ -0,0 +1,80 @@
+package models
+
+import "testing"
+
+func TestMoneyConvert(t *testing.T) {
+	tests := []struct {
+		name           string
+		amount         Money
+		rate           float64
+		fromMinorUnits int
+		toMinorUnits   int
+		want           Money
+	}{
+		{name: "same precision", amount: 10000, rate: 0.92, fromMinorUnits: 2, toMinorUnits: 2, want: 9200},
+		{name: "to zero decimals", amount: 10000, rate: 150.5, fromMinorUnits: 2, toMinorUnits: 0, want: 15050},
+		{name: "from zero decimals", amount: 15050, rate: 1 / 150.5, fromMinorUnits: 0, toMinorUnits: 2, want: 10000},
+		{name: "to three decimals", amount: 12345, rate: 0.383, fromMinorUnits: 2, toMinorUnits: 3, want: 47281},
+		{name: "half rounds away from zero", amount: 1, rate: 0.5, fromMinorUnits: 2, toMinorUnits: 2, want: 1},
+		{name: "negative half rounds away from zero", amount: -1, rate: 0.5, fromMinorUnits: 2, toMinorUnits: 2, want: -1},
+		{name: "below half rounds down", amount: 1, rate: 0.49, fromMinorUnits: 2, toMinorUnits: 2, want: 0},
+		{name: "zero", amount: 0, rate: 1.2345, fromMinorUnits: 2, toMinorUnits: 2, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.amount.Convert(tt.rate, tt.fromMinorUnits, tt.toMinorUnits)
+			if got != tt.want {
+				t.Errorf("Money(%d).Convert(%v, %d, %d) = %d, want %d",
+					tt.amount, tt.rate, tt.fromMinorUnits, tt.toMinorUnits, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyFormat(t *testing.T) {
+	tests := []struct {
+		amount     Money
+		minorUnits int
+		want       string
+	}{
+		{amount: 123450, minorUnits: 2, want: "1234.50"},
+		{amount: -123450, minorUnits: 2, want: "-1234.50"},
+		{amount: 5, minorUnits: 2, want: "0.05"},
+		{amount: -5, minorUnits: 2, want: "-0.05"},
+		{amount: 50, minorUnits: 2, want: "0.50"},
+		{amount: 0, minorUnits: 2, want: "0.00"},
+		{amount: 1500, minorUnits: 0, want: "1500"},
+		{amount: -1500, minorUnits: 0, want: "-1500"},
+		{amount: 1234, minorUnits: 3, want: "1.234"},
+		{amount: 7, minorUnits: 3, want: "0.007"},
+	}
+
+	for _, tt := range tests {
+		got := tt.amount.Format(tt.minorUnits)
+		if got != tt.want {
+			t.Errorf("Money(%d).Format(%d) = %q, want %q", tt.amount, tt.minorUnits, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyFromMajor(t *testing.T) {
+	tests := []struct {
+		major      float64
+		minorUnits int
+		want       Money
+	}{
+		{major: 12.34, minorUnits: 2, want: 1234},
+		{major: 0.1 + 0.2, minorUnits: 2, want: 30},
+		{major: 1000000, minorUnits: 0, want: 1000000},
+		{major: 1.2345, minorUnits: 3, want: 1235},
+		{major: -2.5, minorUnits: 2, want: -250},
+	}
+
+	for _, tt := range tests {
+		got := MoneyFromMajor(tt.major, tt.minorUnits)
+		if got != tt.want {
+			t.Errorf("MoneyFromMajor(%v, %d) = %d, want %d", tt.major, tt.minorUnits, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package models
+
+// Параметры страницы списка из query: limit, cursor, sort (имя поля, "-" в начале - по убыванию)
+// и фильтры filter[поле]=значение
+type PageParams struct {
+	Limit   int
+	Cursor  string
+	Sort    string
+	Filters map[string]string
+}
+
+// Страница списка. NextCursor пустой на последней странице
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"next_cursor"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Запрос на сброс пароля. В БД хранится только хеш токена, время - в UTC
+type PasswordReset struct {
+	ID        int        `db:"id"`
+	UserID    int        `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Кредитный портфель одной валюты в разрезе корзин просрочки
+type PortfolioAtRiskLine struct {
+	Currency    string           `json:"currency"`
+	Credits     int              `json:"credits"`
+	Outstanding Money            `json:"outstanding"`
+	Buckets     map[string]Money `json:"buckets"`
+	PAR30       float64          `json:"par30"`
+	PAR60       float64          `json:"par60"`
+	PAR90       float64          `json:"par90"`
+}
+
+// Строка агрегата портфеля из БД
+type PortfolioBucket struct {
+	Currency    string `db:"currency"`
+	Bucket      string `db:"delinquency_bucket"`
+	Credits     int    `db:"credits"`
+	Outstanding Money  `db:"outstanding"`
+}
+
+type PortfolioAtRiskReport struct {
+	GeneratedAt time.Time             `json:"generated_at"`
+	Currencies  []PortfolioAtRiskLine `json:"currencies"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Расхождение между балансом счёта и суммой его записей в журнале
+type ReconciliationLine struct {
+	AccountID     int    `db:"account_id" json:"account_id"`
+	UserID        int    `db:"user_id" json:"user_id"`
+	Currency      string `db:"currency" json:"currency"`
+	Balance       Money  `db:"balance" json:"balance"`
+	LedgerBalance Money  `db:"ledger_balance" json:"ledger_balance"`
+	Drift         Money  `db:"-" json:"drift"`
+}
+
+type ReconciliationReport struct {
+	GeneratedAt        time.Time            `json:"generated_at"`
+	AccountsChecked    int                  `json:"accounts_checked"`
+	Drifts             []ReconciliationLine `json:"drifts"`
+	DriftByCurrency    map[string]Money     `json:"drift_by_currency"`
+	UnbalancedJournals []int64              `json:"unbalanced_journals"`
+	Balanced           bool                 `json:"balanced"`
+}
@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Роли пользователей
+const (
+	RoleCustomer = "customer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+	RoleAuditor  = "auditor"
+)
+
+// Разрешения. Клиент без разрешений работает только со своими данными,
+// разрешения *.read и *.manage открывают доступ к данным других пользователей
+const (
+	PermUsersRead      = "users.read"
+	PermUsersManage    = "users.manage"
+	PermAccountsRead   = "accounts.read"
+	PermAccountsManage = "accounts.manage"
+	PermCreditsRead    = "credits.read"
+	PermCreditsDecide  = "credits.decide"
+	PermDepositsRead   = "deposits.read"
+	PermDepositsManage = "deposits.manage"
+	PermProductsManage = "products.manage"
+	PermCurrencyManage = "currencies.manage"
+	PermReportsRead    = "reports.read"
+	PermRolesManage    = "roles.manage"
+)
+
+// Роль вместе с её разрешениями
+type Role struct {
+	Name        string   `db:"name" json:"name"`
+	Description string   `db:"description" json:"description"`
+	Permissions []string `db:"-" json:"permissions"`
+}
+
+// Роль, выданная пользователю
+type UserRole struct {
+	UserID    int       `db:"user_id" json:"user_id"`
+	Role      string    `db:"role" json:"role"`
+	GrantedBy *int      `db:"granted_by" json:"granted_by"`
+	GrantedAt time.Time `db:"granted_at" json:"granted_at"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Алгоритмы подписи access-токенов
+const (
+	SigningAlgorithmEdDSA = "EdDSA"
+	SigningAlgorithmRS256 = "RS256"
+)
+
+// Ключ подписи токенов. Закрытый ключ хранится в PKCS#8, зашифрованный (encrypted), открытый в PKIX (DER).
+// Новый ключ сразу публикуется в JWKS, а подписывать начинает с activates_at.
+// После retired_at ключом больше не подписывают, но до expires_at он публикуется в JWKS для проверки
+type SigningKey struct {
+	KID         string     `db:"kid"`
+	Algorithm   string     `db:"algorithm"`
+	PrivateKey  []byte     `db:"private_key"`
+	PublicKey   []byte     `db:"public_key"`
+	Encrypted   bool       `db:"encrypted"`
+	CreatedAt   time.Time  `db:"created_at"`
+	ActivatesAt time.Time  `db:"activates_at"`
+	RetiredAt   *time.Time `db:"retired_at"`
+	ExpiresAt   *time.Time `db:"expires_at"`
+}
+
+// Открытый ключ в формате JWK (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// Набор открытых ключей для /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
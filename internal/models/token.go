@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Токены, выдаваемые при входе и при обновлении
+type TokenPair struct {
+	AccessToken      string    `json:"access_token"`
+	AccessExpiresAt  time.Time `json:"access_expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// Refresh-токен. В БД хранится только SHA-256 хеш, все токены одного входа связаны session_id.
+// Сроки хранятся в UTC и сравниваются с текущим временем в UTC
+type RefreshToken struct {
+	ID         int        `db:"id"`
+	UserID     int        `db:"user_id"`
+	SessionID  string     `db:"session_id"`
+	TokenHash  string     `db:"token_hash"`
+	CreatedAt  time.Time  `db:"created_at"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+	ReplacedBy *int       `db:"replaced_by"`
+}
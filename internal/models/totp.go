@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Второй фактор пользователя. Пока confirmed_at пуст, подключение не завершено и при входе не проверяется.
+// last_step - последний принятый интервал TOTP, один и тот же код нельзя использовать дважды
+type UserTOTP struct {
+	UserID      int        `db:"user_id"`
+	Secret      string     `db:"secret"`
+	ConfirmedAt *time.Time `db:"confirmed_at"`
+	LastStep    int64      `db:"last_step"`
+	CreatedAt   time.Time  `db:"created_at"`
+	// Неверные коды подряд и блокировка проверки кодов после mfa_params.max_failures ошибок (UTC)
+	FailedAttempts int        `db:"failed_attempts"`
+	LockedUntil    *time.Time `db:"locked_until"`
+}
+
+// Данные для подключения приложения-аутентификатора
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// Вход, ожидающий код второго фактора. В БД хранится только хеш токена
+type MFAChallenge struct {
+	ID        int        `db:"id"`
+	UserID    int        `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	Attempts  int        `db:"attempts"`
+	UsedAt    *time.Time `db:"used_at"`
+}
+
+// Результат проверки пароля: токены или, если подключён второй фактор, токен для второго шага входа
+type SignInResult struct {
+	User         *User      `json:"user"`
+	Tokens       *TokenPair `json:"tokens,omitempty"`
+	MFARequired  bool       `json:"mfa_required"`
+	MFAToken     string     `json:"mfa_token,omitempty"`
+	MFAExpiresAt *time.Time `json:"mfa_expires_at,omitempty"`
+}
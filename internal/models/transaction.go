@@ -6,8 +6,11 @@ type Transfer struct {
 	ID            int       `db:"id"`
 	FromAccountID int       `db:"from_account_id"`
 	ToAccountID   int       `db:"to_account_id"`
-	Amount        int       `db:"amount"`
+	Amount        Money     `db:"amount"`
 	Currency      string    `db:"currency"`
+	ToAmount      Money     `db:"to_amount"`
+	ToCurrency    string    `db:"to_currency"`
+	ExchangeRate  float64   `db:"exchange_rate"`
 	CreatedAt     time.Time `db:"created_at"`
 }
 
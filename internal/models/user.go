@@ -5,6 +5,7 @@ import "time"
 type User struct {
 	ID        int        `db:"id"`
 	FullName  string     `db:"full_name"`
+	Username  string     `db:"username"`
 	Password  string     `db:"password" json:"-"`
 	CreatedAt time.Time  `db:"created_at"`
 	UpdatedAt *time.Time `db:"updated_at"`
@@ -16,4 +17,6 @@ type UpdateUser struct {
 	ID       int     `json:"id"`
 	FullName *string `json:"full_name"`
 	Password *string `json:"password"`
+	// Текущий пароль, обязателен для смены пароля
+	CurrentPassword *string `json:"current_password"`
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Одноразовый код подтверждения почты или телефона. target - значение идентификатора на момент отправки:
+// если пользователь успел его сменить, код не подтвердит новое значение. В БД хранится только хеш кода
+type VerificationCode struct {
+	ID        int        `db:"id"`
+	UserID    int        `db:"user_id"`
+	Kind      string     `db:"kind"`
+	Target    string     `db:"target"`
+	CodeHash  string     `db:"code_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	Attempts  int        `db:"attempts"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
+}
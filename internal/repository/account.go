@@ -2,26 +2,31 @@ package repository
 
 import (
 	"SB/internal/db"
+	"SB/internal/errs"
 	"SB/internal/models"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
-// Создать аккаунт
-func CreateAccount(account *models.Account) error {
-	err := db.GetDBConn().QueryRow(`
-		INSERT INTO accounts (user_id, currency, phone_number)
-		VALUES ($1, $2, $3) RETURNING id`,
-		account.UserID, account.Currency, account.PhoneNumber).Scan(&account.ID)
-	return err
+// Создать аккаунт в рамках транзакции
+func CreateAccount(tx *sqlx.Tx, account *models.Account) error {
+	err := tx.QueryRow(`
+		INSERT INTO accounts (user_id, currency, phone_number, purpose)
+		VALUES ($1, $2, $3, $4) RETURNING id`,
+		account.UserID, account.Currency, account.PhoneNumber, account.Purpose).Scan(&account.ID)
+	return translateAccountError(err)
 }
 
-// Изменить аккаунт (только если active = true)
-func UpdateAccount(account *models.Account) error {
-	_, err := db.GetDBConn().Exec(`
+// Изменить аккаунт в рамках транзакции (только если active = true).
+// Баланс здесь не меняется - для этого есть проводки журнала (PostJournal)
+func UpdateAccount(tx *sqlx.Tx, account *models.Account) error {
+	_, err := tx.Exec(`
 		UPDATE accounts
-		SET balance = $1, currency = $2, updated_at = CURRENT_TIMESTAMP, phone_number = $3
-		WHERE id = $4 AND active = TRUE AND deleted_at IS NULL`,
-		account.Balance, account.Currency, account.PhoneNumber, account.ID)
-	return err
+		SET currency = $1, updated_at = CURRENT_TIMESTAMP, phone_number = $2
+		WHERE id = $3 AND active = TRUE AND deleted_at IS NULL`,
+		account.Currency, account.PhoneNumber, account.ID)
+	return translateAccountError(err)
 }
 
 // Мягкое удаление аккаунта (deleted_at = now)
@@ -37,39 +42,91 @@ func DeleteAccount(id int) error {
 func GetAccountByID(id int) (models.Account, error) {
 	var account models.Account
 	err := db.GetDBConn().Get(&account, `
-		SELECT id, user_id, phone_number, balance, currency, active, created_at, updated_at, deleted_at
+		SELECT id, user_id, phone_number, balance, currency, purpose, active, created_at, updated_at, deleted_at
 		FROM accounts
 		WHERE id = $1 AND active = TRUE AND deleted_at IS NULL`, id)
 	return account, err
 }
 
-// Взять все аккаунты пользователя по user_id (только если active = true)
-func GetAccountsByUserID(userID int) (*models.Account, error) {
+// Взять аккаунт по ID с блокировкой строки до конца транзакции (только если active = true)
+func GetAccountByIDForUpdate(tx *sqlx.Tx, id int) (models.Account, error) {
 	var account models.Account
-	err := db.GetDBConn().Get(&account, `
-		SELECT id, user_id, phone_number, balance, currency, active, created_at, updated_at, deleted_at
+	err := tx.Get(&account, `
+		SELECT id, user_id, phone_number, balance, currency, purpose, active, created_at, updated_at, deleted_at
 		FROM accounts
-		WHERE user_id = $1 AND active = TRUE AND deleted_at IS NULL 
-		LIMIT 1`, userID)
-	return &account, err
+		WHERE id = $1 AND active = TRUE AND deleted_at IS NULL
+		FOR UPDATE`, id)
+	return account, err
 }
 
-// Взять все неактивные аккаунты
-func GetInactiveAccounts() ([]models.Account, error) {
-	var accounts []models.Account
-	err := db.GetDBConn().Select(&accounts, `
-		SELECT id, user_id, phone_number, balance, currency, active, created_at, updated_at, deleted_at
-		FROM accounts
-		WHERE active = FALSE AND deleted_at IS NULL`)
-	return accounts, err
+// Число активных аккаунтов пользователя
+func CountUserAccounts(tx *sqlx.Tx, userID int) (int, error) {
+	var count int
+	err := tx.Get(&count, `
+		SELECT COUNT(*) FROM accounts
+		WHERE user_id = $1 AND active = TRUE AND deleted_at IS NULL`, userID)
+	return count, err
+}
+
+// Есть ли у пользователя неудалённый счёт в валюте с таким назначением
+func AccountExists(tx *sqlx.Tx, userID int, currency, purpose string) (bool, error) {
+	var exists bool
+	err := tx.Get(&exists, `
+		SELECT EXISTS (
+			SELECT 1 FROM accounts
+			WHERE user_id = $1 AND currency = $2 AND purpose = $3 AND deleted_at IS NULL
+		)`, userID, currency, purpose)
+	return exists, err
 }
 
-// Взять аккаунты по валюте (только если active = true)
-func GetAccountsByCurrency(currency string) ([]models.Account, error) {
+// Взять все аккаунты пользователя по user_id (только если active = true)
+func GetAccountsByUserID(userID int) ([]models.Account, error) {
 	var accounts []models.Account
 	err := db.GetDBConn().Select(&accounts, `
-		SELECT id, user_id, balance, currency, active, created_at, updated_at, deleted_at
+		SELECT id, user_id, phone_number, balance, currency, purpose, active, created_at, updated_at, deleted_at
 		FROM accounts
-		WHERE currency = $1 AND active = TRUE AND deleted_at IS NULL`, currency)
+		WHERE user_id = $1 AND active = TRUE AND deleted_at IS NULL 
+		ORDER BY id`, userID)
 	return accounts, err
 }
+
+// Списки аккаунтов: сортировка по id, дате создания или балансу, фильтры по пользователю, валюте и назначению
+var accountListSpec = listSpec[models.Account]{
+	columns: `id, user_id, phone_number, balance, currency, purpose, active, created_at, updated_at, deleted_at`,
+	from:    "accounts",
+	id:      func(account models.Account) int { return account.ID },
+	sorts: map[string]sortField[models.Account]{
+		"id":         {column: "id", value: func(account models.Account) string { return sortInt(account.ID) }},
+		"created_at": {column: "created_at", value: func(account models.Account) string { return sortTime(account.CreatedAt) }},
+		"balance":    {column: "balance", value: func(account models.Account) string { return sortMoney(account.Balance) }},
+	},
+	filters: map[string]filterField{
+		"user_id":  {column: "user_id", parse: filterInt},
+		"currency": {column: "currency", parse: filterString},
+		"purpose":  {column: "purpose", parse: filterString},
+	},
+}
+
+// Страница аккаунтов пользователя (только если active = true)
+func GetAccountsPageByUserID(userID int, page models.PageParams) (models.Page[models.Account], error) {
+	return selectPage(accountListSpec, "user_id = $1 AND active = TRUE AND deleted_at IS NULL", []any{userID}, page)
+}
+
+// Страница неактивных аккаунтов
+func GetInactiveAccounts(page models.PageParams) (models.Page[models.Account], error) {
+	return selectPage(accountListSpec, "active = FALSE AND deleted_at IS NULL", nil, page)
+}
+
+// Страница аккаунтов по валюте (только если active = true)
+func GetAccountsByCurrency(currency string, page models.PageParams) (models.Page[models.Account], error) {
+	return selectPage(accountListSpec, "currency = $1 AND active = TRUE AND deleted_at IS NULL", []any{currency}, page)
+}
+
+// Нарушение уникального индекса accounts_user_currency_purpose_key - счёт в этой валюте и с этим назначением уже есть
+func translateAccountError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return errs.ErrAccountAlreadyExists
+	}
+	return err
+}
@@ -7,3 +7,10 @@ func WriteAuditLog(action, entity string, entityID, userID int) error {
 		action, entity, entityID, userID)
 	return err
 }
+
+// Запись аудита с пояснением, например адресом клиента
+func WriteAuditLogDetails(action, entity string, entityID, userID int, details string) error {
+	_, err := db.GetDBConn().Exec(`INSERT INTO audit_logs (action, entity, entity_id, user_id, details) VALUES ($1, $2, $3, $4, $5)`,
+		action, entity, entityID, userID, details)
+	return err
+}
@@ -4,22 +4,28 @@ import (
 	"SB/internal/db"
 	"SB/internal/errs"
 	"SB/internal/models"
+	"github.com/jmoiron/sqlx"
+	"time"
 )
 
-// Создать кредит
-func CreateCredit(credit *models.Credit) (int, error) {
+const creditColumns = `id, user_id, account_id, amount, outstanding, currency, duration_months, interest_rate, status,
+		days_past_due, delinquency_bucket, rejection_reason, decided_by, created_at, approved_at, disbursed_at, updated_at, active`
+
+// Создать кредит (заявку) в рамках транзакции
+func CreateCredit(tx *sqlx.Tx, credit *models.Credit) (int, error) {
 	var id int
-	err := db.GetDBConn().QueryRow(`
-		INSERT INTO credits (user_id, amount, currency, duration_months, interest_rate, active, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, CURRENT_TIMESTAMP) RETURNING id`,
-		credit.UserID, credit.Amount, credit.Currency, credit.DurationMonths, credit.InterestRate, credit.Active).Scan(&id)
+	err := tx.QueryRow(`
+		INSERT INTO credits (user_id, account_id, amount, currency, duration_months, interest_rate, status, active, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CURRENT_TIMESTAMP) RETURNING id`,
+		credit.UserID, credit.AccountID, credit.Amount, credit.Currency, credit.DurationMonths, credit.InterestRate,
+		credit.Status, credit.Active).Scan(&id)
 	return id, err
 }
 
-// Изменить кредит (только если active = true)
+// Изменить кредит (только если active = true и заявка ещё не рассмотрена)
 func UpdateCredit(credit *models.Credit) error {
 	var active bool
-	err := db.GetDBConn().Get(&active, `SELECT active FROM credits WHERE id = $1 AND approved_at IS NULL`, credit.ID)
+	err := db.GetDBConn().Get(&active, `SELECT active FROM credits WHERE id = $1 AND status = 'pending'`, credit.ID)
 	if err != nil {
 		return err
 	}
@@ -35,52 +41,146 @@ func UpdateCredit(credit *models.Credit) error {
 	return err
 }
 
-// Взять кредит по ID (только если active = true)
+// Взять кредит по ID (в любом статусе)
 func GetCreditByID(id int) (models.Credit, error) {
 	var credit models.Credit
 	err := db.GetDBConn().Get(&credit, `
-		SELECT id, user_id, amount, currency, duration_months, interest_rate, created_at, approved_at, active
+		SELECT `+creditColumns+`
 		FROM credits
-		WHERE id = $1 AND active = TRUE`, id)
+		WHERE id = $1`, id)
 	return credit, err
 }
 
-// Взять кредиты по user_id (только если active = true)
-func GetCreditsByUserID(userID int) ([]models.Credit, error) {
-	var credits []models.Credit
-	err := db.GetDBConn().Select(&credits, `
-		SELECT id, user_id, amount, currency, duration_months, interest_rate, created_at, approved_at, active
+// Взять кредит по ID с блокировкой строки до конца транзакции
+func GetCreditByIDForUpdate(tx *sqlx.Tx, id int) (models.Credit, error) {
+	var credit models.Credit
+	err := tx.Get(&credit, `
+		SELECT `+creditColumns+`
 		FROM credits
-		WHERE user_id = $1 AND active = TRUE`, userID)
-	return credits, err
+		WHERE id = $1
+		FOR UPDATE`, id)
+	return credit, err
 }
 
-// Взять все кредиты с active = true
-func GetActiveCredits() ([]models.Credit, error) {
+// Взять кредиты по user_id (во всех статусах)
+func GetCreditsByUserID(userID int) ([]models.Credit, error) {
 	var credits []models.Credit
 	err := db.GetDBConn().Select(&credits, `
-		SELECT id, user_id, amount, currency, duration_months, interest_rate, created_at, approved_at, active
+		SELECT `+creditColumns+`
 		FROM credits
-		WHERE active = TRUE`)
+		WHERE user_id = $1
+		ORDER BY id`, userID)
 	return credits, err
 }
 
-// Взять все кредиты с active = false
-func GetInactiveCredits() ([]models.Credit, error) {
-	var credits []models.Credit
-	err := db.GetDBConn().Select(&credits, `
-		SELECT id, user_id, amount, currency, duration_months, interest_rate, created_at, approved_at, active
-		FROM credits
-		WHERE active = FALSE`)
-	return credits, err
+// Списки кредитов: сортировка по id, дате заявки, сумме, остатку долга или просрочке,
+// фильтры по пользователю, валюте, статусу и корзине просрочки
+var creditListSpec = listSpec[models.Credit]{
+	columns: creditColumns,
+	from:    "credits",
+	id:      func(credit models.Credit) int { return credit.ID },
+	sorts: map[string]sortField[models.Credit]{
+		"id":            {column: "id", value: func(credit models.Credit) string { return sortInt(credit.ID) }},
+		"created_at":    {column: "created_at", value: func(credit models.Credit) string { return sortTime(credit.CreatedAt) }},
+		"amount":        {column: "amount", value: func(credit models.Credit) string { return sortMoney(credit.Amount) }},
+		"outstanding":   {column: "outstanding", value: func(credit models.Credit) string { return sortMoney(credit.Outstanding) }},
+		"days_past_due": {column: "days_past_due", value: func(credit models.Credit) string { return sortInt(credit.DaysPastDue) }},
+	},
+	filters: map[string]filterField{
+		"user_id":            {column: "user_id", parse: filterInt},
+		"currency":           {column: "currency", parse: filterString},
+		"status":             {column: "status", parse: filterString},
+		"delinquency_bucket": {column: "delinquency_bucket", parse: filterString},
+	},
 }
 
-// Взять кредиты по валюте (currency) (только если active = true)
-func GetCreditsByCurrency(currency string) ([]models.Credit, error) {
-	var credits []models.Credit
-	err := db.GetDBConn().Select(&credits, `
-		SELECT id, user_id, amount, currency, duration_months, interest_rate, created_at, approved_at, active
+// Страница кредитов пользователя (во всех статусах)
+func GetCreditsPageByUserID(userID int, page models.PageParams) (models.Page[models.Credit], error) {
+	return selectPage(creditListSpec, "user_id = $1", []any{userID}, page)
+}
+
+// Страница кредитов в статусе status
+func GetCreditsByStatus(status string, page models.PageParams) (models.Page[models.Credit], error) {
+	return selectPage(creditListSpec, "status = $1", []any{status}, page)
+}
+
+// Страница кредитов с active = true
+func GetActiveCredits(page models.PageParams) (models.Page[models.Credit], error) {
+	return selectPage(creditListSpec, "active = TRUE", nil, page)
+}
+
+// Страница кредитов с active = false
+func GetInactiveCredits(page models.PageParams) (models.Page[models.Credit], error) {
+	return selectPage(creditListSpec, "active = FALSE", nil, page)
+}
+
+// Страница кредитов по валюте (currency) (только если active = true)
+func GetCreditsByCurrency(currency string, page models.PageParams) (models.Page[models.Credit], error) {
+	return selectPage(creditListSpec, "currency = $1 AND active = TRUE", []any{currency}, page)
+}
+
+// Сохранить изменения кредита, сделанные в рамках жизненного цикла
+func SaveCreditState(tx *sqlx.Tx, credit *models.Credit) error {
+	_, err := tx.Exec(`
+		UPDATE credits
+		SET account_id = $1, outstanding = $2, status = $3, rejection_reason = $4, decided_by = $5,
+		    approved_at = $6, disbursed_at = $7, active = $8, days_past_due = $9, delinquency_bucket = $10,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = $11`,
+		credit.AccountID, credit.Outstanding, credit.Status, credit.RejectionReason, credit.DecidedBy,
+		credit.ApprovedAt, credit.DisbursedAt, credit.Active, credit.DaysPastDue, credit.DelinquencyBucket, credit.ID)
+	return err
+}
+
+// Записать смену статуса кредита в историю и в журнал аудита
+func WriteCreditStatusChange(tx *sqlx.Tx, change *models.CreditStatusChange) error {
+	err := tx.QueryRow(`
+		INSERT INTO credit_status_history (credit_id, from_status, to_status, reason, changed_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		change.CreditID, change.FromStatus, change.ToStatus, change.Reason, change.ChangedBy).Scan(&change.ID, &change.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO audit_logs (action, entity, entity_id, user_id) VALUES ($1, $2, $3, $4)`,
+		"credit_"+change.ToStatus, "credit", change.CreditID, change.ChangedBy)
+	return err
+}
+
+// История статусов кредита
+func GetCreditStatusHistory(creditID int) ([]models.CreditStatusChange, error) {
+	var history []models.CreditStatusChange
+	err := db.GetDBConn().Select(&history, `
+		SELECT id, credit_id, from_status, to_status, reason, changed_by, created_at
+		FROM credit_status_history
+		WHERE credit_id = $1
+		ORDER BY id`, creditID)
+	return history, err
+}
+
+// Кредиты, у которых есть просроченные платежи или ещё не сброшена просрочка
+func GetCreditIDsForDelinquencyCheck(today time.Time) ([]int, error) {
+	var ids []int
+	err := db.GetDBConn().Select(&ids, `
+		SELECT c.id
+		FROM credits c
+		WHERE c.status IN ('disbursed', 'defaulted')
+		  AND (c.days_past_due > 0 OR EXISTS (
+		      SELECT 1 FROM credit_installments i
+		      WHERE i.credit_id = c.id AND i.status <> 'paid' AND i.due_date < $1))
+		ORDER BY c.id`, today)
+	return ids, err
+}
+
+// Остаток выданных кредитов по валютам и корзинам просрочки
+func GetPortfolioBuckets() ([]models.PortfolioBucket, error) {
+	var buckets []models.PortfolioBucket
+	err := db.GetDBConn().Select(&buckets, `
+		SELECT currency, delinquency_bucket, COUNT(*) AS credits, COALESCE(SUM(outstanding), 0) AS outstanding
 		FROM credits
-		WHERE currency = $1 AND active = TRUE`, currency)
-	return credits, err
+		WHERE status IN ('disbursed', 'defaulted')
+		GROUP BY currency, delinquency_bucket
+		ORDER BY currency, delinquency_bucket`)
+	return buckets, err
 }
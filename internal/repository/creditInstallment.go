@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"SB/internal/db"
+	"SB/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+const creditInstallmentColumns = `id, credit_id, number, due_date, payment, principal, interest, principal_paid, interest_paid,
+		penalty, penalty_paid, penalty_accrued_on, balance, status, paid_at`
+
+// Сохранить график платежей кредита
+func CreateCreditInstallments(tx *sqlx.Tx, installments []models.CreditInstallment) error {
+	for i := range installments {
+		inst := &installments[i]
+		err := tx.QueryRow(`
+			INSERT INTO credit_installments (credit_id, number, due_date, payment, principal, interest,
+			                                 principal_paid, interest_paid, balance, status, paid_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			RETURNING id`,
+			inst.CreditID, inst.Number, inst.DueDate, inst.Payment, inst.Principal, inst.Interest,
+			inst.PrincipalPaid, inst.InterestPaid, inst.Balance, inst.Status, inst.PaidAt).Scan(&inst.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Взять график платежей кредита
+func GetCreditInstallments(creditID int) ([]models.CreditInstallment, error) {
+	var installments []models.CreditInstallment
+	err := db.GetDBConn().Select(&installments, `
+		SELECT `+creditInstallmentColumns+`
+		FROM credit_installments
+		WHERE credit_id = $1
+		ORDER BY number`, creditID)
+	return installments, err
+}
+
+// Взять неоплаченные платежи кредита с блокировкой строк до конца транзакции
+func GetOpenCreditInstallmentsForUpdate(tx *sqlx.Tx, creditID int) ([]models.CreditInstallment, error) {
+	var installments []models.CreditInstallment
+	err := tx.Select(&installments, `
+		SELECT `+creditInstallmentColumns+`
+		FROM credit_installments
+		WHERE credit_id = $1 AND status <> 'paid'
+		ORDER BY number
+		FOR UPDATE`, creditID)
+	return installments, err
+}
+
+// Взять весь график кредита с блокировкой строк до конца транзакции
+func GetCreditInstallmentsForUpdate(tx *sqlx.Tx, creditID int) ([]models.CreditInstallment, error) {
+	var installments []models.CreditInstallment
+	err := tx.Select(&installments, `
+		SELECT `+creditInstallmentColumns+`
+		FROM credit_installments
+		WHERE credit_id = $1
+		ORDER BY number
+		FOR UPDATE`, creditID)
+	return installments, err
+}
+
+// Сохранить платёж графика: суммы, оплату, неустойку и статус
+func SaveCreditInstallment(tx *sqlx.Tx, inst *models.CreditInstallment) error {
+	_, err := tx.Exec(`
+		UPDATE credit_installments
+		SET due_date = $1, payment = $2, principal = $3, interest = $4, balance = $5,
+		    principal_paid = $6, interest_paid = $7, penalty = $8, penalty_paid = $9, penalty_accrued_on = $10,
+		    status = $11, paid_at = $12
+		WHERE id = $13`,
+		inst.DueDate, inst.Payment, inst.Principal, inst.Interest, inst.Balance,
+		inst.PrincipalPaid, inst.InterestPaid, inst.Penalty, inst.PenaltyPaid, inst.PenaltyAccruedOn,
+		inst.Status, inst.PaidAt, inst.ID)
+	return err
+}
+
+// Удалить платежи графика после указанного номера (при пересчёте графика).
+// Уже уплаченное по ним вызывающий переносит в новый график
+func DeleteCreditInstallmentsAfter(tx *sqlx.Tx, creditID int, number int) error {
+	_, err := tx.Exec(`DELETE FROM credit_installments WHERE credit_id = $1 AND number > $2`, creditID, number)
+	return err
+}
@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"SB/internal/db"
+	"SB/internal/models"
+	"database/sql"
+	"errors"
+)
+
+// Взять весь справочник валют
+func GetCurrencies() ([]models.Currency, error) {
+	var currencies []models.Currency
+	err := db.GetDBConn().Select(&currencies, `
+		SELECT code, numeric_code, name, minor_units, enabled
+		FROM currencies
+		ORDER BY code`)
+	return currencies, err
+}
+
+// Точность валюты из справочника. Для новой валюты found = false
+func GetCurrencyMinorUnits(code string) (minorUnits int, found bool, err error) {
+	err = db.GetDBConn().Get(&minorUnits, `SELECT minor_units FROM currencies WHERE code = $1`, code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	return minorUnits, err == nil, err
+}
+
+// Хранятся ли где-то суммы в этой валюте: счета, проводки, переводы, депозиты, продукты депозитов или кредиты
+func IsCurrencyInUse(code string) (bool, error) {
+	var inUse bool
+	err := db.GetDBConn().Get(&inUse, `
+		SELECT EXISTS (SELECT 1 FROM accounts WHERE currency = $1)
+		    OR EXISTS (SELECT 1 FROM entries WHERE currency = $1)
+		    OR EXISTS (SELECT 1 FROM transactions WHERE currency = $1 OR to_currency = $1)
+		    OR EXISTS (SELECT 1 FROM deposits WHERE currency = $1)
+		    OR EXISTS (SELECT 1 FROM deposit_products WHERE currency = $1)
+		    OR EXISTS (SELECT 1 FROM credits WHERE currency = $1)`, code)
+	return inUse, err
+}
+
+// Добавить валюту или изменить существующую
+func UpsertCurrency(currency *models.Currency) error {
+	_, err := db.GetDBConn().Exec(`
+		INSERT INTO currencies (code, numeric_code, name, minor_units, enabled)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (code) DO UPDATE
+		SET numeric_code = EXCLUDED.numeric_code, name = EXCLUDED.name,
+		    minor_units = EXCLUDED.minor_units, enabled = EXCLUDED.enabled`,
+		currency.Code, currency.NumericCode, currency.Name, currency.MinorUnits, currency.Enabled)
+	return err
+}
@@ -3,17 +3,42 @@ package repository
 import (
 	"SB/internal/db"
 	"SB/internal/models"
+	"github.com/jmoiron/sqlx"
+	"time"
 )
 
+const depositColumns = `id, user_id, product_id, amount, currency, interest_rate, duration_months, created_at, expires_at, active,
+		compounding, day_count, payout_account_id, capitalized_interest, paid_interest, accrued_interest,
+		interest_period_start, accrued_until, early_withdrawal, early_withdrawal_rate, maturity_instruction, rolled_over_from`
+
 // Создать депозит
 func CreateDeposit(deposit *models.Deposit) (int, error) {
 	var id int
 	err := db.GetDBConn().QueryRow(`
-		INSERT INTO deposits (user_id, amount, currency, interest_rate, duration_months, expires_at, active, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, CURRENT_TIMESTAMP)
+		INSERT INTO deposits (user_id, product_id, amount, currency, interest_rate, duration_months, expires_at, active,
+		                      compounding, day_count, payout_account_id, early_withdrawal, early_withdrawal_rate,
+		                      maturity_instruction, interest_period_start, accrued_until, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, CURRENT_DATE, CURRENT_DATE, CURRENT_TIMESTAMP)
+		RETURNING id`,
+		deposit.UserID, deposit.ProductID, deposit.Amount, deposit.Currency, deposit.InterestRate,
+		deposit.DurationMonths, deposit.ExpiresAt, deposit.Active, deposit.Compounding, deposit.DayCount,
+		deposit.PayoutAccountID, deposit.EarlyWithdrawal, deposit.EarlyWithdrawalRate, deposit.MaturityInstruction).Scan(&id)
+	return id, err
+}
+
+// Создать депозит в рамках транзакции
+func CreateDepositTx(tx *sqlx.Tx, deposit *models.Deposit) (int, error) {
+	var id int
+	err := tx.QueryRow(`
+		INSERT INTO deposits (user_id, product_id, amount, currency, interest_rate, duration_months, expires_at, active,
+		                      compounding, day_count, payout_account_id, early_withdrawal, early_withdrawal_rate,
+		                      maturity_instruction, rolled_over_from, interest_period_start, accrued_until, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
 		RETURNING id`,
-		deposit.UserID, deposit.Amount, deposit.Currency, deposit.InterestRate,
-		deposit.DurationMonths, deposit.ExpiresAt, deposit.Active).Scan(&id)
+		deposit.UserID, deposit.ProductID, deposit.Amount, deposit.Currency, deposit.InterestRate,
+		deposit.DurationMonths, deposit.ExpiresAt, deposit.Active, deposit.Compounding, deposit.DayCount,
+		deposit.PayoutAccountID, deposit.EarlyWithdrawal, deposit.EarlyWithdrawalRate, deposit.MaturityInstruction,
+		deposit.RolledOverFrom, deposit.InterestPeriodStart, deposit.AccruedUntil, deposit.CreatedAt).Scan(&id)
 	return id, err
 }
 
@@ -26,11 +51,79 @@ func UpdateDepositActiveStatus(id int, active bool) error {
 	return err
 }
 
+// Закрыть депозит в рамках транзакции. Возвращает false, если депозит уже закрыт
+func DeactivateDeposit(tx *sqlx.Tx, id int) (bool, error) {
+	result, err := tx.Exec(`UPDATE deposits SET active = FALSE WHERE id = $1 AND active = TRUE`, id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
+// Взять депозит по ID с блокировкой строки до конца транзакции (в любом статусе)
+func GetDepositByIDForUpdate(tx *sqlx.Tx, id int) (models.Deposit, error) {
+	var deposit models.Deposit
+	err := tx.Get(&deposit, `
+		SELECT `+depositColumns+`
+		FROM deposits
+		WHERE id = $1
+		FOR UPDATE`, id)
+	return deposit, err
+}
+
+// Сохранить состояние начисления процентов по депозиту
+func SaveDepositAccrual(tx *sqlx.Tx, deposit *models.Deposit) error {
+	_, err := tx.Exec(`
+		UPDATE deposits
+		SET capitalized_interest = $1, paid_interest = $2, accrued_interest = $3, interest_period_start = $4,
+		    accrued_until = $5
+		WHERE id = $6`,
+		deposit.CapitalizedInterest, deposit.PaidInterest, deposit.AccruedInterest, deposit.InterestPeriodStart,
+		deposit.AccruedUntil, deposit.ID)
+	return err
+}
+
+// ID активных депозитов, по которым проценты начислены не по сегодняшний день
+func GetDepositIDsForAccrual(today time.Time) ([]int, error) {
+	var ids []int
+	err := db.GetDBConn().Select(&ids, `
+		SELECT id
+		FROM deposits
+		WHERE active = TRUE AND accrued_until < $1 AND accrued_until < expires_at::date
+		ORDER BY id`, today)
+	return ids, err
+}
+
+// ID активных депозитов, срок которых закончился к моменту now
+func GetMaturedDepositIDs(now time.Time) ([]int, error) {
+	var ids []int
+	err := db.GetDBConn().Select(&ids, `
+		SELECT id
+		FROM deposits
+		WHERE active = TRUE AND expires_at <= $1
+		ORDER BY id`, now)
+	return ids, err
+}
+
+// Изменить инструкцию на дату окончания срока (только у активного депозита)
+func UpdateDepositMaturityInstruction(id int, instruction string) (bool, error) {
+	result, err := db.GetDBConn().Exec(`
+		UPDATE deposits
+		SET maturity_instruction = $1
+		WHERE id = $2 AND active = TRUE`, instruction, id)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows == 1, err
+}
+
 // Взять депозит по ID (только если active = true)
 func GetDepositByID(id int) (models.Deposit, error) {
 	var deposit models.Deposit
 	err := db.GetDBConn().Get(&deposit, `
-		SELECT id, user_id, amount, currency, interest_rate, duration_months, created_at, expires_at, active
+		SELECT `+depositColumns+`
 		FROM deposits
 		WHERE id = $1 AND active = TRUE`, id)
 	return deposit, err
@@ -40,38 +133,48 @@ func GetDepositByID(id int) (models.Deposit, error) {
 func GetDepositsByUserID(userID int) ([]models.Deposit, error) {
 	var deposits []models.Deposit
 	err := db.GetDBConn().Select(&deposits, `
-		SELECT id, user_id, amount, currency, interest_rate, duration_months, created_at, expires_at, active
+		SELECT `+depositColumns+`
 		FROM deposits
 		WHERE user_id = $1 AND active = TRUE`, userID)
 	return deposits, err
 }
 
-// Взять все активные депозиты
-func GetActiveDeposits() ([]models.Deposit, error) {
-	var deposits []models.Deposit
-	err := db.GetDBConn().Select(&deposits, `
-		SELECT id, user_id, amount, currency, interest_rate, duration_months, created_at, expires_at, active
-		FROM deposits
-		WHERE active = TRUE`)
-	return deposits, err
+// Списки депозитов: сортировка по id, дате открытия, дате окончания или сумме,
+// фильтры по пользователю, валюте, продукту и инструкции на окончание срока
+var depositListSpec = listSpec[models.Deposit]{
+	columns: depositColumns,
+	from:    "deposits",
+	id:      func(deposit models.Deposit) int { return deposit.ID },
+	sorts: map[string]sortField[models.Deposit]{
+		"id":         {column: "id", value: func(deposit models.Deposit) string { return sortInt(deposit.ID) }},
+		"created_at": {column: "created_at", value: func(deposit models.Deposit) string { return sortTime(deposit.CreatedAt) }},
+		"expires_at": {column: "expires_at", value: func(deposit models.Deposit) string { return sortTime(deposit.ExpiresAt) }},
+		"amount":     {column: "amount", value: func(deposit models.Deposit) string { return sortMoney(deposit.Amount) }},
+	},
+	filters: map[string]filterField{
+		"user_id":              {column: "user_id", parse: filterInt},
+		"currency":             {column: "currency", parse: filterString},
+		"product_id":           {column: "product_id", parse: filterInt},
+		"maturity_instruction": {column: "maturity_instruction", parse: filterString},
+	},
 }
 
-// Взять все неактивные депозиты
-func GetInactiveDeposits() ([]models.Deposit, error) {
-	var deposits []models.Deposit
-	err := db.GetDBConn().Select(&deposits, `
-		SELECT id, user_id, amount, currency, interest_rate, duration_months, created_at, expires_at, active
-		FROM deposits
-		WHERE active = FALSE`)
-	return deposits, err
+// Страница депозитов пользователя (только если active = true)
+func GetDepositsPageByUserID(userID int, page models.PageParams) (models.Page[models.Deposit], error) {
+	return selectPage(depositListSpec, "user_id = $1 AND active = TRUE", []any{userID}, page)
 }
 
-// Взять депозиты по валюте (currency) (только если active = true)
-func GetDepositsByCurrency(currency string) ([]models.Deposit, error) {
-	var deposits []models.Deposit
-	err := db.GetDBConn().Select(&deposits, `
-		SELECT id, user_id, amount, currency, interest_rate, duration_months, created_at, expires_at, active
-		FROM deposits
-		WHERE currency = $1 AND active = TRUE`, currency)
-	return deposits, err
+// Страница активных депозитов
+func GetActiveDeposits(page models.PageParams) (models.Page[models.Deposit], error) {
+	return selectPage(depositListSpec, "active = TRUE", nil, page)
+}
+
+// Страница неактивных депозитов
+func GetInactiveDeposits(page models.PageParams) (models.Page[models.Deposit], error) {
+	return selectPage(depositListSpec, "active = FALSE", nil, page)
+}
+
+// Страница депозитов по валюте (currency) (только если active = true)
+func GetDepositsByCurrency(currency string, page models.PageParams) (models.Page[models.Deposit], error) {
+	return selectPage(depositListSpec, "currency = $1 AND active = TRUE", []any{currency}, page)
 }
@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"SB/internal/db"
+	"SB/internal/errs"
+	"SB/internal/models"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const depositProductColumns = `id, name, currency, min_amount, max_amount, allowed_terms, early_withdrawal, early_withdrawal_rate,
+		compounding, day_count, active, created_at, updated_at`
+
+// Создать депозитный продукт вместе с таблицей ставок
+func CreateDepositProduct(product *models.DepositProduct) error {
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sqlx.Tx) {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}(tx)
+
+	err = tx.QueryRow(`
+		INSERT INTO deposit_products (name, currency, min_amount, max_amount, allowed_terms, early_withdrawal,
+		                              early_withdrawal_rate, compounding, day_count, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, created_at`,
+		product.Name, product.Currency, product.MinAmount, product.MaxAmount, product.AllowedTerms,
+		product.EarlyWithdrawal, product.EarlyWithdrawalRate, product.Compounding, product.DayCount, product.Active,
+	).Scan(&product.ID, &product.CreatedAt)
+	if err != nil {
+		err = translateDepositProductError(err)
+		return err
+	}
+
+	if err = saveDepositProductRates(tx, product); err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+// Изменить условия продукта. Таблица ставок заменяется целиком;
+// на уже открытые депозиты это не влияет - ставка фиксируется при открытии
+func UpdateDepositProduct(product *models.DepositProduct) error {
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sqlx.Tx) {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}(tx)
+
+	err = tx.QueryRow(`
+		UPDATE deposit_products
+		SET name = $1, currency = $2, min_amount = $3, max_amount = $4, allowed_terms = $5, early_withdrawal = $6,
+		    early_withdrawal_rate = $7, compounding = $8, day_count = $9, active = $10, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $11
+		RETURNING created_at, updated_at`,
+		product.Name, product.Currency, product.MinAmount, product.MaxAmount, product.AllowedTerms,
+		product.EarlyWithdrawal, product.EarlyWithdrawalRate, product.Compounding, product.DayCount, product.Active,
+		product.ID,
+	).Scan(&product.CreatedAt, &product.UpdatedAt)
+	if err != nil {
+		err = translateDepositProductError(err)
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM deposit_product_rates WHERE product_id = $1`, product.ID)
+	if err != nil {
+		return err
+	}
+
+	if err = saveDepositProductRates(tx, product); err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+func saveDepositProductRates(tx *sqlx.Tx, product *models.DepositProduct) error {
+	for i := range product.Rates {
+		rate := &product.Rates[i]
+		rate.ProductID = product.ID
+		err := tx.QueryRow(`
+			INSERT INTO deposit_product_rates (product_id, term_months, min_amount, rate)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id`,
+			rate.ProductID, rate.TermMonths, rate.MinAmount, rate.Rate).Scan(&rate.ID)
+		if err != nil {
+			return translateDepositProductError(err)
+		}
+	}
+	return nil
+}
+
+// Взять продукт по ID вместе со ставками
+func GetDepositProductByID(id int) (models.DepositProduct, error) {
+	var product models.DepositProduct
+	err := db.GetDBConn().Get(&product, `
+		SELECT `+depositProductColumns+`
+		FROM deposit_products
+		WHERE id = $1`, id)
+	if err != nil {
+		return product, err
+	}
+
+	err = db.GetDBConn().Select(&product.Rates, `
+		SELECT id, product_id, term_months, min_amount, rate
+		FROM deposit_product_rates
+		WHERE product_id = $1
+		ORDER BY term_months, min_amount`, id)
+	return product, err
+}
+
+// Взять продукты (только активные, если activeOnly) вместе со ставками
+func GetDepositProducts(activeOnly bool) ([]models.DepositProduct, error) {
+	var products []models.DepositProduct
+	err := db.GetDBConn().Select(&products, `
+		SELECT `+depositProductColumns+`
+		FROM deposit_products
+		WHERE active OR NOT $1
+		ORDER BY id`, activeOnly)
+	if err != nil || len(products) == 0 {
+		return products, err
+	}
+
+	var rates []models.DepositRateTier
+	err = db.GetDBConn().Select(&rates, `
+		SELECT r.id, r.product_id, r.term_months, r.min_amount, r.rate
+		FROM deposit_product_rates r
+		JOIN deposit_products p ON p.id = r.product_id
+		WHERE p.active OR NOT $1
+		ORDER BY r.product_id, r.term_months, r.min_amount`, activeOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[int]int, len(products))
+	for i := range products {
+		index[products[i].ID] = i
+	}
+	for _, rate := range rates {
+		if i, ok := index[rate.ProductID]; ok {
+			products[i].Rates = append(products[i].Rates, rate)
+		}
+	}
+	return products, nil
+}
+
+func translateDepositProductError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return errs.ErrDepositProductExists
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"SB/internal/db"
+	"SB/internal/errs"
+	"SB/internal/models"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"time"
+)
+
+const createExchangeRateQuery = `
+	INSERT INTO exchange_rates (base_currency, quote_currency, rate, effective_at, created_by)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at`
+
+// Добавить курс валют. Курс на тот же момент повторно добавить нельзя,
+// чтобы исторические операции всегда воспроизводились по одному и тому же курсу
+func CreateExchangeRate(rate *models.ExchangeRate) error {
+	err := db.GetDBConn().QueryRow(createExchangeRateQuery,
+		rate.BaseCurrency, rate.QuoteCurrency, rate.Rate, rate.EffectiveAt, rate.CreatedBy).Scan(&rate.ID, &rate.CreatedAt)
+	return translateExchangeRateError(err)
+}
+
+// Добавить пачку курсов одной транзакцией
+func CreateExchangeRates(rates []models.ExchangeRate) error {
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
+	}
+	defer func(tx *sqlx.Tx) {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}(tx)
+
+	for i := range rates {
+		err = tx.QueryRow(createExchangeRateQuery,
+			rates[i].BaseCurrency, rates[i].QuoteCurrency, rates[i].Rate, rates[i].EffectiveAt, rates[i].CreatedBy).Scan(&rates[i].ID, &rates[i].CreatedAt)
+		if err != nil {
+			err = translateExchangeRateError(err)
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+// Взять курс base -> quote, действовавший в момент at
+func GetExchangeRateAt(base, quote string, at time.Time) (models.ExchangeRate, error) {
+	var rate models.ExchangeRate
+	err := db.GetDBConn().Get(&rate, `
+		SELECT id, base_currency, quote_currency, rate, effective_at, created_by, created_at
+		FROM exchange_rates
+		WHERE base_currency = $1 AND quote_currency = $2 AND effective_at <= $3
+		ORDER BY effective_at DESC
+		LIMIT 1`, base, quote, at)
+	return rate, err
+}
+
+// История курсов пары валют, начиная с самых свежих
+func GetExchangeRateHistory(base, quote string) ([]models.ExchangeRate, error) {
+	var rates []models.ExchangeRate
+	err := db.GetDBConn().Select(&rates, `
+		SELECT id, base_currency, quote_currency, rate, effective_at, created_by, created_at
+		FROM exchange_rates
+		WHERE base_currency = $1 AND quote_currency = $2
+		ORDER BY effective_at DESC`, base, quote)
+	return rates, err
+}
+
+func translateExchangeRateError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return errs.ErrExchangeRateExists
+	}
+	return err
+}
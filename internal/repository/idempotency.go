@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"SB/internal/db"
+	"SB/internal/models"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Зарезервировать ключ идемпотентности. Возвращает false, если ключ уже занят
+func CreateIdempotencyKey(key *models.IdempotencyKey) (bool, error) {
+	err := db.GetDBConn().QueryRow(`
+		INSERT INTO idempotency_keys (idempotency_key, user_id, method, path, fingerprint, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, idempotency_key) DO NOTHING
+		RETURNING id, created_at`,
+		key.Key, key.UserID, key.Method, key.Path, key.Fingerprint, key.ExpiresAt).Scan(&key.ID, &key.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Взять ключ идемпотентности пользователя
+func GetIdempotencyKey(userID int, key string) (models.IdempotencyKey, error) {
+	var idempotencyKey models.IdempotencyKey
+	err := db.GetDBConn().Get(&idempotencyKey, `
+		SELECT id, idempotency_key, user_id, method, path, fingerprint, status_code, response_body, created_at, expires_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND idempotency_key = $2`, userID, key)
+	return idempotencyKey, err
+}
+
+// Сохранить результат первого запроса для повторов
+func SaveIdempotencyResponse(id int, statusCode int, body []byte) error {
+	_, err := db.GetDBConn().Exec(`
+		UPDATE idempotency_keys
+		SET status_code = $1, response_body = $2
+		WHERE id = $3`, statusCode, body, id)
+	return err
+}
+
+// Удалить ключ идемпотентности
+func DeleteIdempotencyKey(id int) error {
+	_, err := db.GetDBConn().Exec(`DELETE FROM idempotency_keys WHERE id = $1`, id)
+	return err
+}
+
+// Удалить истёкший ключ пользователя, чтобы его можно было использовать заново
+func DeleteExpiredIdempotencyKey(userID int, key string) error {
+	_, err := db.GetDBConn().Exec(`
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND idempotency_key = $2 AND expires_at < CURRENT_TIMESTAMP`, userID, key)
+	return err
+}
+
+// Удалить истёкшие ключи и ключи, зависшие без ответа дольше pendingBefore
+func DeleteExpiredIdempotencyKeys(now, pendingBefore time.Time) (int64, error) {
+	result, err := db.GetDBConn().Exec(`
+		DELETE FROM idempotency_keys
+		WHERE expires_at < $1 OR (status_code IS NULL AND created_at < $2)`, now, pendingBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
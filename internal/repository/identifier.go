@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"SB/internal/db"
+	"SB/internal/errs"
+	"SB/internal/models"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const userIdentifierColumns = `id, user_id, kind, value, verified_at, created_at`
+
+// Добавить идентификатор новому пользователю в рамках транзакции
+func CreateUserIdentifier(tx *sqlx.Tx, identifier *models.UserIdentifier) error {
+	err := tx.QueryRow(`
+		INSERT INTO user_identifiers (user_id, kind, value, verified_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		identifier.UserID, identifier.Kind, identifier.Value, identifier.VerifiedAt).Scan(&identifier.ID, &identifier.CreatedAt)
+	return translateIdentifierError(err)
+}
+
+// Задать идентификатор пользователя. Новое значение заменяет старое и сбрасывает подтверждение,
+// то же значение оставляется как есть. Возвращает false, если значение не изменилось.
+// Уникальность проверяется только для подтверждённых значений, то есть для имени пользователя
+func SaveUserIdentifier(identifier *models.UserIdentifier) (bool, error) {
+	result, err := db.GetDBConn().Exec(`
+		INSERT INTO user_identifiers (user_id, kind, value, verified_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, kind) DO UPDATE
+		SET value = EXCLUDED.value, verified_at = EXCLUDED.verified_at, created_at = CURRENT_TIMESTAMP
+		WHERE user_identifiers.value <> EXCLUDED.value`,
+		identifier.UserID, identifier.Kind, identifier.Value, identifier.VerifiedAt)
+	if err != nil {
+		return false, translateIdentifierError(err)
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// Идентификаторы пользователя
+func GetUserIdentifiers(userID int) ([]models.UserIdentifier, error) {
+	var identifiers []models.UserIdentifier
+	err := db.GetDBConn().Select(&identifiers, `
+		SELECT `+userIdentifierColumns+`
+		FROM user_identifiers
+		WHERE user_id = $1
+		ORDER BY kind`, userID)
+	return identifiers, err
+}
+
+// Идентификатор пользователя заданного вида
+func GetUserIdentifier(userID int, kind string) (models.UserIdentifier, error) {
+	var identifier models.UserIdentifier
+	err := db.GetDBConn().Get(&identifier, `
+		SELECT `+userIdentifierColumns+`
+		FROM user_identifiers
+		WHERE user_id = $1 AND kind = $2`, userID, kind)
+	return identifier, err
+}
+
+// Подтвердил ли это значение другой пользователь
+func IsIdentifierTaken(userID int, kind, value string) (bool, error) {
+	var taken bool
+	err := db.GetDBConn().Get(&taken, `
+		SELECT EXISTS (
+			SELECT 1 FROM user_identifiers
+			WHERE kind = $2 AND value = $3 AND user_id <> $1 AND verified_at IS NOT NULL
+		)`, userID, kind, value)
+	return taken, err
+}
+
+// Удалить идентификатор. Возвращает false, если его не было
+func DeleteUserIdentifier(userID int, kind string) (bool, error) {
+	result, err := db.GetDBConn().Exec(`DELETE FROM user_identifiers WHERE user_id = $1 AND kind = $2`, userID, kind)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+func translateIdentifierError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return errs.ErrIdentifierTaken
+	}
+	return err
+}
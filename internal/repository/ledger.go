@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"SB/internal/db"
+	"SB/internal/errs"
+	"SB/internal/models"
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"sort"
+)
+
+var (
+	createJournalQuery = `insert into 
+    ledger_journals (operation, reference_id) 
+	values ($1, $2) 
+	returning id, operation, reference_id, created_at`
+
+	createLedgerEntryQuery = `insert into 
+    entries (journal_id, account_id, system_account, amount, currency, exchange_rate) 
+	values ($1, $2, $3, $4, $5, $6) 
+	returning id, journal_id, account_id, system_account, amount, currency, exchange_rate, created_at`
+
+	applyBalanceQuery = `update accounts 
+	set balance = balance + $2, updated_at = current_timestamp 
+	where id = $1
+	and currency = $3
+	and active = true 
+	and deleted_at is null
+	returning id, user_id, phone_number, balance, currency, purpose, active, created_at, updated_at, deleted_at`
+)
+
+// Провести сбалансированный набор записей в рамках транзакции tx.
+// Сумма записей по каждой валюте должна быть равна нулю, а записи по счёту клиента - в валюте этого счёта.
+// Балансы счетов клиентов изменяются только здесь, в том же порядке id, чтобы избежать взаимных блокировок.
+func PostJournal(tx *sqlx.Tx, operation string, referenceID *int, postings []models.Posting) (*models.LedgerJournal, map[int]models.Account, error) {
+	deltas, currencies, err := balancePostings(postings)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var journal models.LedgerJournal
+	err = tx.QueryRowx(createJournalQuery, operation, referenceID).StructScan(&journal)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, p := range postings {
+		var (
+			accountID     *int
+			systemAccount *string
+		)
+		if p.AccountID != 0 {
+			accountID = &p.AccountID
+		} else {
+			systemAccount = &p.SystemAccount
+		}
+
+		var entry models.Entry
+		err = tx.QueryRowx(createLedgerEntryQuery, journal.ID, accountID, systemAccount, p.Amount, p.Currency, p.ExchangeRate).StructScan(&entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		journal.Entries = append(journal.Entries, entry)
+	}
+
+	accountIDs := make([]int, 0, len(deltas))
+	for id := range deltas {
+		accountIDs = append(accountIDs, id)
+	}
+	sort.Ints(accountIDs)
+
+	accounts := make(map[int]models.Account, len(accountIDs))
+	for _, id := range accountIDs {
+		var account models.Account
+		err = tx.QueryRowx(applyBalanceQuery, id, deltas[id], currencies[id]).StructScan(&account)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, nil, accountPostingError(tx, id)
+			}
+			return nil, nil, err
+		}
+		if account.Balance < 0 {
+			return nil, nil, errs.ErrInsufficientFunds
+		}
+		accounts[id] = account
+	}
+
+	return &journal, accounts, nil
+}
+
+// Проверить набор записей: у каждой ровно один счёт, суммы по каждой валюте сходятся в ноль,
+// по одному счёту клиента только одна валюта. Возвращает изменение и валюту каждого счёта клиента
+func balancePostings(postings []models.Posting) (map[int]models.Money, map[int]string, error) {
+	if len(postings) < 2 {
+		return nil, nil, errs.ErrUnbalancedJournal
+	}
+
+	totals := make(map[string]models.Money)
+	deltas := make(map[int]models.Money)
+	currencies := make(map[int]string)
+	for _, p := range postings {
+		if (p.AccountID == 0) == (p.SystemAccount == "") || p.Currency == "" {
+			return nil, nil, errs.ErrUnbalancedJournal
+		}
+		totals[p.Currency] += p.Amount
+		if p.AccountID != 0 {
+			if currency, ok := currencies[p.AccountID]; ok && currency != p.Currency {
+				return nil, nil, errs.ErrPostingCurrency
+			}
+			currencies[p.AccountID] = p.Currency
+			deltas[p.AccountID] += p.Amount
+		}
+	}
+	for _, total := range totals {
+		if total != 0 {
+			return nil, nil, errs.ErrUnbalancedJournal
+		}
+	}
+	return deltas, currencies, nil
+}
+
+// Почему запись не легла на счёт: счёт не активен или у него другая валюта
+func accountPostingError(tx *sqlx.Tx, accountID int) error {
+	var exists bool
+	err := tx.Get(&exists, `
+		SELECT EXISTS (SELECT 1 FROM accounts WHERE id = $1 AND active = TRUE AND deleted_at IS NULL)`, accountID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return errs.ErrPostingCurrency
+	}
+	return errs.ErrAccountNotActive
+}
+
+// Взять записи журнала по счёту клиента
+func GetEntriesByAccountID(accountID int) ([]models.Entry, error) {
+	var entries []models.Entry
+	err := db.GetDBConn().Select(&entries, `
+		SELECT id, journal_id, account_id, system_account, amount, currency, exchange_rate, created_at
+		FROM entries
+		WHERE account_id = $1
+		ORDER BY id`, accountID)
+	return entries, err
+}
+
+// Есть ли записи журнала по счёту клиента
+func AccountHasEntries(tx *sqlx.Tx, accountID int) (bool, error) {
+	var exists bool
+	err := tx.Get(&exists, `SELECT EXISTS (SELECT 1 FROM entries WHERE account_id = $1)`, accountID)
+	return exists, err
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"SB/internal/errs"
+	"SB/internal/models"
+	"errors"
+	"testing"
+)
+
+func TestBalancePostings(t *testing.T) {
+	tests := []struct {
+		name       string
+		postings   []models.Posting
+		wantErr    error
+		deltas     map[int]models.Money
+		currencies map[int]string
+	}{
+		{
+			name: "transfer between accounts",
+			postings: []models.Posting{
+				{AccountID: 1, Amount: -500, Currency: "USD"},
+				{AccountID: 2, Amount: 500, Currency: "USD"},
+			},
+			deltas:     map[int]models.Money{1: -500, 2: 500},
+			currencies: map[int]string{1: "USD", 2: "USD"},
+		},
+		{
+			name: "system account side is not an account delta",
+			postings: []models.Posting{
+				{AccountID: 1, Amount: 1000, Currency: "USD"},
+				{SystemAccount: models.SystemAccountLoanBook, Amount: -1000, Currency: "USD"},
+			},
+			deltas:     map[int]models.Money{1: 1000},
+			currencies: map[int]string{1: "USD"},
+		},
+		{
+			name: "exchange through a system account",
+			postings: []models.Posting{
+				{AccountID: 1, Amount: -1000, Currency: "USD"},
+				{SystemAccount: models.SystemAccountBankCash, Amount: 1000, Currency: "USD"},
+				{SystemAccount: models.SystemAccountBankCash, Amount: -920, Currency: "EUR"},
+				{AccountID: 2, Amount: 920, Currency: "EUR"},
+			},
+			deltas:     map[int]models.Money{1: -1000, 2: 920},
+			currencies: map[int]string{1: "USD", 2: "EUR"},
+		},
+		{
+			name: "several postings on one account are summed",
+			postings: []models.Posting{
+				{AccountID: 1, Amount: -300, Currency: "USD"},
+				{AccountID: 1, Amount: -20, Currency: "USD"},
+				{SystemAccount: models.SystemAccountInterestExpense, Amount: 20, Currency: "USD"},
+				{SystemAccount: models.SystemAccountLoanBook, Amount: 300, Currency: "USD"},
+			},
+			deltas:     map[int]models.Money{1: -320},
+			currencies: map[int]string{1: "USD"},
+		},
+		{
+			name:     "single posting",
+			postings: []models.Posting{{AccountID: 1, Amount: 0, Currency: "USD"}},
+			wantErr:  errs.ErrUnbalancedJournal,
+		},
+		{
+			name: "amounts do not sum to zero",
+			postings: []models.Posting{
+				{AccountID: 1, Amount: -500, Currency: "USD"},
+				{AccountID: 2, Amount: 499, Currency: "USD"},
+			},
+			wantErr: errs.ErrUnbalancedJournal,
+		},
+		{
+			name: "balanced in total but not per currency",
+			postings: []models.Posting{
+				{AccountID: 1, Amount: -500, Currency: "USD"},
+				{AccountID: 2, Amount: 500, Currency: "EUR"},
+			},
+			wantErr: errs.ErrUnbalancedJournal,
+		},
+		{
+			name: "posting without an account",
+			postings: []models.Posting{
+				{Amount: -500, Currency: "USD"},
+				{AccountID: 2, Amount: 500, Currency: "USD"},
+			},
+			wantErr: errs.ErrUnbalancedJournal,
+		},
+		{
+			name: "posting with both accounts",
+			postings: []models.Posting{
+				{AccountID: 1, SystemAccount: models.SystemAccountBankCash, Amount: -500, Currency: "USD"},
+				{AccountID: 2, Amount: 500, Currency: "USD"},
+			},
+			wantErr: errs.ErrUnbalancedJournal,
+		},
+		{
+			name: "posting without currency",
+			postings: []models.Posting{
+				{AccountID: 1, Amount: -500},
+				{AccountID: 2, Amount: 500},
+			},
+			wantErr: errs.ErrUnbalancedJournal,
+		},
+		{
+			name: "one account in two currencies",
+			postings: []models.Posting{
+				{AccountID: 1, Amount: -500, Currency: "USD"},
+				{SystemAccount: models.SystemAccountBankCash, Amount: 500, Currency: "USD"},
+				{SystemAccount: models.SystemAccountBankCash, Amount: -460, Currency: "EUR"},
+				{AccountID: 1, Amount: 460, Currency: "EUR"},
+			},
+			wantErr: errs.ErrPostingCurrency,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deltas, currencies, err := balancePostings(tt.postings)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("balancePostings() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if len(deltas) != len(tt.deltas) {
+				t.Fatalf("balancePostings() deltas = %v, want %v", deltas, tt.deltas)
+			}
+			for id, want := range tt.deltas {
+				if deltas[id] != want {
+					t.Errorf("delta of account %d = %d, want %d", id, deltas[id], want)
+				}
+				if currencies[id] != tt.currencies[id] {
+					t.Errorf("currency of account %d = %q, want %q", id, currencies[id], tt.currencies[id])
+				}
+			}
+		})
+	}
+}
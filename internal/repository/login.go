@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"SB/internal/db"
+	"SB/internal/models"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const loginFailureColumns = `scope, subject, failed_count, last_failed_at, locked_until`
+
+// Счётчик неудачных попыток входа
+func GetLoginFailure(scope, subject string) (models.LoginFailure, error) {
+	var failure models.LoginFailure
+	err := db.GetDBConn().Get(&failure, `
+		SELECT `+loginFailureColumns+`
+		FROM login_failures
+		WHERE scope = $1 AND subject = $2`, scope, subject)
+	return failure, err
+}
+
+// Счётчик с блокировкой строки до конца транзакции. Если счётчика нет, он создаётся пустым,
+// чтобы параллельные попытки ждали друг друга и на первой попытке
+func GetLoginFailureForUpdate(tx *sqlx.Tx, scope, subject string, now time.Time) (models.LoginFailure, error) {
+	var failure models.LoginFailure
+	_, err := tx.Exec(`
+		INSERT INTO login_failures (scope, subject, failed_count, last_failed_at)
+		VALUES ($1, $2, 0, $3)
+		ON CONFLICT (scope, subject) DO NOTHING`, scope, subject, now)
+	if err != nil {
+		return failure, err
+	}
+	err = tx.Get(&failure, `
+		SELECT `+loginFailureColumns+`
+		FROM login_failures
+		WHERE scope = $1 AND subject = $2
+		FOR UPDATE`, scope, subject)
+	return failure, err
+}
+
+// Учесть попытку входа как неудачную. Счётчик начинается заново, если прошлая попытка была раньше windowStart
+// или блокировка уже закончилась
+func RegisterLoginFailure(tx *sqlx.Tx, scope, subject string, now, windowStart time.Time) (models.LoginFailure, error) {
+	var failure models.LoginFailure
+	err := tx.Get(&failure, `
+		INSERT INTO login_failures (scope, subject, failed_count, last_failed_at)
+		VALUES ($1, $2, 1, $3)
+		ON CONFLICT (scope, subject) DO UPDATE
+		SET failed_count = CASE
+		        WHEN login_failures.last_failed_at < $4 OR login_failures.locked_until <= $3 THEN 1
+		        ELSE login_failures.failed_count + 1
+		    END,
+		    locked_until = CASE WHEN login_failures.locked_until <= $3 THEN NULL ELSE login_failures.locked_until END,
+		    last_failed_at = $3
+		RETURNING `+loginFailureColumns, scope, subject, now, windowStart)
+	return failure, err
+}
+
+// Вернуть попытку, засчитанную заранее, если она оказалась удачной. Пустой счётчик удаляется
+func RefundLoginFailure(scope, subject string) error {
+	_, err := db.GetDBConn().Exec(`
+		UPDATE login_failures
+		SET failed_count = failed_count - 1
+		WHERE scope = $1 AND subject = $2 AND failed_count > 0`, scope, subject)
+	if err != nil {
+		return err
+	}
+	_, err = db.GetDBConn().Exec(`
+		DELETE FROM login_failures
+		WHERE scope = $1 AND subject = $2 AND failed_count = 0 AND locked_until IS NULL`, scope, subject)
+	return err
+}
+
+// Заблокировать вход до until. Возвращает false, если блокировка уже стоит - тогда повторно её не фиксируем
+func LockLogin(scope, subject string, until, now time.Time) (bool, error) {
+	result, err := db.GetDBConn().Exec(`
+		UPDATE login_failures
+		SET locked_until = $3
+		WHERE scope = $1 AND subject = $2 AND (locked_until IS NULL OR locked_until <= $4)`,
+		scope, subject, until, now)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// Сбросить счётчик. Возвращает false, если сбрасывать было нечего
+func ResetLoginFailures(scope, subject string) (bool, error) {
+	result, err := db.GetDBConn().Exec(`DELETE FROM login_failures WHERE scope = $1 AND subject = $2`, scope, subject)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// Действующие блокировки входа
+func GetActiveLoginLocks(now time.Time) ([]models.LoginFailure, error) {
+	var locks []models.LoginFailure
+	err := db.GetDBConn().Select(&locks, `
+		SELECT `+loginFailureColumns+`
+		FROM login_failures
+		WHERE locked_until > $1
+		ORDER BY locked_until DESC`, now)
+	return locks, err
+}
+
+// Удалить счётчики без попыток после before и без действующей блокировки
+func DeleteStaleLoginFailures(before, now time.Time) (int64, error) {
+	result, err := db.GetDBConn().Exec(`
+		DELETE FROM login_failures
+		WHERE last_failed_at < $1 AND (locked_until IS NULL OR locked_until <= $2)`, before, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"SB/internal/db"
+	"SB/internal/errs"
+	"SB/internal/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lib/pq"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Время в курсоре без часового пояса, как в колонках TIMESTAMP
+const cursorTimeLayout = "2006-01-02 15:04:05.999999"
+
+// Поле, по которому можно сортировать список: колонка и её значение у строки для курсора.
+// Колонка должна быть NOT NULL, иначе сравнение с курсором теряет строки
+type sortField[T any] struct {
+	column string
+	value  func(T) string
+}
+
+// Фильтр filter[имя]=значение: колонка сравнивается на равенство с разобранным значением
+type filterField struct {
+	column string
+	parse  func(string) (any, error)
+}
+
+// Описание списка для постраничной выборки: что выбирать, по чему сортировать и фильтровать
+type listSpec[T any] struct {
+	columns string
+	from    string
+	id      func(T) int
+	sorts   map[string]sortField[T]
+	filters map[string]filterField
+}
+
+// Курсор - позиция последней строки страницы в выбранной сортировке
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func encodeCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (pageCursor, error) {
+	var cursor pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
+
+func filterInt(value string) (any, error) {
+	return strconv.Atoi(value)
+}
+
+func filterString(value string) (any, error) {
+	if value == "" {
+		return nil, errs.ErrInvalidFilter
+	}
+	return value, nil
+}
+
+func sortInt(value int) string {
+	return strconv.Itoa(value)
+}
+
+func sortMoney(value models.Money) string {
+	return strconv.FormatInt(int64(value), 10)
+}
+
+func sortTime(value time.Time) string {
+	return value.Format(cursorTimeLayout)
+}
+
+// Выбрать страницу списка. where и args - условия самого списка, к ним добавляются фильтры и позиция курсора.
+// Сортировка всегда дополняется id, чтобы порядок был однозначным. Берётся на одну строку больше limit:
+// если она есть, по последней строке страницы строится курсор следующей
+func selectPage[T any](spec listSpec[T], where string, args []any, page models.PageParams) (models.Page[T], error) {
+	result := models.Page[T]{Items: []T{}}
+	if page.Limit <= 0 {
+		return result, errs.ErrInvalidPageLimit
+	}
+
+	sortName := page.Sort
+	if sortName == "" {
+		sortName = "id"
+	}
+	desc := strings.HasPrefix(sortName, "-")
+	field, ok := spec.sorts[strings.TrimPrefix(sortName, "-")]
+	if !ok {
+		return result, errs.ErrInvalidSortField
+	}
+
+	var conditions []string
+	if where != "" {
+		conditions = append(conditions, where)
+	}
+
+	names := make([]string, 0, len(page.Filters))
+	for name := range page.Filters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		filter, ok := spec.filters[name]
+		if !ok {
+			return result, errs.ErrInvalidFilter
+		}
+		value, err := filter.parse(page.Filters[name])
+		if err != nil {
+			return result, errs.ErrInvalidFilter
+		}
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf("%s = $%d", filter.column, len(args)))
+	}
+
+	compare, direction := ">", "ASC"
+	if desc {
+		compare, direction = "<", "DESC"
+	}
+
+	if page.Cursor != "" {
+		cursor, err := decodeCursor(page.Cursor)
+		if err != nil || cursor.Sort != sortName {
+			return result, errs.ErrInvalidCursor
+		}
+		if field.column == "id" {
+			args = append(args, cursor.ID)
+			conditions = append(conditions, fmt.Sprintf("id %s $%d", compare, len(args)))
+		} else {
+			args = append(args, cursor.Value, cursor.ID)
+			conditions = append(conditions, fmt.Sprintf("(%s, id) %s ($%d, $%d)", field.column, compare, len(args)-1, len(args)))
+		}
+	}
+
+	query := "SELECT " + spec.columns + " FROM " + spec.from
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if field.column == "id" {
+		query += " ORDER BY id " + direction
+	} else {
+		query += " ORDER BY " + field.column + " " + direction + ", id " + direction
+	}
+	query += fmt.Sprintf(" LIMIT %d", page.Limit+1)
+
+	err := db.GetDBConn().Select(&result.Items, query, args...)
+	if err != nil {
+		// Значение из подделанного курсора не приводится к типу колонки
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code.Class() == "22" {
+			return result, errs.ErrInvalidCursor
+		}
+		return result, err
+	}
+
+	if len(result.Items) > page.Limit {
+		result.Items = result.Items[:page.Limit]
+		last := result.Items[page.Limit-1]
+		result.NextCursor = encodeCursor(pageCursor{Sort: sortName, Value: field.value(last), ID: spec.id(last)})
+	}
+	return result, nil
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"SB/internal/db"
+	"SB/internal/models"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const passwordResetColumns = `id, user_id, token_hash, expires_at, used_at, created_at`
+
+// Сменить хеш пароля в рамках транзакции
+func UpdateUserPassword(tx *sqlx.Tx, userID int, passwordHash string) error {
+	_, err := tx.Exec(`
+		UPDATE users
+		SET password = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2`, passwordHash, userID)
+	return err
+}
+
+// Заменить хеш тем же паролем с новыми параметрами, если пароль не успели сменить
+func RehashUserPassword(userID int, oldHash, newHash string) error {
+	_, err := db.GetDBConn().Exec(`
+		UPDATE users
+		SET password = $1
+		WHERE id = $2 AND password = $3`, newHash, userID, oldHash)
+	return err
+}
+
+// Последние limit прежних хешей пароля, новые первыми
+func GetPasswordHistory(userID, limit int) ([]string, error) {
+	var hashes []string
+	err := db.GetDBConn().Select(&hashes, `
+		SELECT password_hash
+		FROM password_history
+		WHERE user_id = $1
+		ORDER BY id DESC
+		LIMIT $2`, userID, limit)
+	return hashes, err
+}
+
+// Сохранить прежний хеш пароля и оставить в истории только keep последних
+func AddPasswordHistory(tx *sqlx.Tx, userID int, passwordHash string, keep int) error {
+	_, err := tx.Exec(`INSERT INTO password_history (user_id, password_hash) VALUES ($1, $2)`, userID, passwordHash)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM password_history
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM password_history WHERE user_id = $1 ORDER BY id DESC LIMIT $2
+		)`, userID, keep)
+	return err
+}
+
+// Последний запрос на сброс пароля пользователя
+func GetLatestPasswordReset(userID int) (models.PasswordReset, error) {
+	var reset models.PasswordReset
+	err := db.GetDBConn().Get(&reset, `
+		SELECT `+passwordResetColumns+`
+		FROM password_resets
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1`, userID)
+	return reset, err
+}
+
+// Сохранить запрос на сброс, прежние запросы пользователя перестают действовать
+func ReplacePasswordReset(tx *sqlx.Tx, reset *models.PasswordReset) error {
+	_, err := tx.Exec(`DELETE FROM password_resets WHERE user_id = $1`, reset.UserID)
+	if err != nil {
+		return err
+	}
+	return tx.QueryRow(`
+		INSERT INTO password_resets (user_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id`, reset.UserID, reset.TokenHash, reset.ExpiresAt, reset.CreatedAt).Scan(&reset.ID)
+}
+
+// Удалить запрос на сброс, токен которого не удалось отправить
+func DeletePasswordReset(id int) error {
+	_, err := db.GetDBConn().Exec(`DELETE FROM password_resets WHERE id = $1`, id)
+	return err
+}
+
+// Запрос на сброс по хешу токена, строка блокируется до конца транзакции
+func GetPasswordResetForUpdate(tx *sqlx.Tx, tokenHash string) (models.PasswordReset, error) {
+	var reset models.PasswordReset
+	err := tx.Get(&reset, `
+		SELECT `+passwordResetColumns+`
+		FROM password_resets
+		WHERE token_hash = $1
+		FOR UPDATE`, tokenHash)
+	return reset, err
+}
+
+// Отметить запрос на сброс использованным
+func UsePasswordReset(tx *sqlx.Tx, id int, usedAt time.Time) error {
+	_, err := tx.Exec(`UPDATE password_resets SET used_at = $1 WHERE id = $2`, usedAt, id)
+	return err
+}
+
+// Удалить истёкшие запросы на сброс пароля
+func DeleteExpiredPasswordResets(now time.Time) (int64, error) {
+	result, err := db.GetDBConn().Exec(`DELETE FROM password_resets WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
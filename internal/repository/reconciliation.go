@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"SB/internal/db"
+	"SB/internal/models"
+)
+
+// Взять баланс каждого счёта рядом с суммой его записей в журнале (по каждой валюте)
+func GetLedgerBalances() ([]models.ReconciliationLine, error) {
+	var lines []models.ReconciliationLine
+	err := db.GetDBConn().Select(&lines, `
+		WITH ledger AS (
+			SELECT account_id, currency::varchar AS currency, SUM(amount) AS amount
+			FROM entries
+			WHERE account_id IS NOT NULL
+			GROUP BY account_id, currency
+		), pairs AS (
+			SELECT id AS account_id, currency FROM accounts
+			UNION
+			SELECT account_id, currency FROM ledger
+		)
+		SELECT p.account_id, a.user_id, p.currency,
+		       CASE WHEN p.currency = a.currency THEN a.balance ELSE 0 END AS balance,
+		       COALESCE(l.amount, 0) AS ledger_balance
+		FROM pairs p
+		JOIN accounts a ON a.id = p.account_id
+		LEFT JOIN ledger l ON l.account_id = p.account_id AND l.currency = p.currency
+		ORDER BY p.account_id, p.currency`)
+	return lines, err
+}
+
+// Взять журналы, записи которых не сходятся в ноль хотя бы по одной валюте
+func GetUnbalancedJournalIDs() ([]int64, error) {
+	var ids []int64
+	err := db.GetDBConn().Select(&ids, `
+		SELECT DISTINCT journal_id
+		FROM (
+			SELECT journal_id, currency, SUM(amount) AS total
+			FROM entries
+			WHERE journal_id IS NOT NULL
+			GROUP BY journal_id, currency
+		) t
+		WHERE total <> 0
+		ORDER BY journal_id`)
+	return ids, err
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"SB/internal/db"
+	"SB/internal/models"
+	"github.com/jmoiron/sqlx"
+)
+
+// Взять все роли вместе с разрешениями
+func GetRoles() ([]models.Role, error) {
+	var roles []models.Role
+	err := db.GetDBConn().Select(&roles, `
+		SELECT name, description
+		FROM roles
+		ORDER BY name`)
+	if err != nil || len(roles) == 0 {
+		return roles, err
+	}
+
+	var links []struct {
+		Role       string `db:"role"`
+		Permission string `db:"permission"`
+	}
+	err = db.GetDBConn().Select(&links, `
+		SELECT role, permission
+		FROM role_permissions
+		ORDER BY role, permission`)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int, len(roles))
+	for i := range roles {
+		index[roles[i].Name] = i
+		roles[i].Permissions = []string{}
+	}
+	for _, link := range links {
+		if i, ok := index[link.Role]; ok {
+			roles[i].Permissions = append(roles[i].Permissions, link.Permission)
+		}
+	}
+	return roles, nil
+}
+
+// Проверить, что роль существует
+func RoleExists(name string) (bool, error) {
+	var exists bool
+	err := db.GetDBConn().Get(&exists, `SELECT EXISTS (SELECT 1 FROM roles WHERE name = $1)`, name)
+	return exists, err
+}
+
+// Роли пользователя
+func GetUserRoles(userID int) ([]models.UserRole, error) {
+	var roles []models.UserRole
+	err := db.GetDBConn().Select(&roles, `
+		SELECT user_id, role, granted_by, granted_at
+		FROM user_roles
+		WHERE user_id = $1
+		ORDER BY role`, userID)
+	return roles, err
+}
+
+// Названия ролей и все разрешения пользователя по этим ролям
+func GetUserAccess(userID int) ([]string, []string, error) {
+	var roles []string
+	err := db.GetDBConn().Select(&roles, `
+		SELECT role
+		FROM user_roles
+		WHERE user_id = $1
+		ORDER BY role`, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var permissions []string
+	err = db.GetDBConn().Select(&permissions, `
+		SELECT DISTINCT rp.permission
+		FROM user_roles ur
+		JOIN role_permissions rp ON rp.role = ur.role
+		WHERE ur.user_id = $1
+		ORDER BY rp.permission`, userID)
+	return roles, permissions, err
+}
+
+// Выдать роль пользователю в рамках транзакции и записать в журнал аудита. Возвращает false, если роль уже была
+func GrantRole(tx *sqlx.Tx, userID int, role string, grantedBy *int) (bool, error) {
+	result, err := tx.Exec(`
+		INSERT INTO user_roles (user_id, role, granted_by)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`, userID, role, grantedBy)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil || rows == 0 {
+		return false, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO audit_logs (action, entity, entity_id, user_id) VALUES ($1, $2, $3, $4)`,
+		"grant_role_"+role, "user", userID, grantedBy)
+	return err == nil, err
+}
+
+// Отозвать роль у пользователя в рамках транзакции и записать в журнал аудита. Возвращает false, если роли не было
+func RevokeRole(tx *sqlx.Tx, userID int, role string, revokedBy int) (bool, error) {
+	result, err := tx.Exec(`DELETE FROM user_roles WHERE user_id = $1 AND role = $2`, userID, role)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil || rows == 0 {
+		return false, err
+	}
+
+	_, err = tx.Exec(`INSERT INTO audit_logs (action, entity, entity_id, user_id) VALUES ($1, $2, $3, $4)`,
+		"revoke_role_"+role, "user", userID, revokedBy)
+	return err == nil, err
+}
+
+// ID активных пользователей с ролью, строки ролей блокируются до конца транзакции
+func GetRoleHoldersForUpdate(tx *sqlx.Tx, role string) ([]int, error) {
+	var ids []int
+	err := tx.Select(&ids, `
+		SELECT ur.user_id
+		FROM user_roles ur
+		JOIN users u ON u.id = ur.user_id
+		WHERE ur.role = $1 AND u.active = TRUE AND u.deleted_at IS NULL
+		ORDER BY ur.user_id
+		FOR UPDATE OF ur`, role)
+	return ids, err
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"SB/internal/db"
+	"SB/internal/models"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const signingKeyColumns = `kid, algorithm, private_key, public_key, encrypted, created_at, activates_at, retired_at, expires_at`
+
+// Заблокировать таблицу ключей до конца транзакции, чтобы несколько экземпляров не ротировали ключи одновременно
+func LockSigningKeys(tx *sqlx.Tx) error {
+	_, err := tx.Exec(`LOCK TABLE signing_keys IN SHARE ROW EXCLUSIVE MODE`)
+	return err
+}
+
+// Ключи, которые ещё не выведены из подписи (включая ещё не начавшие подписывать), новые первыми
+func GetActiveSigningKeys(tx *sqlx.Tx) ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	err := tx.Select(&keys, `
+		SELECT `+signingKeyColumns+`
+		FROM signing_keys
+		WHERE retired_at IS NULL
+		ORDER BY created_at DESC`)
+	return keys, err
+}
+
+// Сохранить новый ключ в рамках транзакции
+func CreateSigningKey(tx *sqlx.Tx, key *models.SigningKey) error {
+	_, err := tx.Exec(`
+		INSERT INTO signing_keys (kid, algorithm, private_key, public_key, encrypted, created_at, activates_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		key.KID, key.Algorithm, key.PrivateKey, key.PublicKey, key.Encrypted, key.CreatedAt, key.ActivatesAt)
+	return err
+}
+
+// Вывести из подписи ключи, начавшие подписывать раньше activatedBefore. Они остаются для проверки до expiresAt
+func RetireSigningKeys(tx *sqlx.Tx, activatedBefore, retiredAt, expiresAt time.Time) error {
+	_, err := tx.Exec(`
+		UPDATE signing_keys
+		SET retired_at = $1, expires_at = $2
+		WHERE retired_at IS NULL AND activates_at < $3`, retiredAt, expiresAt, activatedBefore)
+	return err
+}
+
+// Ключи, закрытая часть которых хранится незашифрованной (созданные до шифрования)
+func GetPlaintextSigningKeys(tx *sqlx.Tx) ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	err := tx.Select(&keys, `
+		SELECT `+signingKeyColumns+`
+		FROM signing_keys
+		WHERE NOT encrypted`)
+	return keys, err
+}
+
+// Заменить закрытый ключ зашифрованным
+func SaveEncryptedSigningKey(tx *sqlx.Tx, kid string, privateKey []byte) error {
+	_, err := tx.Exec(`
+		UPDATE signing_keys
+		SET private_key = $1, encrypted = TRUE
+		WHERE kid = $2`, privateKey, kid)
+	return err
+}
+
+// Ключи, которыми можно проверять токены на момент now
+func GetSigningKeys(now time.Time) ([]models.SigningKey, error) {
+	var keys []models.SigningKey
+	err := db.GetDBConn().Select(&keys, `
+		SELECT `+signingKeyColumns+`
+		FROM signing_keys
+		WHERE expires_at IS NULL OR expires_at > $1
+		ORDER BY created_at DESC`, now)
+	return keys, err
+}
+
+// Удалить ключи, подписанные которыми токены уже истекли
+func DeleteExpiredSigningKeys(now time.Time) error {
+	_, err := db.GetDBConn().Exec(`DELETE FROM signing_keys WHERE expires_at <= $1`, now)
+	return err
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"SB/internal/db"
+	"SB/internal/models"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// Сохранить refresh-токен в рамках транзакции
+func CreateRefreshToken(tx *sqlx.Tx, token *models.RefreshToken) error {
+	return tx.QueryRow(`
+		INSERT INTO refresh_tokens (user_id, session_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`,
+		token.UserID, token.SessionID, token.TokenHash, token.ExpiresAt).Scan(&token.ID, &token.CreatedAt)
+}
+
+// Взять refresh-токен по хешу, строка блокируется до конца транзакции
+func GetRefreshTokenForUpdate(tx *sqlx.Tx, tokenHash string) (models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := tx.Get(&token, `
+		SELECT id, user_id, session_id, token_hash, created_at, expires_at, revoked_at, replaced_by
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE`, tokenHash)
+	return token, err
+}
+
+// Пометить refresh-токен использованным и сослаться на выданный вместо него
+func RotateRefreshToken(tx *sqlx.Tx, id int, replacedBy int) error {
+	_, err := tx.Exec(`
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP, replaced_by = $1
+		WHERE id = $2`, replacedBy, id)
+	return err
+}
+
+// Отозвать все действующие refresh-токены сессии
+func RevokeSessionRefreshTokens(tx *sqlx.Tx, sessionID string) error {
+	_, err := tx.Exec(`
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE session_id = $1 AND revoked_at IS NULL`, sessionID)
+	return err
+}
+
+// Отозвать все действующие refresh-токены пользователя
+func RevokeUserRefreshTokens(tx *sqlx.Tx, userID int) error {
+	_, err := tx.Exec(`
+		UPDATE refresh_tokens
+		SET revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND revoked_at IS NULL`, userID)
+	return err
+}
+
+// Добавить access-токен в список отозванных до истечения его срока
+func RevokeAccessToken(tx *sqlx.Tx, tokenID string, userID int, expiresAt time.Time) error {
+	_, err := tx.Exec(`
+		INSERT INTO revoked_tokens (jti, user_id, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (jti) DO NOTHING`, tokenID, userID, expiresAt)
+	return err
+}
+
+// Проверить, отозван ли access-токен
+func IsAccessTokenRevoked(tokenID string) (bool, error) {
+	var revoked bool
+	err := db.GetDBConn().Get(&revoked, `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`, tokenID)
+	return revoked, err
+}
+
+// Удалить истёкшие refresh-токены и записи об отозванных access-токенах: после истечения срока они не нужны
+func DeleteExpiredTokens(now time.Time) (int64, error) {
+	result, err := db.GetDBConn().Exec(`DELETE FROM refresh_tokens WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	refresh, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err = db.GetDBConn().Exec(`DELETE FROM revoked_tokens WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	access, err := result.RowsAffected()
+	return refresh + access, err
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"SB/internal/db"
+	"SB/internal/models"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// Второй фактор пользователя
+func GetUserTOTP(userID int) (models.UserTOTP, error) {
+	var totp models.UserTOTP
+	err := db.GetDBConn().Get(&totp, `
+		SELECT user_id, secret, confirmed_at, last_step, created_at, failed_attempts, locked_until
+		FROM user_totp
+		WHERE user_id = $1`, userID)
+	return totp, err
+}
+
+// Сохранить новый секрет для подключения. Подтверждённый второй фактор не перезаписывается, тогда возвращается false
+func SaveTOTPSecret(userID int, secret string) (bool, error) {
+	result, err := db.GetDBConn().Exec(`
+		INSERT INTO user_totp (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_step = 0, created_at = CURRENT_TIMESTAMP
+		WHERE user_totp.confirmed_at IS NULL`, userID, secret)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// Отметить подключение второго фактора завершённым
+func ConfirmTOTP(tx *sqlx.Tx, userID int) error {
+	_, err := tx.Exec(`UPDATE user_totp SET confirmed_at = CURRENT_TIMESTAMP WHERE user_id = $1`, userID)
+	return err
+}
+
+// Принять интервал TOTP. Возвращает false, если код этого или более позднего интервала уже использован
+func UseTOTPStep(userID int, step int64) (bool, error) {
+	result, err := db.GetDBConn().Exec(`
+		UPDATE user_totp
+		SET last_step = $1
+		WHERE user_id = $2 AND last_step < $1`, step, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// Засчитать неверный код. На maxFailures-й ошибке проверка кодов блокируется до lockUntil, а счётчик начинается заново.
+// Возвращает true, если этот код привёл к блокировке
+func RegisterTOTPFailure(userID, maxFailures int, lockUntil time.Time) (bool, error) {
+	var locked bool
+	err := db.GetDBConn().Get(&locked, `
+		UPDATE user_totp
+		SET failed_attempts = CASE WHEN failed_attempts + 1 >= $2 THEN 0 ELSE failed_attempts + 1 END,
+		    locked_until = CASE WHEN failed_attempts + 1 >= $2 THEN $3 ELSE locked_until END
+		WHERE user_id = $1
+		RETURNING failed_attempts = 0`, userID, maxFailures, lockUntil)
+	return locked, err
+}
+
+// Сбросить счётчик неверных кодов после верного
+func ResetTOTPFailures(userID int) error {
+	_, err := db.GetDBConn().Exec(`
+		UPDATE user_totp
+		SET failed_attempts = 0
+		WHERE user_id = $1 AND failed_attempts > 0`, userID)
+	return err
+}
+
+// Отключить второй фактор вместе с кодами восстановления
+func DeleteUserTOTP(tx *sqlx.Tx, userID int) error {
+	_, err := tx.Exec(`DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM user_totp WHERE user_id = $1`, userID)
+	return err
+}
+
+// Заменить коды восстановления пользователя новыми
+func ReplaceRecoveryCodes(tx *sqlx.Tx, userID int, codeHashes []string) error {
+	_, err := tx.Exec(`DELETE FROM totp_recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		_, err = tx.Exec(`INSERT INTO totp_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Погасить код восстановления. Возвращает false, если такого неиспользованного кода нет
+func UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	result, err := db.GetDBConn().Exec(`
+		UPDATE totp_recovery_codes
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// Сохранить вход, ожидающий второй фактор
+func CreateMFAChallenge(challenge *models.MFAChallenge) error {
+	return db.GetDBConn().QueryRow(`
+		INSERT INTO mfa_challenges (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id`, challenge.UserID, challenge.TokenHash, challenge.ExpiresAt).Scan(&challenge.ID)
+}
+
+// Взять вход, ожидающий второй фактор, строка блокируется до конца транзакции
+func GetMFAChallengeForUpdate(tx *sqlx.Tx, tokenHash string) (models.MFAChallenge, error) {
+	var challenge models.MFAChallenge
+	err := tx.Get(&challenge, `
+		SELECT id, user_id, token_hash, expires_at, attempts, used_at
+		FROM mfa_challenges
+		WHERE token_hash = $1
+		FOR UPDATE`, tokenHash)
+	return challenge, err
+}
+
+// Сохранить число попыток и отметку об использовании
+func SaveMFAChallenge(tx *sqlx.Tx, challenge *models.MFAChallenge) error {
+	_, err := tx.Exec(`
+		UPDATE mfa_challenges
+		SET attempts = $1, used_at = $2
+		WHERE id = $3`, challenge.Attempts, challenge.UsedAt, challenge.ID)
+	return err
+}
+
+// Удалить истёкшие входы, ожидающие второй фактор
+func DeleteExpiredMFAChallenges(now time.Time) (int64, error) {
+	result, err := db.GetDBConn().Exec(`DELETE FROM mfa_challenges WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
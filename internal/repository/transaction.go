@@ -9,20 +9,9 @@ import (
 
 var (
 	createTransferQuery = `insert into 
-    transactions (from_account_id, to_account_id, amount, currency) 
-	values ($1, $2, $3, $4) 
-	returning id, from_account_id, to_account_id, amount, created_at`
-
-	createEntryQuery = `insert into 
-    entries (account_id, amount) 
-	values ($1, $2) 
-	returning id, account_id, amount, created_at`
-
-	updateAccountQuery = `update accounts 
-	set balance = balance + $2 
-	where id = $1
-	and active = true 
-	returning id, user_id, balance, currency, created_at`
+    transactions (from_account_id, to_account_id, amount, currency, to_amount, to_currency, exchange_rate) 
+	values ($1, $2, $3, $4, $5, $6, $7) 
+	returning id, from_account_id, to_account_id, amount, currency, to_amount, to_currency, exchange_rate, created_at`
 )
 
 // Создать транзакцию
@@ -43,109 +32,21 @@ func CreateTransaction(trnx *models.Transfer) (*models.TransferTxResult, error)
 	}()
 
 	var transfer models.Transfer
-	err = tx.QueryRow(
+	err = tx.QueryRowx(
 		createTransferQuery,
 		trnx.FromAccountID,
 		trnx.ToAccountID,
 		trnx.Amount,
 		trnx.Currency,
-	).Scan(
-		&transfer.ID,
-		&transfer.FromAccountID,
-		&transfer.ToAccountID,
-		&transfer.Amount,
-		&transfer.CreatedAt)
+		trnx.ToAmount,
+		trnx.ToCurrency,
+		trnx.ExchangeRate,
+	).StructScan(&transfer)
 	if err != nil {
 		return nil, err
 	}
 
-	transfer.Currency = trnx.Currency
-
-	var entry1 models.Entry
-	err = tx.QueryRow(
-		createEntryQuery,
-		trnx.FromAccountID,
-		-trnx.Amount,
-	).Scan(
-		&entry1.ID,
-		&entry1.AccountID,
-		&entry1.Amount,
-		&entry1.CreatedAt,
-	)
-
-	if err != nil {
-		return nil, err
-	}
-
-	var entry2 models.Entry
-	err = tx.QueryRow(
-		createEntryQuery,
-		trnx.ToAccountID,
-		trnx.Amount,
-	).Scan(
-		&entry2.ID,
-		&entry2.AccountID,
-		&entry2.Amount,
-		&entry2.CreatedAt,
-	)
-	if err != nil {
-		return nil, err
-	}
-	var (
-		fromAccount models.Account
-		toAccount   models.Account
-	)
-
-	if trnx.FromAccountID < trnx.ToAccountID {
-		err = tx.QueryRow(
-			updateAccountQuery,
-			trnx.FromAccountID,
-			-trnx.Amount,
-		).Scan(
-			&fromAccount.ID,
-			&fromAccount.UserID,
-			&fromAccount.Balance,
-			&fromAccount.Currency,
-			&fromAccount.CreatedAt,
-		)
-
-		err = tx.QueryRow(
-			updateAccountQuery,
-			trnx.ToAccountID,
-			trnx.Amount,
-		).Scan(
-			&toAccount.ID,
-			&toAccount.UserID,
-			&toAccount.Balance,
-			&toAccount.Currency,
-			&toAccount.CreatedAt,
-		)
-	} else {
-		err = tx.QueryRow(
-			updateAccountQuery,
-			trnx.ToAccountID,
-			trnx.Amount,
-		).Scan(
-			&toAccount.ID,
-			&toAccount.UserID,
-			&toAccount.Balance,
-			&toAccount.Currency,
-			&toAccount.CreatedAt,
-		)
-
-		err = tx.QueryRow(
-			updateAccountQuery,
-			trnx.FromAccountID,
-			-trnx.Amount,
-		).Scan(
-			&fromAccount.ID,
-			&fromAccount.UserID,
-			&fromAccount.Balance,
-			&fromAccount.Currency,
-			&fromAccount.CreatedAt,
-		)
-	}
-
+	journal, accounts, err := PostJournal(tx, models.OperationTransfer, &transfer.ID, transferPostings(&transfer))
 	if err != nil {
 		return nil, err
 	}
@@ -157,19 +58,38 @@ func CreateTransaction(trnx *models.Transfer) (*models.TransferTxResult, error)
 
 	res := &models.TransferTxResult{
 		Transfer:    transfer,
-		FromAccount: fromAccount,
-		ToAccount:   toAccount,
-		FromEntry:   entry1,
-		ToEntry:     entry2,
+		FromAccount: accounts[trnx.FromAccountID],
+		ToAccount:   accounts[trnx.ToAccountID],
+		FromEntry:   journal.Entries[0],
+		ToEntry:     journal.Entries[len(journal.Entries)-1],
 	}
 	return res, err
 }
 
+// Проводки перевода. Для разных валют деньги проходят через счёт конвертации,
+// чтобы журнал сходился по каждой валюте отдельно
+func transferPostings(transfer *models.Transfer) []models.Posting {
+	if transfer.Currency == transfer.ToCurrency {
+		return []models.Posting{
+			{AccountID: transfer.FromAccountID, Amount: -transfer.Amount, Currency: transfer.Currency},
+			{AccountID: transfer.ToAccountID, Amount: transfer.ToAmount, Currency: transfer.ToCurrency},
+		}
+	}
+
+	rate := transfer.ExchangeRate
+	return []models.Posting{
+		{AccountID: transfer.FromAccountID, Amount: -transfer.Amount, Currency: transfer.Currency, ExchangeRate: &rate},
+		{SystemAccount: models.SystemAccountFxClearing, Amount: transfer.Amount, Currency: transfer.Currency, ExchangeRate: &rate},
+		{SystemAccount: models.SystemAccountFxClearing, Amount: -transfer.ToAmount, Currency: transfer.ToCurrency, ExchangeRate: &rate},
+		{AccountID: transfer.ToAccountID, Amount: transfer.ToAmount, Currency: transfer.ToCurrency, ExchangeRate: &rate},
+	}
+}
+
 // Взять транзакцию по ID
 func GetTransactionByID(id int) (models.Transfer, error) {
 	var tx models.Transfer
 	err := db.GetDBConn().Get(&tx, `
-		SELECT id, from_account_id, to_account_id, amount, commission, created_at
+		SELECT id, from_account_id, to_account_id, amount, currency, to_amount, to_currency, exchange_rate, created_at
 		FROM transactions
 		WHERE id = $1`, id)
 	return tx, err
@@ -179,7 +99,7 @@ func GetTransactionByID(id int) (models.Transfer, error) {
 func GetTransactionsByToAccountID(toAccountID int) ([]models.Transfer, error) {
 	var txs []models.Transfer
 	err := db.GetDBConn().Select(&txs, `
-		SELECT id, from_account_id, to_account_id, amount, commission, created_at
+		SELECT id, from_account_id, to_account_id, amount, currency, to_amount, to_currency, exchange_rate, created_at
 		FROM transactions
 		WHERE to_account_id = $1`, toAccountID)
 	return txs, err
@@ -189,7 +109,7 @@ func GetTransactionsByToAccountID(toAccountID int) ([]models.Transfer, error) {
 func GetTransactionsByFromAccountID(fromAccountID int) ([]models.Transfer, error) {
 	var txs []models.Transfer
 	err := db.GetDBConn().Select(&txs, `
-		SELECT id, from_account_id, to_account_id, amount, commission, created_at
+		SELECT id, from_account_id, to_account_id, amount, currency, to_amount, to_currency, exchange_rate, created_at
 		FROM transactions
 		WHERE from_account_id = $1`, fromAccountID)
 	return txs, err
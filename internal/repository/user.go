@@ -3,21 +3,25 @@ package repository
 import (
 	"SB/internal/db"
 	"SB/internal/models"
+	"github.com/jmoiron/sqlx"
 )
 
-// Создать пользователя
-func CreateUser(user *models.User) (int, error) {
+// Имя пользователя для входа из user_identifiers, в запросе таблица users должна быть без псевдонима
+const usernameColumn = `COALESCE((SELECT value FROM user_identifiers WHERE user_id = users.id AND kind = 'username'), '') AS username`
+
+// Создать пользователя в рамках транзакции
+func CreateUser(tx *sqlx.Tx, user *models.User) (int, error) {
 	var id int
-	err := db.GetDBConn().QueryRow(`
+	err := tx.QueryRow(`
 		INSERT INTO users (full_name, password)
 		VALUES ($1, $2) RETURNING id`,
 		user.FullName, user.Password).Scan(&id)
 	return id, err
 }
 
-// Изменить пользователя (только если active = true)
-func UpdateUser(user *models.User) error {
-	_, err := db.GetDBConn().Exec(`
+// Изменить пользователя в рамках транзакции (только если active = true)
+func UpdateUser(tx *sqlx.Tx, user *models.User) error {
+	_, err := tx.Exec(`
 		UPDATE users
 		SET full_name = $1, password = $2, updated_at = CURRENT_TIMESTAMP
 		WHERE id = $3 AND active = TRUE AND deleted_at IS NULL`,
@@ -26,8 +30,8 @@ func UpdateUser(user *models.User) error {
 }
 
 // Мягкое удаление пользователя (deleted_at = now)
-func DeleteUser(id int) error {
-	_, err := db.GetDBConn().Exec(`
+func DeleteUser(tx *sqlx.Tx, id int) error {
+	_, err := tx.Exec(`
 		UPDATE users
 		SET deleted_at = CURRENT_TIMESTAMP, active = false
 		WHERE id = $1`, id)
@@ -38,60 +42,69 @@ func DeleteUser(id int) error {
 func GetUserByID(id int) (models.User, error) {
 	var user models.User
 	err := db.GetDBConn().Get(&user, `
-		SELECT id, full_name, password, created_at, updated_at, deleted_at, active
+		SELECT id, full_name, `+usernameColumn+`, password, created_at, updated_at, deleted_at, active
 		FROM users
 		WHERE id = $1 AND active = TRUE AND deleted_at IS NULL`, id)
 	return user, err
 }
 
-func GetUserByNameForRestore(fullName string) (models.User, error) {
-	var user models.User
-	err := db.GetDBConn().Get(&user, `
-		SELECT id, full_name, password, created_at, updated_at, active, deleted_at
-		FROM users
-		WHERE full_name = $1 AND active = FALSE`, fullName)
-	return user, err
+// Заблокировать строку активного пользователя до конца транзакции.
+// Так операции над данными одного пользователя (например, открытие счетов) выполняются по очереди
+func LockUser(tx *sqlx.Tx, userID int) error {
+	var id int
+	return tx.Get(&id, `
+		SELECT id FROM users
+		WHERE id = $1 AND active = TRUE AND deleted_at IS NULL
+		FOR UPDATE`, userID)
 }
 
-func RestoreUser(userID int) error {
-	_, err := db.GetDBConn().Exec(`
+// Восстановить удалённого пользователя. Возвращает false, если удалённого пользователя с таким ID нет
+func RestoreUser(userID int) (bool, error) {
+	result, err := db.GetDBConn().Exec(`
 		UPDATE users
 		SET deleted_at = NULL, active = TRUE
-		WHERE id = $1`, userID)
-	return err
+		WHERE id = $1 AND active = FALSE`, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
 }
 
-// Взять пользователя по имени (только если active = true)
-func GetUserByFullName(fullName string) (*models.User, error) {
+// Взять активного пользователя по подтверждённому идентификатору
+func GetUserByIdentifier(kind, value string) (*models.User, error) {
 	var user models.User
 	err := db.GetDBConn().Get(&user, `
-		SELECT id, full_name, password, created_at, updated_at, active, deleted_at
+		SELECT users.id, users.full_name, `+usernameColumn+`, users.password,
+		       users.created_at, users.updated_at, users.active, users.deleted_at
 		FROM users
-		WHERE full_name = $1 AND active = TRUE AND deleted_at IS NULL`, fullName)
+		JOIN user_identifiers i ON i.user_id = users.id
+		WHERE i.kind = $1 AND i.value = $2 AND i.verified_at IS NOT NULL
+		  AND users.active = TRUE AND users.deleted_at IS NULL`, kind, value)
 	return &user, err
 }
 
-// Взять всех неактивных пользователей
-func GetInactiveUsers() ([]models.User, error) {
-	var users []models.User
-	err := db.GetDBConn().Select(&users, `
-		SELECT id, full_name, password, created_at, updated_at, active, deleted_at
-		FROM users
-		WHERE active = FALSE`)
-	return users, err
+// Списки пользователей: сортировка по id, дате создания или имени
+var userListSpec = listSpec[models.User]{
+	columns: `id, full_name, ` + usernameColumn + `, password, created_at, updated_at, active, deleted_at`,
+	from:    "users",
+	id:      func(user models.User) int { return user.ID },
+	sorts: map[string]sortField[models.User]{
+		"id":         {column: "id", value: func(user models.User) string { return sortInt(user.ID) }},
+		"created_at": {column: "created_at", value: func(user models.User) string { return sortTime(user.CreatedAt) }},
+		"full_name":  {column: "full_name", value: func(user models.User) string { return user.FullName }},
+	},
 }
 
-// Поиск по имени
-func GetUserByNameFilter(name string) ([]models.User, error) {
-	var users []models.User
-	query := `
-		SELECT id, full_name, password, created_at, updated_at, active, deleted_at
-		FROM users
-		WHERE full_name ILIKE $1 AND active = true AND deleted_at IS NULL`
+// Страница неактивных пользователей
+func GetInactiveUsers(page models.PageParams) (models.Page[models.User], error) {
+	return selectPage(userListSpec, "active = FALSE", nil, page)
+}
 
+// Поиск по имени, постранично
+func GetUserByNameFilter(name string, page models.PageParams) (models.Page[models.User], error) {
 	// Добавляем % для шаблона поиска
 	namePattern := "%" + name + "%"
 
-	err := db.GetDBConn().Select(&users, query, namePattern)
-	return users, err
+	return selectPage(userListSpec, "full_name ILIKE $1 AND active = TRUE AND deleted_at IS NULL", []any{namePattern}, page)
 }
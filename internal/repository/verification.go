@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"SB/internal/db"
+	"SB/internal/models"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const verificationCodeColumns = `id, user_id, kind, target, code_hash, expires_at, attempts, used_at, created_at`
+
+// Последний код подтверждения пользователя для вида идентификатора
+func GetLatestVerificationCode(userID int, kind string) (models.VerificationCode, error) {
+	var code models.VerificationCode
+	err := db.GetDBConn().Get(&code, `
+		SELECT `+verificationCodeColumns+`
+		FROM verification_codes
+		WHERE user_id = $1 AND kind = $2
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1`, userID, kind)
+	return code, err
+}
+
+// Последний код с блокировкой строки до конца транзакции
+func GetLatestVerificationCodeForUpdate(tx *sqlx.Tx, userID int, kind string) (models.VerificationCode, error) {
+	var code models.VerificationCode
+	err := tx.Get(&code, `
+		SELECT `+verificationCodeColumns+`
+		FROM verification_codes
+		WHERE user_id = $1 AND kind = $2
+		ORDER BY created_at DESC, id DESC
+		LIMIT 1
+		FOR UPDATE`, userID, kind)
+	return code, err
+}
+
+// Сохранить новый код, прежние коды для этого вида идентификатора перестают действовать
+func ReplaceVerificationCode(tx *sqlx.Tx, code *models.VerificationCode) error {
+	_, err := tx.Exec(`DELETE FROM verification_codes WHERE user_id = $1 AND kind = $2`, code.UserID, code.Kind)
+	if err != nil {
+		return err
+	}
+	return tx.QueryRow(`
+		INSERT INTO verification_codes (user_id, kind, target, code_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		code.UserID, code.Kind, code.Target, code.CodeHash, code.ExpiresAt, code.CreatedAt).Scan(&code.ID)
+}
+
+// Удалить код, который не удалось отправить
+func DeleteVerificationCode(id int) error {
+	_, err := db.GetDBConn().Exec(`DELETE FROM verification_codes WHERE id = $1`, id)
+	return err
+}
+
+// Сохранить число попыток и отметку об использовании
+func SaveVerificationCode(tx *sqlx.Tx, code *models.VerificationCode) error {
+	_, err := tx.Exec(`
+		UPDATE verification_codes
+		SET attempts = $1, used_at = $2
+		WHERE id = $3`, code.Attempts, code.UsedAt, code.ID)
+	return err
+}
+
+// Отметить идентификатор подтверждённым, если у пользователя всё ещё это значение.
+// Если значение уже подтвердил другой пользователь - ErrIdentifierTaken
+func VerifyUserIdentifier(tx *sqlx.Tx, userID int, kind, value string, verifiedAt time.Time) (bool, error) {
+	result, err := tx.Exec(`
+		UPDATE user_identifiers
+		SET verified_at = $4
+		WHERE user_id = $1 AND kind = $2 AND value = $3`, userID, kind, value, verifiedAt)
+	if err != nil {
+		return false, translateIdentifierError(err)
+	}
+	rows, err := result.RowsAffected()
+	return rows > 0, err
+}
+
+// Удалить неподтверждённые заявки других пользователей на то же значение вместе с их кодами.
+// Возвращает id пользователей, у которых значение удалено
+func DeleteCompetingIdentifiers(tx *sqlx.Tx, userID int, kind, value string) ([]int, error) {
+	var userIDs []int
+	err := tx.Select(&userIDs, `
+		DELETE FROM user_identifiers
+		WHERE kind = $2 AND value = $3 AND user_id <> $1 AND verified_at IS NULL
+		RETURNING user_id`, userID, kind, value)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM verification_codes
+		WHERE kind = $2 AND target = $3 AND user_id <> $1`, userID, kind, value)
+	return userIDs, err
+}
+
+// Удалить истёкшие коды подтверждения
+func DeleteExpiredVerificationCodes(now time.Time) (int64, error) {
+	result, err := db.GetDBConn().Exec(`DELETE FROM verification_codes WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
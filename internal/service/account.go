@@ -1,60 +1,123 @@
 package service
 
 import (
+	"SB/internal/configs"
+	"SB/internal/db"
 	"SB/internal/errs"
 	"SB/internal/models"
 	"SB/internal/repository"
 	"database/sql"
 	"errors"
+	"strconv"
 )
 
-// Валидные валюты ISO 4217 (пример)
-var validCurrencies = map[string]bool{
-	"USD": true,
-	"EUR": true,
-	"RUB": true,
+func isValidAccountPurpose(purpose string) bool {
+	return purpose == models.AccountPurposeCurrent || purpose == models.AccountPurposeSavings
 }
 
-// Проверка валидности валюты
-func IsValidCurrency(currency string) bool {
-	return validCurrencies[currency]
-}
-
-// Создать аккаунт
-func CreateAccount(account *models.Account) error {
-	// Проверка, что пользователь существует и активен
-	_, err := repository.GetUserByID(account.UserID)
+// Найти счёт пользователя в нужной валюте: сперва текущий, затем любой другой.
+// Используется, когда клиент не указал счёт явно (выдача кредита, выплата депозита)
+func FindUserAccount(userID int, currency string) (*models.Account, error) {
+	accounts, err := repository.GetAccountsByUserID(userID)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return errs.ErrNotFound
+		return nil, err
+	}
+
+	var found *models.Account
+	for i := range accounts {
+		if accounts[i].Currency != currency {
+			continue
+		}
+		if accounts[i].Purpose == models.AccountPurposeCurrent {
+			return &accounts[i], nil
+		}
+		if found == nil {
+			found = &accounts[i]
 		}
-		return err
 	}
 
+	if found == nil {
+		return nil, errs.ErrNoAccountForCurrency
+	}
+	return found, nil
+}
+
+// Создать аккаунт. Строка пользователя блокируется на время проверок,
+// поэтому параллельные запросы не обойдут лимит и уникальность валюты
+func CreateAccount(account *models.Account) (err error) {
 	// Валидация валюты
 	if !IsValidCurrency(account.Currency) {
 		return errs.ErrInvalidCurrency
 	}
 
-	// Проверка лимита аккаунтов
-	accountExists, err := repository.GetAccountsByUserID(account.UserID)
+	// Валидация назначения счёта
+	if account.Purpose == "" {
+		account.Purpose = models.AccountPurposeCurrent
+	}
+	if !isValidAccountPurpose(account.Purpose) {
+		return errs.ErrInvalidAccountPurpose
+	}
+
+	tx, err := db.GetDBConn().Beginx()
 	if err != nil {
-		if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	// Проверка, что пользователь существует и активен
+	if err = repository.LockUser(tx, account.UserID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errs.ErrNotFound
+		}
+		return err
+	}
+
+	// Проверка лимита аккаунтов
+	params := configs.AppSettings.AccountParams
+	if params.MaxAccountsPerUser > 0 {
+		var count int
+		if count, err = repository.CountUserAccounts(tx, account.UserID); err != nil {
 			return err
 		}
+		if count >= params.MaxAccountsPerUser {
+			return errs.ErrAccountLimitReached
+		}
 	}
 
-	if accountExists.ID > 0 {
-		return errs.ErrAccountAlreadyExists
+	// Один счёт на валюту для каждого назначения; то же гарантирует уникальный индекс в БД
+	if params.UniquePerCurrency {
+		var exists bool
+		if exists, err = repository.AccountExists(tx, account.UserID, account.Currency, account.Purpose); err != nil {
+			return err
+		}
+		if exists {
+			return errs.ErrAccountAlreadyExists
+		}
 	}
 
-	// Создаем аккаунт через репозиторий
-	return repository.CreateAccount(account)
+	if err = repository.CreateAccount(tx, account); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// Обновить аккаунт
-func UpdateAccount(account *models.UpdateAccount) (*models.Account, error) {
-	existing, err := repository.GetAccountByID(account.ID)
+// Обновить аккаунт. Чужой аккаунт и баланс может менять только пользователь с правом canManage
+func UpdateAccount(account *models.UpdateAccount, canManage bool) (result *models.Account, err error) {
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	existing, err := repository.GetAccountByIDForUpdate(tx, account.ID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, errs.ErrNotFound
@@ -62,30 +125,66 @@ func UpdateAccount(account *models.UpdateAccount) (*models.Account, error) {
 		return nil, err
 	}
 
-	if existing.UserID != account.UserID && account.UserID != AdminID {
+	if existing.UserID != account.UserID && !canManage {
 		return nil, errs.ErrFraud
 	}
 
-	if account.Currency != nil {
+	// Валюта меняется только у пустого счёта без проводок: конвертации здесь нет,
+	// а старые записи журнала остались бы в прежней валюте
+	if account.Currency != nil && *account.Currency != existing.Currency {
 		if !IsValidCurrency(*account.Currency) {
 			return nil, errs.ErrInvalidCurrency
 		}
+		if existing.Balance != 0 {
+			return nil, errs.ErrCurrencyChange
+		}
+
+		var exists bool
+		if exists, err = repository.AccountHasEntries(tx, existing.ID); err != nil {
+			return nil, err
+		}
+		if exists {
+			return nil, errs.ErrCurrencyChange
+		}
+
+		if configs.AppSettings.AccountParams.UniquePerCurrency {
+			if exists, err = repository.AccountExists(tx, existing.UserID, *account.Currency, existing.Purpose); err != nil {
+				return nil, err
+			}
+			if exists {
+				return nil, errs.ErrAccountAlreadyExists
+			}
+		}
 		existing.Currency = *account.Currency
 	}
 
+	// Баланс меняется только проводкой через журнал и только с правом на управление счетами
+	if account.Balance != nil && *account.Balance != existing.Balance {
+		if !canManage {
+			return nil, errs.ErrFraud
+		}
+
+		if err = adjustBalance(tx, existing.ID, existing.Currency, *account.Balance-existing.Balance); err != nil {
+			return nil, err
+		}
+		existing.Balance = *account.Balance
+	}
+
 	if account.PhoneNumber != nil {
 		existing.PhoneNumber = *account.PhoneNumber
 	}
 
-	if account.Balance != nil {
-		existing.Balance = *account.Balance
+	if err = repository.UpdateAccount(tx, &existing); err != nil {
+		return nil, err
 	}
-
-	return &existing, repository.UpdateAccount(&existing)
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &existing, nil
 }
 
 // Мягкое удаление аккаунта
-func DeleteAccount(accountID int, userID int) error {
+func DeleteAccount(accountID int, userID int, canManage bool) error {
 	account, err := repository.GetAccountByID(accountID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -98,7 +197,7 @@ func DeleteAccount(accountID int, userID int) error {
 		return errs.ErrNoZeroBalance
 	}
 
-	if account.UserID != userID && userID != AdminID {
+	if account.UserID != userID && !canManage {
 		return errs.ErrFraud
 	}
 
@@ -106,7 +205,7 @@ func DeleteAccount(accountID int, userID int) error {
 }
 
 // Получить аккаунт по ID
-func GetAccountByID(accountID int) (*models.Account, error) {
+func GetAccountByID(accountID int, requesterUserID int, isAdmin bool) (*models.Account, error) {
 	account, err := repository.GetAccountByID(accountID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -114,47 +213,64 @@ func GetAccountByID(accountID int) (*models.Account, error) {
 		}
 		return nil, err
 	}
+
+	if account.UserID != requesterUserID && !isAdmin {
+		return nil, errs.ErrFraud
+	}
 	return &account, nil
 }
 
-// Получить аккаунты пользователя
-func GetAccountByUserID(userID int) (*models.Account, error) {
+// Получить аккаунты пользователя (свои или с правом accounts.read)
+func GetAccountsByUserID(userID int, requesterUserID int, isAdmin bool, page models.PageParams) (models.Page[models.Account], error) {
+	if userID != requesterUserID && !isAdmin {
+		return models.Page[models.Account]{}, errs.ErrFraud
+	}
+
 	_, err := repository.GetUserByID(userID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errs.ErrNotFound
+			return models.Page[models.Account]{}, errs.ErrNotFound
 		}
-		return nil, err
+		return models.Page[models.Account]{}, err
 	}
 
-	return repository.GetAccountsByUserID(userID)
+	return repository.GetAccountsPageByUserID(userID, pageParams(page))
 }
 
-// Получить неактивные аккаунты (только для админа)
-func GetInactiveAccounts() ([]models.Account, error) {
-	return repository.GetInactiveAccounts()
+// Получить неактивные аккаунты (право accounts.read)
+func GetInactiveAccounts(page models.PageParams) (models.Page[models.Account], error) {
+	return repository.GetInactiveAccounts(pageParams(page))
 }
 
-// Получить аккаунты по валюте
-func GetAccountsByCurrency(currency string) ([]models.Account, error) {
+// Получить аккаунты по валюте. Без права accounts.read - только свои
+func GetAccountsByCurrency(currency string, requesterUserID int, isAdmin bool, page models.PageParams) (models.Page[models.Account], error) {
 	if !IsValidCurrency(currency) {
-		return nil, errs.ErrInvalidCurrency
+		return models.Page[models.Account]{}, errs.ErrInvalidCurrency
+	}
+
+	if !isAdmin {
+		filters := make(map[string]string, len(page.Filters)+1)
+		for name, value := range page.Filters {
+			filters[name] = value
+		}
+		filters["user_id"] = strconv.Itoa(requesterUserID)
+		page.Filters = filters
 	}
-	return repository.GetAccountsByCurrency(currency)
+	return repository.GetAccountsByCurrency(currency, pageParams(page))
 }
 
-// Получить баланс аккаунта (с проверкой прав)
-func GetAccountBalance(accountID int, requesterUserID int, isAdmin bool) (int64, error) {
+// Получить баланс аккаунта и его валюту (с проверкой прав)
+func GetAccountBalance(accountID int, requesterUserID int, isAdmin bool) (models.Money, string, error) {
 	account, err := repository.GetAccountByID(accountID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return 0, errs.ErrNotFound
+			return 0, "", errs.ErrNotFound
 		}
-		return 0, err
+		return 0, "", err
 	}
 
 	if account.UserID != requesterUserID && !isAdmin {
-		return 0, errs.ErrFraud
+		return 0, "", errs.ErrFraud
 	}
-	return account.Balance, nil
+	return account.Balance, account.Currency, nil
 }
@@ -11,7 +11,7 @@ func WriteAuditLog(action, entity string, entityID, userID int) error {
 	_, err := db.GetDBConn().Exec(`
 		INSERT INTO audit_logs (action, entity, entity_id, user_id, timestamp)
 		VALUES ($1, $2, $3, $4, $5)`,
-		action, entity, entityID, userID, time.Now())
+		action, entity, entityID, userID, time.Now().UTC())
 	return err
 }
 
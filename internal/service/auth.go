@@ -0,0 +1,233 @@
+package service
+
+import (
+	"SB/internal/configs"
+	"SB/internal/db"
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"SB/logger"
+	"SB/utils"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+const defaultRefreshTTL = 30 * 24 * time.Hour
+
+func refreshTTL() time.Duration {
+	hours := configs.AppSettings.AuthParams.RefreshTtlHours
+	if hours <= 0 {
+		return defaultRefreshTTL
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Выдать access- и refresh-токен в рамках сессии. Роли и разрешения читаются заново,
+// поэтому изменения ролей попадают в токен при входе и при каждом обновлении
+func issueTokens(tx *sqlx.Tx, user *models.User, sessionID string) (*models.TokenPair, *models.RefreshToken, error) {
+	roles, permissions, err := repository.GetUserAccess(user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := getCurrentSigningKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	accessToken, accessExpiresAt, err := utils.GenerateToken(key, user.ID, user.Username, sessionID, roles, permissions)
+	if err != nil {
+		return nil, nil, errs.ErrGenerateToken
+	}
+
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, nil, errs.ErrGenerateToken
+	}
+
+	stored := &models.RefreshToken{
+		UserID:    user.ID,
+		SessionID: sessionID,
+		TokenHash: hashRefreshToken(refreshToken),
+		ExpiresAt: time.Now().UTC().Add(refreshTTL()),
+	}
+	if err = repository.CreateRefreshToken(tx, stored); err != nil {
+		return nil, nil, err
+	}
+
+	return &models.TokenPair{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: stored.ExpiresAt,
+	}, stored, nil
+}
+
+// Начать новую сессию пользователя
+func startSession(user *models.User) (tokens *models.TokenPair, err error) {
+	sessionID, err := utils.RandomToken(16)
+	if err != nil {
+		return nil, errs.ErrGenerateToken
+	}
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	tokens, _, err = issueTokens(tx, user, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Обменять refresh-токен на новую пару. Каждый refresh-токен одноразовый: повторное предъявление
+// уже использованного токена означает утечку, и вся сессия отзывается
+func RefreshTokens(refreshToken string) (tokens *models.TokenPair, err error) {
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	stored, err := repository.GetRefreshTokenForUpdate(tx, hashRefreshToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errs.ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	if stored.RevokedAt != nil {
+		if stored.ReplacedBy == nil {
+			err = errs.ErrInvalidRefreshToken
+			return nil, err
+		}
+		logger.Warn.Printf("[service] RefreshTokens(): refresh token %d of user %d reused, revoking session", stored.ID, stored.UserID)
+		if err = repository.RevokeSessionRefreshTokens(tx, stored.SessionID); err != nil {
+			return nil, err
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, err
+		}
+		return nil, errs.ErrRefreshTokenReused
+	}
+
+	if !time.Now().UTC().Before(stored.ExpiresAt) {
+		err = errs.ErrInvalidRefreshToken
+		return nil, err
+	}
+
+	user, err := repository.GetUserByID(stored.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errs.ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	tokens, renewed, err := issueTokens(tx, &user, stored.SessionID)
+	if err != nil {
+		return nil, err
+	}
+	if err = repository.RotateRefreshToken(tx, stored.ID, renewed.ID); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Выйти: текущий access-токен попадает в список отозванных, refresh-токены сессии отзываются.
+// allSessions отзывает refresh-токены всех сессий пользователя
+func Logout(userID int, tokenID, sessionID string, expiresAt time.Time, allSessions bool) (err error) {
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = repository.RevokeAccessToken(tx, tokenID, userID, expiresAt.UTC()); err != nil {
+		return err
+	}
+
+	if allSessions {
+		err = repository.RevokeUserRefreshTokens(tx, userID)
+	} else {
+		err = repository.RevokeSessionRefreshTokens(tx, sessionID)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Проверить, отозван ли access-токен
+func IsTokenRevoked(tokenID string) (bool, error) {
+	return repository.IsAccessTokenRevoked(tokenID)
+}
+
+// Фоновая задача: удалить истёкшие refresh-токены и записи об отозванных access-токенах
+func RunTokenCleanupJob(now time.Time) error {
+	deleted, err := repository.DeleteExpiredTokens(now.UTC())
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logger.Info.Printf("[service] RunTokenCleanupJob(): %d expired tokens deleted", deleted)
+	}
+
+	deleted, err = repository.DeleteExpiredMFAChallenges(now.UTC())
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logger.Info.Printf("[service] RunTokenCleanupJob(): %d expired sign-in challenges deleted", deleted)
+	}
+
+	deleted, err = repository.DeleteExpiredVerificationCodes(now.UTC())
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logger.Info.Printf("[service] RunTokenCleanupJob(): %d expired verification codes deleted", deleted)
+	}
+
+	deleted, err = repository.DeleteExpiredPasswordResets(now.UTC())
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logger.Info.Printf("[service] RunTokenCleanupJob(): %d expired password resets deleted", deleted)
+	}
+	return nil
+}
@@ -1,22 +1,21 @@
 package service
 
 import (
+	"SB/internal/configs"
 	"SB/internal/db"
 	"SB/internal/errs"
 	"SB/internal/models"
 	"SB/internal/repository"
+	"database/sql"
 	"errors"
 	"fmt"
+	"github.com/jmoiron/sqlx"
+	"strings"
 	"time"
 )
 
-// Валидация ISO валюты (простейшая)
-//func isValidCurrency(currency string) bool {
-//	validCurrencies := map[string]bool{"USD": true, "EUR": true, "RUB": true}
-//	return validCurrencies[currency]
-//}
-
-// Максимальные ограничения для кредитов (пример)
+// Максимальные ограничения для кредитов (пример). Сумма в основных единицах валюты,
+// для проверки переводится в минимальные по точности валюты кредита
 const (
 	MaxCreditAmount   = 1_000_000
 	MaxCreditDuration = 60 // месяцев
@@ -24,7 +23,68 @@ const (
 	MaxInterestRate   = 100.0
 )
 
-// Создать заявку на кредит
+// Допустимые переходы между статусами кредита
+var creditTransitions = map[string][]string{
+	models.CreditStatusPending:   {models.CreditStatusApproved, models.CreditStatusRejected},
+	models.CreditStatusApproved:  {models.CreditStatusDisbursed},
+	models.CreditStatusDisbursed: {models.CreditStatusRepaid, models.CreditStatusDefaulted},
+	models.CreditStatusDefaulted: {models.CreditStatusRepaid},
+}
+
+func validateCreditTerms(credit *models.Credit) error {
+	currency, err := GetCurrency(credit.Currency)
+	if err != nil {
+		return err
+	}
+	maxAmount := models.MoneyFromMajor(MaxCreditAmount, currency.MinorUnits)
+	if credit.Amount <= 0 || credit.Amount > maxAmount {
+		return fmt.Errorf("%w: amount must be > 0 and <= %s", errs.ErrInvalidAmount, maxAmount.Format(currency.MinorUnits))
+	}
+	if credit.DurationMonths <= 0 || credit.DurationMonths > MaxCreditDuration {
+		return fmt.Errorf("%w: duration_months must be > 0 and <= %d", errs.ErrInvalidDuration, MaxCreditDuration)
+	}
+	if credit.InterestRate < MinInterestRate || credit.InterestRate > MaxInterestRate {
+		return errs.ErrInvalidInterestRate
+	}
+	return nil
+}
+
+// Перевести кредит в новый статус в рамках транзакции и записать переход в историю и аудит
+func changeCreditStatus(tx *sqlx.Tx, credit *models.Credit, to string, reason *string, changedBy int) error {
+	from := credit.Status
+
+	allowed := false
+	for _, next := range creditTransitions[from] {
+		if next == to {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("%w: %s -> %s", errs.ErrInvalidCreditTransition, from, to)
+	}
+
+	credit.Status = to
+	switch to {
+	case models.CreditStatusRejected, models.CreditStatusRepaid:
+		credit.Active = false
+	}
+
+	if err := repository.SaveCreditState(tx, credit); err != nil {
+		return err
+	}
+
+	return repository.WriteCreditStatusChange(tx, &models.CreditStatusChange{
+		CreditID:   credit.ID,
+		FromStatus: &from,
+		ToStatus:   to,
+		Reason:     reason,
+		ChangedBy:  changedBy,
+	})
+}
+
+// Создать заявку на кредит. Счёт для зачисления можно указать сразу,
+// иначе при выдаче будет выбран текущий счёт клиента в валюте кредита
 func CreateCredit(credit *models.Credit) (int, error) {
 	user, err := repository.GetUserByID(credit.UserID)
 	if err != nil {
@@ -34,23 +94,52 @@ func CreateCredit(credit *models.Credit) (int, error) {
 		return 0, errs.ErrUserNotActive
 	}
 
-	if credit.Amount <= 0 || credit.Amount > MaxCreditAmount {
-		return 0, fmt.Errorf("amount must be > 0 and <= %d", MaxCreditAmount)
+	if err = validateCreditTerms(credit); err != nil {
+		return 0, err
 	}
-	if !IsValidCurrency(credit.Currency) {
-		return 0, fmt.Errorf("invalid currency")
+
+	if credit.AccountID != nil {
+		account, err := repository.GetAccountByID(*credit.AccountID)
+		if err != nil {
+			return 0, errs.ErrNotFound
+		}
+		if account.UserID != credit.UserID {
+			return 0, errs.ErrFraud
+		}
+		if account.Currency != credit.Currency {
+			return 0, errs.ErrInvalidCurrency
+		}
 	}
-	if credit.DurationMonths <= 0 || credit.DurationMonths > MaxCreditDuration {
-		return 0, fmt.Errorf("duration_months must be > 0 and <= %d", MaxCreditDuration)
+
+	credit.Status = models.CreditStatusPending
+	credit.Active = true
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return 0, err
 	}
-	if credit.InterestRate < MinInterestRate || credit.InterestRate > MaxInterestRate {
-		return 0, fmt.Errorf("interest_rate must be between %.2f and %.2f", MinInterestRate, MaxInterestRate)
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	credit.ID, err = repository.CreateCredit(tx, credit)
+	if err != nil {
+		return 0, err
 	}
 
-	credit.Active = true
-	credit.CreatedAt = time.Now()
+	err = repository.WriteCreditStatusChange(tx, &models.CreditStatusChange{
+		CreditID:  credit.ID,
+		ToStatus:  models.CreditStatusPending,
+		ChangedBy: credit.UserID,
+	})
+	if err != nil {
+		return 0, err
+	}
 
-	return repository.CreateCredit(credit)
+	err = tx.Commit()
+	return credit.ID, err
 }
 
 // Обновить кредит (только если активен и не одобрен)
@@ -62,159 +151,239 @@ func UpdateCredit(credit *models.Credit) error {
 	if !existing.Active {
 		return errs.ErrCreditNotActive
 	}
-	if existing.ApprovedAt != nil {
-		return errors.New("approved credits cannot be updated")
+	if existing.Status != models.CreditStatusPending {
+		return errs.ErrInvalidCreditTransition
 	}
 
-	if credit.Amount <= 0 || credit.Amount > MaxCreditAmount {
-		return fmt.Errorf("amount must be > 0 and <= %d", MaxCreditAmount)
+	if err = validateCreditTerms(credit); err != nil {
+		return err
 	}
-	if !IsValidCurrency(credit.Currency) {
-		return fmt.Errorf("invalid currency")
+
+	return repository.UpdateCredit(credit)
+}
+
+// Одобрить заявку (право credits.decide) и сразу выдать кредит на счёт клиента.
+// Одобрение, зачисление денег и оба перехода статуса происходят в одной транзакции
+func ApproveCredit(creditID int, adminID int) (result *models.Credit, err error) {
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return nil, err
 	}
-	if credit.DurationMonths <= 0 || credit.DurationMonths > MaxCreditDuration {
-		return fmt.Errorf("duration_months must be > 0 and <= %d", MaxCreditDuration)
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	credit, err := repository.GetCreditByIDForUpdate(tx, creditID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errs.ErrNotFound
+		}
+		return nil, err
 	}
-	if credit.InterestRate < MinInterestRate || credit.InterestRate > MaxInterestRate {
-		return fmt.Errorf("interest_rate must be between %.2f and %.2f", MinInterestRate, MaxInterestRate)
+
+	// Счёт из заявки мог быть закрыт или переведён в другую валюту, пока заявка ждала решения,
+	// поэтому он проверяется заново и блокируется до конца выдачи
+	accountID := 0
+	if credit.AccountID != nil {
+		accountID = *credit.AccountID
+	} else {
+		var found *models.Account
+		if found, err = FindUserAccount(credit.UserID, credit.Currency); err != nil {
+			return nil, err
+		}
+		accountID = found.ID
 	}
 
-	return repository.UpdateCredit(credit)
+	account, err := repository.GetAccountByIDForUpdate(tx, accountID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errs.ErrAccountNotActive
+		}
+		return nil, err
+	}
+	if account.UserID != credit.UserID || account.Currency != credit.Currency {
+		return nil, errs.ErrCreditAccountMismatch
+	}
+
+	now := time.Now().UTC()
+	credit.ApprovedAt = &now
+	credit.DecidedBy = &adminID
+	if err = changeCreditStatus(tx, &credit, models.CreditStatusApproved, nil, adminID); err != nil {
+		return nil, err
+	}
+
+	_, _, err = repository.PostJournal(tx, models.OperationCreditDisbursement, &credit.ID,
+		creditDisbursementPostings(account.ID, credit.Currency, credit.Amount))
+	if err != nil {
+		return nil, err
+	}
+
+	credit.AccountID = &account.ID
+	credit.Outstanding = credit.Amount
+	credit.DisbursedAt = &now
+	if err = changeCreditStatus(tx, &credit, models.CreditStatusDisbursed, nil, adminID); err != nil {
+		return nil, err
+	}
+
+	// График платежей фиксируется в момент выдачи
+	err = repository.CreateCreditInstallments(tx,
+		buildCreditSchedule(credit.ID, credit.Amount, credit.DurationMonths, credit.InterestRate, now))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return &credit, nil
 }
 
-// Одобрить кредит (админ)
-//func ApproveCredit(creditID int) error {
-//	credit, err := repository.GetCreditByID(creditID)
-//	if err != nil {
-//		return errs.ErrNotFound
-//	}
-//	if !credit.Active {
-//		return errs.ErrCreditNotActive
-//	}
-//	if credit.ApprovedAt != nil {
-//		return errors.New("credit already approved")
-//	}
-//
-//	accounts, err := repository.GetAccountsByUserID(credit.UserID)
-//	if err != nil {
-//		return err
-//	}
-//
-//	var targetAccount *models.Account
-//	for i := range accounts {
-//		if accounts[i].Currency == credit.Currency && accounts[i].Active {
-//			targetAccount = &accounts[i]
-//			break
-//		}
-//	}
-//	if targetAccount == nil {
-//		return errors.New("no active account found for user with matching currency")
-//	}
-//
-//	tx, err := db.GetDBConn().Begin()
-//	if err != nil {
-//		return err
-//	}
-//	defer func() {
-//		if err != nil {
-//			_ = tx.Rollback()
-//		}
-//	}()
-//
-//	now := time.Now()
-//	_, err = tx.Exec(`
-//		UPDATE credits SET approved_at = $1 WHERE id = $2`,
-//		now, credit.ID)
-//	if err != nil {
-//		return err
-//	}
-//
-//	newBalance := targetAccount.Balance + credit.Amount
-//	_, err = tx.Exec(`
-//		UPDATE accounts SET balance = $1, updated_at = $2 WHERE id = $3`,
-//		newBalance, now, targetAccount.ID)
-//	if err != nil {
-//		return err
-//	}
-//
-//	err = tx.Commit()
-//	return err
-//}
-
-// Получить кредит по ID (только если активен)
+// Отклонить заявку (право credits.decide) с указанием причины
+func RejectCredit(creditID int, adminID int, reason string) (result *models.Credit, err error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errs.ErrReasonRequired
+	}
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	credit, err := repository.GetCreditByIDForUpdate(tx, creditID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errs.ErrNotFound
+		}
+		return nil, err
+	}
+
+	credit.RejectionReason = &reason
+	credit.DecidedBy = &adminID
+	if err = changeCreditStatus(tx, &credit, models.CreditStatusRejected, &reason, adminID); err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return &credit, nil
+}
+
+// Получить кредит по ID
 func GetCreditByID(creditID int) (*models.Credit, error) {
 	credit, err := repository.GetCreditByID(creditID)
 	if err != nil {
 		return nil, errs.ErrNotFound
 	}
-	if !credit.Active {
-		return nil, errs.ErrCreditNotActive
-	}
 	return &credit, nil
 }
 
-// Получить кредиты пользователя (только активные)
-func GetCreditsByUserID(userID int) ([]models.Credit, error) {
+// Получить кредит по ID с проверкой владельца
+func GetUserCredit(creditID int, userID int, isAdmin bool) (*models.Credit, error) {
+	credit, err := GetCreditByID(creditID)
+	if err != nil {
+		return nil, err
+	}
+	if credit.UserID != userID && !isAdmin {
+		return nil, errs.ErrFraud
+	}
+	return credit, nil
+}
+
+// История статусов кредита с проверкой владельца
+func GetCreditStatusHistory(creditID int, userID int, isAdmin bool) ([]models.CreditStatusChange, error) {
+	if _, err := GetUserCredit(creditID, userID, isAdmin); err != nil {
+		return nil, err
+	}
+	return repository.GetCreditStatusHistory(creditID)
+}
+
+// Получить кредиты пользователя (во всех статусах)
+func GetCreditsByUserID(userID int, page models.PageParams) (models.Page[models.Credit], error) {
 	user, err := repository.GetUserByID(userID)
 	if err != nil {
-		return nil, errs.ErrNotFound
+		return models.Page[models.Credit]{}, errs.ErrNotFound
 	}
 	if !user.Active {
-		return nil, errs.ErrUserNotActive
+		return models.Page[models.Credit]{}, errs.ErrUserNotActive
 	}
-	return repository.GetCreditsByUserID(userID)
+	return repository.GetCreditsPageByUserID(userID, pageParams(page))
 }
 
-// Получить активные кредиты (админ)
-func GetActiveCredits() ([]models.Credit, error) {
-	return repository.GetActiveCredits()
+// Получить кредиты в статусе (право credits.read)
+func GetCreditsByStatus(status string, page models.PageParams) (models.Page[models.Credit], error) {
+	switch status {
+	case models.CreditStatusPending, models.CreditStatusApproved, models.CreditStatusRejected,
+		models.CreditStatusDisbursed, models.CreditStatusRepaid, models.CreditStatusDefaulted:
+	default:
+		return models.Page[models.Credit]{}, errs.ErrInvalidCreditStatus
+	}
+	return repository.GetCreditsByStatus(status, pageParams(page))
 }
 
-// Получить неактивные кредиты (админ)
-func GetInactiveCredits() ([]models.Credit, error) {
-	return repository.GetInactiveCredits()
+// Получить активные кредиты (право credits.read)
+func GetActiveCredits(page models.PageParams) (models.Page[models.Credit], error) {
+	return repository.GetActiveCredits(pageParams(page))
+}
+
+// Получить неактивные кредиты (право credits.read)
+func GetInactiveCredits(page models.PageParams) (models.Page[models.Credit], error) {
+	return repository.GetInactiveCredits(pageParams(page))
 }
 
 // Получить кредиты по валюте
-func GetCreditsByCurrency(currency string) ([]models.Credit, error) {
+func GetCreditsByCurrency(currency string, page models.PageParams) (models.Page[models.Credit], error) {
 	if !IsValidCurrency(currency) {
-		return nil, fmt.Errorf("invalid currency")
+		return models.Page[models.Credit]{}, errs.ErrInvalidCurrency
 	}
-	return repository.GetCreditsByCurrency(currency)
+	return repository.GetCreditsByCurrency(currency, pageParams(page))
 }
 
-// Погашение кредита
-func RepayCredit(creditID, accountID int, amountToPay int64) error {
-	credit, err := repository.GetCreditByID(creditID)
-	if err != nil {
-		return errs.ErrNotFound
-	}
-	if !credit.Active {
-		return errs.ErrCreditNotActive
-	}
-	if credit.Amount <= 0 {
-		return errors.New("credit amount invalid")
+// Счёт заёмщика для погашения: указанный клиентом или текущий счёт в валюте кредита
+func creditPaymentAccount(credit *models.Credit, accountID int, amount models.Money) (*models.Account, error) {
+	if accountID == 0 {
+		found, err := FindUserAccount(credit.UserID, credit.Currency)
+		if err != nil {
+			return nil, err
+		}
+		accountID = found.ID
 	}
 
 	account, err := repository.GetAccountByID(accountID)
 	if err != nil {
-		return errs.ErrNotFound
+		return nil, errs.ErrNotFound
+	}
+	if account.UserID != credit.UserID {
+		return nil, errs.ErrFraud
 	}
-	if !account.Active {
-		return errs.ErrAccountNotActive
+	if account.Currency != credit.Currency {
+		return nil, errs.ErrInvalidCurrency
 	}
-	if account.Balance < amountToPay {
-		return errors.New("insufficient funds on account")
+	if account.Balance < amount {
+		return nil, errs.ErrInsufficientFunds
 	}
+	return &account, nil
+}
 
-	remaining := credit.Amount - amountToPay
-	if remaining < 0 {
-		return errors.New("overpayment not allowed")
+// Погашение кредита со счёта заёмщика
+func RepayCredit(creditID, accountID int, amountToPay models.Money, userID int) (result *models.Credit, err error) {
+	if amountToPay <= 0 {
+		return nil, errs.ErrInvalidAmount
 	}
 
-	tx, err := db.GetDBConn().Begin()
+	tx, err := db.GetDBConn().Beginx()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer func() {
 		if err != nil {
@@ -222,66 +391,75 @@ func RepayCredit(creditID, accountID int, amountToPay int64) error {
 		}
 	}()
 
-	newBalance := account.Balance - amountToPay
-	_, err = tx.Exec(`UPDATE accounts SET balance = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, newBalance, account.ID)
+	credit, err := repository.GetCreditByIDForUpdate(tx, creditID)
 	if err != nil {
-		return err
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errs.ErrNotFound
+		}
+		return nil, err
+	}
+	if credit.UserID != userID {
+		return nil, errs.ErrFraud
+	}
+	if credit.Status != models.CreditStatusDisbursed && credit.Status != models.CreditStatusDefaulted {
+		return nil, errs.ErrCreditNotActive
 	}
 
-	newActive := remaining > 0
-	_, err = tx.Exec(`UPDATE credits SET amount = $1, active = $2 WHERE id = $3`, remaining, newActive, credit.ID)
+	installments, err := repository.GetOpenCreditInstallmentsForUpdate(tx, credit.ID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = tx.Commit()
-	return err
-}
-
-// График платежей - аннуитетный метод
-func CalculatePaymentSchedule(amount int64, months int, rate float64) ([]PaymentScheduleEntry, error) {
-	if amount <= 0 || months <= 0 || rate < 0 {
-		return nil, errors.New("invalid parameters for schedule calculation")
+	// Платёж распределяется по графику: сперва неустойка и проценты, затем тело.
+	// Кредиты, выданные до появления графиков, гасятся только по телу
+	now := time.Now().UTC()
+	var principal, interest, penalty models.Money
+	if len(installments) == 0 {
+		if amountToPay > credit.Outstanding {
+			return nil, errs.ErrOverpayment
+		}
+		principal = amountToPay
+	} else {
+		// Неустойка доначисляется на дату платежа, чтобы клиент мог погасить просрочку целиком
+		applyOverdue(installments, now, configs.AppSettings.CreditParams.PenaltyRate)
+		principal, interest, penalty, err = allocateRepayment(installments, amountToPay, now)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	rateMonthly := rate / 100 / 12
-	var annuity float64
-
-	if rateMonthly == 0 {
-		annuity = float64(amount) / float64(months)
-	} else {
-		annuity = float64(amount) * rateMonthly / (1 - (1 / pow(1+rateMonthly, months)))
+	account, err := creditPaymentAccount(&credit, accountID, amountToPay)
+	if err != nil {
+		return nil, err
 	}
 
-	var schedule []PaymentScheduleEntry
-	for i := 1; i <= months; i++ {
-		date := time.Now().AddDate(0, i, 0)
-		interest := float64(amount) * rateMonthly
-		principal := annuity - interest
-		schedule = append(schedule, PaymentScheduleEntry{
-			Month:     i,
-			DueDate:   date,
-			Payment:   annuity,
-			Principal: principal,
-			Interest:  interest,
-		})
+	_, _, err = repository.PostJournal(tx, models.OperationCreditRepayment, &credit.ID,
+		creditRepaymentPostings(account.ID, credit.Currency, principal, interest, penalty))
+	if err != nil {
+		return nil, err
 	}
 
-	return schedule, nil
-}
+	for i := range installments {
+		if err = repository.SaveCreditInstallment(tx, &installments[i]); err != nil {
+			return nil, err
+		}
+	}
 
-type PaymentScheduleEntry struct {
-	Month     int
-	DueDate   time.Time
-	Payment   float64
-	Principal float64
-	Interest  float64
-}
+	credit.Outstanding -= principal
+	credit.DaysPastDue = daysPastDue(installments, now)
+	credit.DelinquencyBucket = delinquencyBucket(credit.DaysPastDue)
+	if credit.Outstanding == 0 {
+		err = changeCreditStatus(tx, &credit, models.CreditStatusRepaid, nil, userID)
+	} else {
+		err = repository.SaveCreditState(tx, &credit)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-func pow(x float64, y int) float64 {
-	result := 1.0
-	for i := 0; i < y; i++ {
-		result *= x
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
 	}
-	return result
+	return &credit, nil
 }
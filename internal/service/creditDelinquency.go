@@ -0,0 +1,189 @@
+package service
+
+import (
+	"SB/internal/configs"
+	"SB/internal/db"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"SB/logger"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Кредит считается дефолтным, когда просрочка превышает это число дней
+const DefaultAfterDays = 90
+
+// Изменения, сделанные фоновыми задачами, записываются от имени системы
+const SystemUserID = 0
+
+func delinquencyBucket(days int) string {
+	switch {
+	case days <= 0:
+		return models.DelinquencyCurrent
+	case days <= 30:
+		return models.Delinquency1To30
+	case days <= 60:
+		return models.Delinquency31To60
+	case days <= DefaultAfterDays:
+		return models.Delinquency61To90
+	default:
+		return models.Delinquency90Plus
+	}
+}
+
+// Пометить просроченные платежи и доначислить неустойку по дневной ставке (в процентах)
+// на просроченные тело и проценты. Неустойка считается с даты последнего начисления,
+// поэтому повторный запуск в тот же день ничего не добавляет
+func applyOverdue(installments []models.CreditInstallment, now time.Time, penaltyRate float64) {
+	today := truncateToDay(now)
+	for i := range installments {
+		inst := &installments[i]
+		if inst.Status == models.InstallmentStatusPaid || !inst.DueDate.Before(today) {
+			continue
+		}
+		inst.Status = models.InstallmentStatusOverdue
+
+		from := inst.DueDate
+		if inst.PenaltyAccruedOn != nil && inst.PenaltyAccruedOn.After(from) {
+			from = *inst.PenaltyAccruedOn
+		}
+		days := daysBetween(from, today)
+		if days <= 0 || penaltyRate <= 0 {
+			continue
+		}
+
+		inst.Penalty += inst.Overdue().MulRound(penaltyRate / 100 * float64(days))
+		inst.PenaltyAccruedOn = &today
+	}
+}
+
+// Дни просрочки по самому раннему неоплаченному платежу
+func daysPastDue(installments []models.CreditInstallment, now time.Time) int {
+	today := truncateToDay(now)
+	for _, inst := range installments {
+		if inst.Due() > 0 && inst.DueDate.Before(today) {
+			return daysBetween(inst.DueDate, today)
+		}
+	}
+	return 0
+}
+
+// Обновить просрочку одного кредита в отдельной транзакции
+func processCreditDelinquency(creditID int, now time.Time) (err error) {
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	credit, err := repository.GetCreditByIDForUpdate(tx, creditID)
+	if err != nil {
+		return err
+	}
+	if credit.Status != models.CreditStatusDisbursed && credit.Status != models.CreditStatusDefaulted {
+		return tx.Commit()
+	}
+
+	installments, err := repository.GetOpenCreditInstallmentsForUpdate(tx, creditID)
+	if err != nil {
+		return err
+	}
+
+	applyOverdue(installments, now, configs.AppSettings.CreditParams.PenaltyRate)
+	for i := range installments {
+		if err = repository.SaveCreditInstallment(tx, &installments[i]); err != nil {
+			return err
+		}
+	}
+
+	credit.DaysPastDue = daysPastDue(installments, now)
+	credit.DelinquencyBucket = delinquencyBucket(credit.DaysPastDue)
+
+	if credit.Status == models.CreditStatusDisbursed && credit.DaysPastDue > DefaultAfterDays {
+		reason := fmt.Sprintf("%d days past due", credit.DaysPastDue)
+		err = changeCreditStatus(tx, &credit, models.CreditStatusDefaulted, &reason, SystemUserID)
+	} else {
+		err = repository.SaveCreditState(tx, &credit)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Фоновая задача: пометить просроченные платежи, начислить неустойку, разложить кредиты по корзинам просрочки
+// и перевести в дефолт кредиты с просрочкой больше 90 дней. Ошибка по одному кредиту не останавливает остальные
+func RunCreditDelinquencyJob(now time.Time) error {
+	ids, err := repository.GetCreditIDsForDelinquencyCheck(truncateToDay(now))
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, id := range ids {
+		err = processCreditDelinquency(id, now)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			logger.Error.Printf("[service] RunCreditDelinquencyJob(): credit %d: %v", id, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("delinquency check failed for %d of %d credits", failed, len(ids))
+	}
+	return nil
+}
+
+// Отчёт о портфеле под риском: доля остатка долга по кредитам с просрочкой больше 30, 60 и 90 дней
+func GetPortfolioAtRisk() (*models.PortfolioAtRiskReport, error) {
+	buckets, err := repository.GetPortfolioBuckets()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.PortfolioAtRiskReport{GeneratedAt: time.Now().UTC()}
+	index := make(map[string]int)
+	for _, b := range buckets {
+		i, ok := index[b.Currency]
+		if !ok {
+			i = len(report.Currencies)
+			index[b.Currency] = i
+			report.Currencies = append(report.Currencies, models.PortfolioAtRiskLine{
+				Currency: b.Currency,
+				Buckets: map[string]models.Money{
+					models.DelinquencyCurrent: 0,
+					models.Delinquency1To30:   0,
+					models.Delinquency31To60:  0,
+					models.Delinquency61To90:  0,
+					models.Delinquency90Plus:  0,
+				},
+			})
+		}
+		line := &report.Currencies[i]
+		line.Credits += b.Credits
+		line.Outstanding += b.Outstanding
+		line.Buckets[b.Bucket] += b.Outstanding
+	}
+
+	for i := range report.Currencies {
+		line := &report.Currencies[i]
+		if line.Outstanding == 0 {
+			continue
+		}
+		par90 := line.Buckets[models.Delinquency90Plus]
+		par60 := par90 + line.Buckets[models.Delinquency61To90]
+		par30 := par60 + line.Buckets[models.Delinquency31To60]
+		line.PAR30 = float64(par30) / float64(line.Outstanding)
+		line.PAR60 = float64(par60) / float64(line.Outstanding)
+		line.PAR90 = float64(par90) / float64(line.Outstanding)
+	}
+
+	return report, nil
+}
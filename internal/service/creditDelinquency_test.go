@@ -0,0 +1,242 @@
+package service
+
+import (
+	"SB/internal/errs"
+	"SB/internal/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestDelinquencyBucket(t *testing.T) {
+	tests := []struct {
+		days int
+		want string
+	}{
+		{days: -1, want: models.DelinquencyCurrent},
+		{days: 0, want: models.DelinquencyCurrent},
+		{days: 1, want: models.Delinquency1To30},
+		{days: 30, want: models.Delinquency1To30},
+		{days: 31, want: models.Delinquency31To60},
+		{days: 60, want: models.Delinquency31To60},
+		{days: 61, want: models.Delinquency61To90},
+		{days: DefaultAfterDays, want: models.Delinquency61To90},
+		{days: DefaultAfterDays + 1, want: models.Delinquency90Plus},
+	}
+
+	for _, tt := range tests {
+		if got := delinquencyBucket(tt.days); got != tt.want {
+			t.Errorf("delinquencyBucket(%d) = %s, want %s", tt.days, got, tt.want)
+		}
+	}
+}
+
+func TestApplyOverdue(t *testing.T) {
+	accruedOn := day(2024, time.May, 8)
+	accruedToday := day(2024, time.May, 10)
+
+	tests := []struct {
+		name        string
+		inst        models.CreditInstallment
+		now         time.Time
+		penaltyRate float64
+		wantStatus  string
+		wantPenalty models.Money
+	}{
+		{
+			name:        "not due yet",
+			inst:        models.CreditInstallment{DueDate: day(2024, time.May, 10), Principal: 9000, Interest: 1000, Status: models.InstallmentStatusPending},
+			now:         day(2024, time.May, 9),
+			penaltyRate: 0.1,
+			wantStatus:  models.InstallmentStatusPending,
+		},
+		{
+			name:        "due today is not overdue",
+			inst:        models.CreditInstallment{DueDate: day(2024, time.May, 10), Principal: 9000, Interest: 1000, Status: models.InstallmentStatusPending},
+			now:         day(2024, time.May, 10).Add(15 * time.Hour),
+			penaltyRate: 0.1,
+			wantStatus:  models.InstallmentStatusPending,
+		},
+		{
+			name:        "five days overdue",
+			inst:        models.CreditInstallment{DueDate: day(2024, time.May, 5), Principal: 9000, Interest: 1000, Status: models.InstallmentStatusPending},
+			now:         day(2024, time.May, 10).Add(9 * time.Hour),
+			penaltyRate: 0.1,
+			wantStatus:  models.InstallmentStatusOverdue,
+			wantPenalty: 50,
+		},
+		{
+			name: "penalty only on the unpaid part",
+			inst: models.CreditInstallment{DueDate: day(2024, time.May, 5), Principal: 9000, Interest: 1000,
+				InterestPaid: 1000, PrincipalPaid: 4000, Status: models.InstallmentStatusPartial},
+			now:         day(2024, time.May, 10),
+			penaltyRate: 0.1,
+			wantStatus:  models.InstallmentStatusOverdue,
+			wantPenalty: 25,
+		},
+		{
+			name: "accrues from the last accrual date",
+			inst: models.CreditInstallment{DueDate: day(2024, time.May, 5), Principal: 9000, Interest: 1000,
+				Penalty: 30, PenaltyAccruedOn: &accruedOn, Status: models.InstallmentStatusOverdue},
+			now:         day(2024, time.May, 10),
+			penaltyRate: 0.1,
+			wantStatus:  models.InstallmentStatusOverdue,
+			wantPenalty: 50,
+		},
+		{
+			name: "second run on the same day adds nothing",
+			inst: models.CreditInstallment{DueDate: day(2024, time.May, 5), Principal: 9000, Interest: 1000,
+				Penalty: 50, PenaltyAccruedOn: &accruedToday, Status: models.InstallmentStatusOverdue},
+			now:         day(2024, time.May, 10).Add(23 * time.Hour),
+			penaltyRate: 0.1,
+			wantStatus:  models.InstallmentStatusOverdue,
+			wantPenalty: 50,
+		},
+		{
+			name:        "no penalty rate",
+			inst:        models.CreditInstallment{DueDate: day(2024, time.May, 5), Principal: 9000, Interest: 1000, Status: models.InstallmentStatusPending},
+			now:         day(2024, time.May, 10),
+			wantStatus:  models.InstallmentStatusOverdue,
+			wantPenalty: 0,
+		},
+		{
+			name: "paid installment is left alone",
+			inst: models.CreditInstallment{DueDate: day(2024, time.May, 5), Principal: 9000, Interest: 1000,
+				PrincipalPaid: 9000, InterestPaid: 1000, Status: models.InstallmentStatusPaid},
+			now:         day(2024, time.May, 10),
+			penaltyRate: 0.1,
+			wantStatus:  models.InstallmentStatusPaid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installments := []models.CreditInstallment{tt.inst}
+			applyOverdue(installments, tt.now, tt.penaltyRate)
+			if installments[0].Status != tt.wantStatus || installments[0].Penalty != tt.wantPenalty {
+				t.Errorf("applyOverdue() status = %s, penalty = %d, want %s, %d",
+					installments[0].Status, installments[0].Penalty, tt.wantStatus, tt.wantPenalty)
+			}
+		})
+	}
+}
+
+func TestDaysPastDue(t *testing.T) {
+	installments := []models.CreditInstallment{
+		{DueDate: day(2024, time.March, 10), Principal: 9000, Interest: 1000, PrincipalPaid: 9000, InterestPaid: 1000},
+		{DueDate: day(2024, time.April, 10), Principal: 9000, Interest: 1000, InterestPaid: 1000},
+		{DueDate: day(2024, time.May, 10), Principal: 9000, Interest: 1000},
+	}
+
+	tests := []struct {
+		now  time.Time
+		want int
+	}{
+		{now: day(2024, time.April, 10), want: 0},
+		{now: day(2024, time.April, 11), want: 1},
+		{now: day(2024, time.May, 20).Add(20 * time.Hour), want: 40},
+	}
+
+	for _, tt := range tests {
+		if got := daysPastDue(installments, tt.now); got != tt.want {
+			t.Errorf("daysPastDue() on %s = %d, want %d", tt.now.Format(time.DateOnly), got, tt.want)
+		}
+	}
+}
+
+func TestAllocateRepayment(t *testing.T) {
+	paidAt := day(2024, time.May, 20)
+	schedule := func() []models.CreditInstallment {
+		return []models.CreditInstallment{
+			{DueDate: day(2024, time.April, 10), Principal: 9000, Interest: 1000, Penalty: 200, Status: models.InstallmentStatusOverdue},
+			{DueDate: day(2024, time.May, 10), Principal: 9100, Interest: 900, Penalty: 100, Status: models.InstallmentStatusOverdue},
+			{DueDate: day(2024, time.June, 10), Principal: 9200, Interest: 800, Status: models.InstallmentStatusPending},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		amount        models.Money
+		wantErr       error
+		wantPrincipal models.Money
+		wantInterest  models.Money
+		wantPenalty   models.Money
+		wantStatuses  []string
+	}{
+		{
+			name:         "penalty first",
+			amount:       150,
+			wantPenalty:  150,
+			wantStatuses: []string{models.InstallmentStatusOverdue, models.InstallmentStatusOverdue, models.InstallmentStatusPending},
+		},
+		{
+			name:          "penalty, interest, then principal",
+			amount:        5200,
+			wantPenalty:   200,
+			wantInterest:  1000,
+			wantPrincipal: 4000,
+			wantStatuses:  []string{models.InstallmentStatusOverdue, models.InstallmentStatusOverdue, models.InstallmentStatusPending},
+		},
+		{
+			name:          "closes the oldest installment and moves on",
+			amount:        10500,
+			wantPenalty:   300,
+			wantInterest:  1200,
+			wantPrincipal: 9000,
+			wantStatuses:  []string{models.InstallmentStatusPaid, models.InstallmentStatusOverdue, models.InstallmentStatusPending},
+		},
+		{
+			name:          "pays ahead into a future installment",
+			amount:        20800,
+			wantPenalty:   300,
+			wantInterest:  2400,
+			wantPrincipal: 18100,
+			wantStatuses:  []string{models.InstallmentStatusPaid, models.InstallmentStatusPaid, models.InstallmentStatusPartial},
+		},
+		{
+			name:          "everything",
+			amount:        30300,
+			wantPenalty:   300,
+			wantInterest:  2700,
+			wantPrincipal: 27300,
+			wantStatuses:  []string{models.InstallmentStatusPaid, models.InstallmentStatusPaid, models.InstallmentStatusPaid},
+		},
+		{
+			name:    "more than due",
+			amount:  30301,
+			wantErr: errs.ErrOverpayment,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installments := schedule()
+			principal, interest, penalty, err := allocateRepayment(installments, tt.amount, paidAt)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("allocateRepayment() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if principal != tt.wantPrincipal || interest != tt.wantInterest || penalty != tt.wantPenalty {
+				t.Errorf("allocateRepayment() = %d, %d, %d, want %d, %d, %d",
+					principal, interest, penalty, tt.wantPrincipal, tt.wantInterest, tt.wantPenalty)
+			}
+			if principal+interest+penalty != tt.amount {
+				t.Errorf("allocated %d of %d", principal+interest+penalty, tt.amount)
+			}
+			for i, inst := range installments {
+				if inst.Status != tt.wantStatuses[i] {
+					t.Errorf("installment %d status = %s, want %s", i+1, inst.Status, tt.wantStatuses[i])
+				}
+				if inst.Status == models.InstallmentStatusPaid && (inst.PaidAt == nil || !inst.PaidAt.Equal(paidAt)) {
+					t.Errorf("installment %d paid_at = %v, want %s", i+1, inst.PaidAt, paidAt)
+				}
+			}
+		})
+	}
+}
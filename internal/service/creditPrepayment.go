@@ -0,0 +1,307 @@
+package service
+
+import (
+	"SB/internal/configs"
+	"SB/internal/db"
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Разбивка долга на дату: что уже подошло к оплате, проценты текущего периода и остаток тела
+type payoffSplit struct {
+	running     int // индекс первого платежа, срок которого ещё не наступил, или -1
+	periodStart time.Time
+	dueAmount   models.Money
+	accrued     models.Money
+	principal   models.Money
+}
+
+func (s payoffSplit) total() models.Money {
+	return s.dueAmount + s.accrued + s.principal
+}
+
+// Разбить долг по графику на дату asOf. Проценты текущего периода считаются пропорционально прошедшим дням.
+// Неустойка к этой дате должна быть уже доначислена
+func splitPayoff(credit *models.Credit, installments []models.CreditInstallment, asOf time.Time) payoffSplit {
+	day := truncateToDay(asOf)
+	split := payoffSplit{running: -1}
+
+	var duePrincipal models.Money
+	for i, inst := range installments {
+		if inst.Status == models.InstallmentStatusPaid {
+			continue
+		}
+		if !inst.DueDate.After(day) {
+			split.dueAmount += inst.Due()
+			duePrincipal += inst.Principal - inst.PrincipalPaid
+			continue
+		}
+		split.running = i
+		break
+	}
+	split.principal = credit.Outstanding - duePrincipal
+
+	if split.running < 0 {
+		return split
+	}
+
+	inst := installments[split.running]
+	split.periodStart = truncateToDay(*credit.DisbursedAt)
+	if split.running > 0 {
+		split.periodStart = installments[split.running-1].DueDate
+	}
+
+	period := daysBetween(split.periodStart, inst.DueDate)
+	elapsed := min(max(daysBetween(split.periodStart, day), 0), period)
+	if period > 0 {
+		split.accrued = max(inst.Interest.MulRound(float64(elapsed)/float64(period))-inst.InterestPaid, 0)
+	}
+
+	return split
+}
+
+// Перенести суммы, заранее уплаченные по удалённым платежам графика, на пересчитанный график: по порядку,
+// в каждом платеже сначала проценты, затем тело. Проценты, которым не хватило места, добавляются к последнему платежу,
+// потому что уже получены банком
+func carryPaidAmounts(schedule []models.CreditInstallment, principal, interest models.Money, paidAt time.Time) {
+	for i := range schedule {
+		if principal == 0 && interest == 0 {
+			break
+		}
+		inst := &schedule[i]
+
+		part := min(interest, inst.Interest)
+		inst.InterestPaid = part
+		interest -= part
+
+		part = min(principal, inst.Principal)
+		inst.PrincipalPaid = part
+		principal -= part
+
+		if i == len(schedule)-1 && interest > 0 {
+			inst.Interest += interest
+			inst.InterestPaid += interest
+			inst.Payment = inst.Principal + inst.Interest
+			interest = 0
+		}
+
+		switch {
+		case inst.Due() == 0:
+			inst.Status = models.InstallmentStatusPaid
+			inst.PaidAt = &paidAt
+		case inst.PrincipalPaid > 0 || inst.InterestPaid > 0:
+			inst.Status = models.InstallmentStatusPartial
+		}
+	}
+}
+
+// Сумма полного досрочного погашения на дату (не раньше сегодняшней)
+func GetPayoffQuote(creditID int, userID int, isAdmin bool, asOf time.Time) (*models.PayoffQuote, error) {
+	credit, err := GetUserCredit(creditID, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+	if credit.Status != models.CreditStatusDisbursed && credit.Status != models.CreditStatusDefaulted {
+		return nil, errs.ErrCreditNotActive
+	}
+
+	if asOf.IsZero() {
+		asOf = time.Now().UTC()
+	}
+	if truncateToDay(asOf).Before(truncateToDay(time.Now().UTC())) {
+		return nil, errs.ErrInvalidQuoteDate
+	}
+
+	installments, err := repository.GetCreditInstallments(credit.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(installments) == 0 {
+		return nil, errs.ErrNoCreditSchedule
+	}
+
+	applyOverdue(installments, asOf, configs.AppSettings.CreditParams.PenaltyRate)
+	split := splitPayoff(credit, installments, asOf)
+
+	return &models.PayoffQuote{
+		CreditID:        credit.ID,
+		AsOf:            truncateToDay(asOf),
+		Currency:        credit.Currency,
+		DueAmount:       split.dueAmount,
+		AccruedInterest: split.accrued,
+		Principal:       split.principal,
+		Total:           split.total(),
+	}, nil
+}
+
+// Досрочное погашение части или всего кредита.
+// Сначала гасится всё, что уже подошло к оплате, затем проценты текущего периода по сегодняшний день,
+// остаток идёт в тело. Текущий платёж графика закрывается датой погашения, оставшиеся платежи пересчитываются:
+// reduce_term - прежний платёж и меньше месяцев, reduce_installment - прежний срок и меньше платёж
+func PrepayCredit(creditID, accountID int, amount models.Money, mode string, userID int) (result *models.Credit, err error) {
+	if mode != models.PrepaymentReduceTerm && mode != models.PrepaymentReduceInstallment {
+		return nil, errs.ErrInvalidPrepaymentMode
+	}
+	if amount <= 0 {
+		return nil, errs.ErrInvalidAmount
+	}
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	credit, err := repository.GetCreditByIDForUpdate(tx, creditID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errs.ErrNotFound
+		}
+		return nil, err
+	}
+	if credit.UserID != userID {
+		return nil, errs.ErrFraud
+	}
+	if credit.Status != models.CreditStatusDisbursed && credit.Status != models.CreditStatusDefaulted {
+		return nil, errs.ErrCreditNotActive
+	}
+
+	installments, err := repository.GetCreditInstallmentsForUpdate(tx, credit.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(installments) == 0 {
+		return nil, errs.ErrNoCreditSchedule
+	}
+
+	now := time.Now().UTC()
+	today := truncateToDay(now)
+	applyOverdue(installments, now, configs.AppSettings.CreditParams.PenaltyRate)
+	split := splitPayoff(&credit, installments, now)
+
+	if amount > split.total() {
+		return nil, errs.ErrOverpayment
+	}
+	extra := amount - split.dueAmount
+	if extra < 0 || (extra > 0 && extra < split.accrued) {
+		return nil, errs.ErrPrepaymentTooSmall
+	}
+
+	account, err := creditPaymentAccount(&credit, accountID, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	// Всё, что уже подошло к оплате, гасится как обычный платёж
+	end := len(installments)
+	if split.running >= 0 {
+		end = split.running
+	}
+	principal, interest, penalty, err := allocateRepayment(installments[:end], split.dueAmount, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if split.running >= 0 && extra > 0 {
+		current := &installments[split.running]
+		dueDate := current.DueDate
+		payment := current.Payment
+		remaining := len(installments) - split.running
+
+		// Текущий платёж закрывается сегодняшней датой: проценты по сегодня и досрочно погашенное тело
+		current.Interest = current.InterestPaid + split.accrued
+		current.InterestPaid = current.Interest
+		current.Principal = current.PrincipalPaid + extra - split.accrued
+		current.PrincipalPaid = current.Principal
+		current.Payment = current.Principal + current.Interest
+		current.DueDate = today
+		current.Status = models.InstallmentStatusPaid
+		current.PaidAt = &now
+		interest += split.accrued
+		principal += extra - split.accrued
+
+		// Платежи после текущего могли быть оплачены заранее: их тело уже вычтено из остатка долга,
+		// поэтому новый график строится на остаток вместе с ним, а оплаченное переносится в новые платежи
+		var carriedPrincipal, carriedInterest models.Money
+		for _, inst := range installments[split.running+1:] {
+			carriedPrincipal += inst.PrincipalPaid
+			carriedInterest += inst.InterestPaid
+		}
+
+		balance := credit.Outstanding - principal + carriedPrincipal
+		current.Balance = balance
+
+		err = repository.DeleteCreditInstallmentsAfter(tx, credit.ID, current.Number)
+		if err != nil {
+			return nil, err
+		}
+
+		if balance > 0 {
+			rateMonthly := credit.InterestRate / 100 / 12
+
+			months := remaining
+			if mode == models.PrepaymentReduceTerm {
+				months = monthsToRepay(balance, payment, rateMonthly)
+			}
+			if months <= 0 || months > remaining || mode == models.PrepaymentReduceInstallment {
+				months = remaining
+				payment = annuityPayment(balance, rateMonthly, months)
+			}
+
+			// Первый новый платёж остаётся в прежнюю дату, проценты по нему - за дни после погашения
+			fraction := 1.0
+			if period := daysBetween(split.periodStart, dueDate); period > 0 {
+				fraction = min(float64(daysBetween(today, dueDate))/float64(period), 1)
+			}
+			anchor := truncateToDay(*credit.DisbursedAt)
+
+			schedule := amortize(credit.ID, balance, payment, rateMonthly,
+				current.Number+1, anchor, monthsBetween(anchor, dueDate), fraction, months)
+			carryPaidAmounts(schedule, carriedPrincipal, carriedInterest, now)
+
+			err = repository.CreateCreditInstallments(tx, schedule)
+			if err != nil {
+				return nil, err
+			}
+		}
+		end = split.running + 1
+	}
+
+	for i := 0; i < end; i++ {
+		if err = repository.SaveCreditInstallment(tx, &installments[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	_, _, err = repository.PostJournal(tx, models.OperationCreditPrepayment, &credit.ID,
+		creditRepaymentPostings(account.ID, credit.Currency, principal, interest, penalty))
+	if err != nil {
+		return nil, err
+	}
+
+	credit.Outstanding -= principal
+	credit.DaysPastDue = 0
+	credit.DelinquencyBucket = delinquencyBucket(0)
+	if credit.Outstanding == 0 {
+		err = changeCreditStatus(tx, &credit, models.CreditStatusRepaid, nil, userID)
+	} else {
+		err = repository.SaveCreditState(tx, &credit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return &credit, nil
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"SB/internal/models"
+	"testing"
+	"time"
+)
+
+func TestAddMonths(t *testing.T) {
+	tests := []struct {
+		from   time.Time
+		months int
+		want   time.Time
+	}{
+		{from: day(2024, time.January, 15), months: 1, want: day(2024, time.February, 15)},
+		{from: day(2024, time.January, 31), months: 1, want: day(2024, time.February, 29)},
+		{from: day(2023, time.January, 31), months: 1, want: day(2023, time.February, 28)},
+		{from: day(2024, time.January, 31), months: 2, want: day(2024, time.March, 31)},
+		{from: day(2024, time.March, 31), months: 1, want: day(2024, time.April, 30)},
+		{from: day(2024, time.November, 30), months: 3, want: day(2025, time.February, 28)},
+		{from: day(2024, time.December, 15), months: 13, want: day(2026, time.January, 15)},
+	}
+
+	for _, tt := range tests {
+		if got := addMonths(tt.from, tt.months); !got.Equal(tt.want) {
+			t.Errorf("addMonths(%s, %d) = %s, want %s", tt.from.Format(time.DateOnly), tt.months,
+				got.Format(time.DateOnly), tt.want.Format(time.DateOnly))
+		}
+	}
+}
+
+func TestMonthsToRepay(t *testing.T) {
+	tests := []struct {
+		name        string
+		balance     models.Money
+		payment     models.Money
+		rateMonthly float64
+		want        int
+	}{
+		{name: "zero rate, whole months", balance: 100000, payment: 10000, want: 10},
+		{name: "zero rate, part of a month left", balance: 100001, payment: 10000, want: 11},
+		{name: "with interest", balance: 100000, payment: 10000, rateMonthly: 0.01, want: 11},
+		{name: "payment only covers interest", balance: 100000, payment: 1000, rateMonthly: 0.01, want: 0},
+		{name: "no payment", balance: 100000, payment: 0, rateMonthly: 0.01, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := monthsToRepay(tt.balance, tt.payment, tt.rateMonthly); got != tt.want {
+				t.Errorf("monthsToRepay(%d, %d, %v) = %d, want %d", tt.balance, tt.payment, tt.rateMonthly, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitPayoff(t *testing.T) {
+	disbursedAt := day(2024, time.January, 15).Add(11 * time.Hour)
+	credit := &models.Credit{Outstanding: 18100, DisbursedAt: &disbursedAt}
+	schedule := func(runningInterestPaid models.Money) []models.CreditInstallment {
+		return []models.CreditInstallment{
+			{DueDate: day(2024, time.February, 15), Principal: 8900, Interest: 1100,
+				PrincipalPaid: 8900, InterestPaid: 1100, Status: models.InstallmentStatusPaid},
+			{DueDate: day(2024, time.March, 15), Principal: 9000, Interest: 1000,
+				InterestPaid: runningInterestPaid, Status: models.InstallmentStatusPending},
+			{DueDate: day(2024, time.April, 15), Principal: 9100, Interest: 900, Status: models.InstallmentStatusPending},
+		}
+	}
+
+	tests := []struct {
+		name                string
+		asOf                time.Time
+		runningInterestPaid models.Money
+		want                payoffSplit
+	}{
+		{
+			name: "in the middle of a period",
+			asOf: day(2024, time.March, 1).Add(17 * time.Hour),
+			want: payoffSplit{running: 1, periodStart: day(2024, time.February, 15), accrued: 517, principal: 18100},
+		},
+		{
+			name: "on the previous due date",
+			asOf: day(2024, time.February, 15),
+			want: payoffSplit{running: 1, periodStart: day(2024, time.February, 15), principal: 18100},
+		},
+		{
+			name:                "interest paid ahead is not accrued again",
+			asOf:                day(2024, time.March, 1),
+			runningInterestPaid: 600,
+			want:                payoffSplit{running: 1, periodStart: day(2024, time.February, 15), principal: 18100},
+		},
+		{
+			name: "after a missed due date",
+			asOf: day(2024, time.March, 20),
+			want: payoffSplit{running: 2, periodStart: day(2024, time.March, 15), dueAmount: 10000, accrued: 145, principal: 9100},
+		},
+		{
+			name: "after the last due date",
+			asOf: day(2024, time.April, 20),
+			want: payoffSplit{running: -1, dueAmount: 20000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitPayoff(credit, schedule(tt.runningInterestPaid), tt.asOf)
+			if got.running != tt.want.running || !got.periodStart.Equal(tt.want.periodStart) ||
+				got.dueAmount != tt.want.dueAmount || got.accrued != tt.want.accrued || got.principal != tt.want.principal {
+				t.Errorf("splitPayoff() = %+v, want %+v", got, tt.want)
+			}
+			if got.total() != tt.want.dueAmount+tt.want.accrued+tt.want.principal {
+				t.Errorf("total() = %d", got.total())
+			}
+		})
+	}
+}
+
+func TestCarryPaidAmounts(t *testing.T) {
+	paidAt := day(2024, time.March, 1)
+	schedule := func() []models.CreditInstallment {
+		return []models.CreditInstallment{
+			{Number: 3, Payment: 1100, Principal: 1000, Interest: 100, Status: models.InstallmentStatusPending},
+			{Number: 4, Payment: 1100, Principal: 1040, Interest: 60, Status: models.InstallmentStatusPending},
+			{Number: 5, Payment: 1050, Principal: 1030, Interest: 20, Status: models.InstallmentStatusPending},
+		}
+	}
+
+	type row struct {
+		principalPaid models.Money
+		interestPaid  models.Money
+		interest      models.Money
+		status        string
+	}
+	tests := []struct {
+		name      string
+		principal models.Money
+		interest  models.Money
+		want      []row
+	}{
+		{
+			name: "nothing paid ahead",
+			want: []row{
+				{interest: 100, status: models.InstallmentStatusPending},
+				{interest: 60, status: models.InstallmentStatusPending},
+				{interest: 20, status: models.InstallmentStatusPending},
+			},
+		},
+		{
+			name:      "covers the first installment and part of the second",
+			principal: 1200,
+			interest:  130,
+			want: []row{
+				{principalPaid: 1000, interestPaid: 100, interest: 100, status: models.InstallmentStatusPaid},
+				{principalPaid: 200, interestPaid: 30, interest: 60, status: models.InstallmentStatusPartial},
+				{interest: 20, status: models.InstallmentStatusPending},
+			},
+		},
+		{
+			name:     "interest beyond the new schedule stays on the last installment",
+			interest: 250,
+			want: []row{
+				{interestPaid: 100, interest: 100, status: models.InstallmentStatusPartial},
+				{interestPaid: 60, interest: 60, status: models.InstallmentStatusPartial},
+				{interestPaid: 90, interest: 90, status: models.InstallmentStatusPartial},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installments := schedule()
+			carryPaidAmounts(installments, tt.principal, tt.interest, paidAt)
+
+			var principal, interest models.Money
+			for i, inst := range installments {
+				want := tt.want[i]
+				if inst.PrincipalPaid != want.principalPaid || inst.InterestPaid != want.interestPaid ||
+					inst.Interest != want.interest || inst.Status != want.status {
+					t.Errorf("installment %d = paid %d/%d, interest %d, %s, want paid %d/%d, interest %d, %s",
+						inst.Number, inst.PrincipalPaid, inst.InterestPaid, inst.Interest, inst.Status,
+						want.principalPaid, want.interestPaid, want.interest, want.status)
+				}
+				if inst.Payment != inst.Principal+inst.Interest {
+					t.Errorf("installment %d payment %d != principal %d + interest %d",
+						inst.Number, inst.Payment, inst.Principal, inst.Interest)
+				}
+				if (inst.Status == models.InstallmentStatusPaid) != (inst.PaidAt != nil) {
+					t.Errorf("installment %d status %s with paid_at %v", inst.Number, inst.Status, inst.PaidAt)
+				}
+				principal += inst.PrincipalPaid
+				interest += inst.InterestPaid
+			}
+			if principal != tt.principal || interest != tt.interest {
+				t.Errorf("carried %d principal and %d interest, want %d and %d", principal, interest, tt.principal, tt.interest)
+			}
+		})
+	}
+}
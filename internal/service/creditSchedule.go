@@ -0,0 +1,170 @@
+package service
+
+import (
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"math"
+	"time"
+)
+
+// Аннуитетный платёж в минимальных единицах валюты
+func annuityPayment(amount models.Money, rateMonthly float64, months int) models.Money {
+	if rateMonthly == 0 {
+		return models.Money(math.Round(float64(amount) / float64(months)))
+	}
+	return amount.MulRound(rateMonthly / (1 - math.Pow(1+rateMonthly, -float64(months))))
+}
+
+// Сколько месяцев нужно, чтобы погасить остаток прежним платежом.
+// Если платёж не покрывает даже проценты, возвращает 0
+func monthsToRepay(balance, payment models.Money, rateMonthly float64) int {
+	if payment <= 0 {
+		return 0
+	}
+	if rateMonthly == 0 {
+		return int((balance + payment - 1) / payment)
+	}
+	interest := float64(balance) * rateMonthly
+	if float64(payment) <= interest {
+		return 0
+	}
+	return int(math.Ceil(math.Log(float64(payment)/(float64(payment)-interest)) / math.Log(1+rateMonthly)))
+}
+
+// Прибавить месяцы к дате; если в целевом месяце нет такого числа, берётся последний день месяца
+func addMonths(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, t.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(t.Day(), lastDay)-1)
+}
+
+// Число календарных месяцев между датами (без учёта дней)
+func monthsBetween(from, to time.Time) int {
+	return (to.Year()-from.Year())*12 + int(to.Month()-from.Month())
+}
+
+// Построить аннуитетный график в минимальных единицах валюты.
+// Проценты каждого месяца начисляются на остаток долга, последний платёж закрывает остаток целиком,
+// поэтому сумма тела по графику всегда равна сумме кредита
+func buildCreditSchedule(creditID int, amount models.Money, months int, annualRate float64, start time.Time) []models.CreditInstallment {
+	rateMonthly := annualRate / 100 / 12
+	start = truncateToDay(start)
+	return amortize(creditID, amount, annuityPayment(amount, rateMonthly, months), rateMonthly, 1, start, 1, 1, months)
+}
+
+// Разложить остаток долга на months платежей по payment. Даты платежей отсчитываются в месяцах от даты выдачи
+// (anchor) начиная с firstMonth, чтобы платежи не съезжали на конец короткого месяца.
+// firstFraction - доля месяца в первом периоде (меньше 1, если период начался не с прошлой даты платежа)
+func amortize(creditID int, balance, payment models.Money, rateMonthly float64, firstNumber int, anchor time.Time, firstMonth int, firstFraction float64, months int) []models.CreditInstallment {
+	schedule := make([]models.CreditInstallment, 0, months)
+	for i := 0; i < months; i++ {
+		dueDate := addMonths(anchor, firstMonth+i)
+
+		interest := balance.MulRound(rateMonthly)
+		if i == 0 {
+			interest = balance.MulRound(rateMonthly * firstFraction)
+		}
+
+		principal := payment - interest
+		if principal < 0 {
+			principal = 0
+		}
+		if i == months-1 || principal > balance {
+			principal = balance
+		}
+		balance -= principal
+
+		schedule = append(schedule, models.CreditInstallment{
+			CreditID:  creditID,
+			Number:    firstNumber + i,
+			DueDate:   dueDate,
+			Payment:   principal + interest,
+			Principal: principal,
+			Interest:  interest,
+			Balance:   balance,
+			Status:    models.InstallmentStatusPending,
+		})
+	}
+
+	return schedule
+}
+
+// Распределить платёж по неоплаченным платежам графика в порядке очереди:
+// в каждом платеже сперва гасится неустойка, затем проценты, затем тело.
+// Возвращает погашенные тело, проценты и неустойку
+func allocateRepayment(installments []models.CreditInstallment, amount models.Money, paidAt time.Time) (models.Money, models.Money, models.Money, error) {
+	var totalDue models.Money
+	for _, inst := range installments {
+		totalDue += inst.Due()
+	}
+	if amount > totalDue {
+		return 0, 0, 0, errs.ErrOverpayment
+	}
+
+	today := truncateToDay(paidAt)
+	var principal, interest, penalty models.Money
+	for i := range installments {
+		if amount == 0 {
+			break
+		}
+		inst := &installments[i]
+		if inst.Status == models.InstallmentStatusPaid {
+			continue
+		}
+
+		part := min(amount, inst.Penalty-inst.PenaltyPaid)
+		inst.PenaltyPaid += part
+		penalty += part
+		amount -= part
+
+		part = min(amount, inst.Interest-inst.InterestPaid)
+		inst.InterestPaid += part
+		interest += part
+		amount -= part
+
+		part = min(amount, inst.Principal-inst.PrincipalPaid)
+		inst.PrincipalPaid += part
+		principal += part
+		amount -= part
+
+		switch {
+		case inst.Due() == 0:
+			inst.Status = models.InstallmentStatusPaid
+			inst.PaidAt = &paidAt
+		case inst.DueDate.Before(today):
+			inst.Status = models.InstallmentStatusOverdue
+		default:
+			inst.Status = models.InstallmentStatusPartial
+		}
+	}
+
+	return principal, interest, penalty, nil
+}
+
+func truncateToDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// Число календарных дней между датами
+func daysBetween(from, to time.Time) int {
+	return int(math.Round(truncateToDay(to).Sub(truncateToDay(from)).Hours() / 24))
+}
+
+// График платежей кредита с проверкой владельца.
+// До выдачи показывается предварительный график от текущей даты, он не сохраняется
+func GetCreditSchedule(creditID int, userID int, isAdmin bool) ([]models.CreditInstallment, error) {
+	credit, err := GetUserCredit(creditID, userID, isAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	switch credit.Status {
+	case models.CreditStatusPending, models.CreditStatusApproved:
+		return buildCreditSchedule(credit.ID, credit.Amount, credit.DurationMonths, credit.InterestRate, time.Now().UTC()), nil
+	case models.CreditStatusRejected:
+		return nil, errs.ErrCreditNotActive
+	}
+
+	return repository.GetCreditInstallments(credit.ID)
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"SB/internal/models"
+	"testing"
+	"time"
+)
+
+func TestBuildCreditSchedule(t *testing.T) {
+	start := time.Date(2024, time.March, 15, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		amount        models.Money
+		months        int
+		annualRate    float64
+		firstPayment  models.Money
+		firstInterest models.Money
+	}{
+		{name: "12 months at 12%", amount: 1000000, months: 12, annualRate: 12, firstPayment: 88849, firstInterest: 10000},
+		{name: "24 months at 18%", amount: 5000000, months: 24, annualRate: 18, firstPayment: 249621, firstInterest: 75000},
+		{name: "zero rate", amount: 100000, months: 3, annualRate: 0, firstPayment: 33333, firstInterest: 0},
+		{name: "single month", amount: 100000, months: 1, annualRate: 12, firstPayment: 101000, firstInterest: 1000},
+		{name: "small amount", amount: 100, months: 12, annualRate: 24, firstPayment: 9, firstInterest: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule := buildCreditSchedule(7, tt.amount, tt.months, tt.annualRate, start)
+			if len(schedule) != tt.months {
+				t.Fatalf("len(schedule) = %d, want %d", len(schedule), tt.months)
+			}
+			if schedule[0].Payment != tt.firstPayment || schedule[0].Interest != tt.firstInterest {
+				t.Errorf("first installment payment = %d, interest = %d, want %d, %d",
+					schedule[0].Payment, schedule[0].Interest, tt.firstPayment, tt.firstInterest)
+			}
+
+			balance := tt.amount
+			var principal models.Money
+			for i, inst := range schedule {
+				if inst.CreditID != 7 || inst.Number != i+1 || inst.Status != models.InstallmentStatusPending {
+					t.Errorf("installment %d: credit %d, number %d, status %s", i, inst.CreditID, inst.Number, inst.Status)
+				}
+				if want := time.Date(2024, time.March+time.Month(i+1), 15, 0, 0, 0, 0, time.UTC); !inst.DueDate.Equal(want) {
+					t.Errorf("installment %d due %s, want %s", inst.Number, inst.DueDate, want)
+				}
+				if inst.Payment != inst.Principal+inst.Interest {
+					t.Errorf("installment %d payment %d != principal %d + interest %d",
+						inst.Number, inst.Payment, inst.Principal, inst.Interest)
+				}
+				if inst.Principal < 0 || inst.Interest < 0 {
+					t.Errorf("installment %d has negative parts: %+v", inst.Number, inst)
+				}
+				if i < len(schedule)-1 && inst.Payment != tt.firstPayment {
+					t.Errorf("installment %d payment %d, want the annuity payment %d", inst.Number, inst.Payment, tt.firstPayment)
+				}
+				balance -= inst.Principal
+				principal += inst.Principal
+				if inst.Balance != balance {
+					t.Errorf("installment %d balance %d, want %d", inst.Number, inst.Balance, balance)
+				}
+			}
+			if principal != tt.amount {
+				t.Errorf("principal over the schedule = %d, want the credit amount %d", principal, tt.amount)
+			}
+		})
+	}
+}
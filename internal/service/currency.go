@@ -0,0 +1,123 @@
+package service
+
+import (
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Справочник валют загружается из таблицы currencies и держится в памяти
+var (
+	currenciesMu sync.RWMutex
+	currencies   map[string]models.Currency
+)
+
+var (
+	currencyCodeRegexp    = regexp.MustCompile(`^[A-Z]{3}$`)
+	currencyNumericRegexp = regexp.MustCompile(`^[0-9]{3}$`)
+)
+
+// Перечитать справочник валют из БД
+func LoadCurrencies() error {
+	list, err := repository.GetCurrencies()
+	if err != nil {
+		return err
+	}
+
+	registry := make(map[string]models.Currency, len(list))
+	for _, currency := range list {
+		registry[currency.Code] = currency
+	}
+
+	currenciesMu.Lock()
+	currencies = registry
+	currenciesMu.Unlock()
+	return nil
+}
+
+// Взять валюту из справочника (только включённые)
+func GetCurrency(code string) (models.Currency, error) {
+	currenciesMu.RLock()
+	loaded := currencies != nil
+	currency, ok := currencies[code]
+	currenciesMu.RUnlock()
+
+	if !loaded {
+		if err := LoadCurrencies(); err != nil {
+			return models.Currency{}, err
+		}
+		return GetCurrency(code)
+	}
+
+	if !ok || !currency.Enabled {
+		return models.Currency{}, errs.ErrInvalidCurrency
+	}
+	return currency, nil
+}
+
+// Проверка валидности валюты по справочнику
+func IsValidCurrency(code string) bool {
+	_, err := GetCurrency(code)
+	return err == nil
+}
+
+// Весь справочник, включая отключённые валюты
+func GetCurrencies() ([]models.Currency, error) {
+	return repository.GetCurrencies()
+}
+
+// Добавить или изменить валюту (право currencies.manage)
+func SaveCurrency(currency *models.Currency) error {
+	currency.Code = strings.ToUpper(strings.TrimSpace(currency.Code))
+	if !currencyCodeRegexp.MatchString(currency.Code) || !currencyNumericRegexp.MatchString(currency.NumericCode) {
+		return errs.ErrInvalidCurrency
+	}
+	if currency.MinorUnits < 0 || currency.MinorUnits > 4 {
+		return errs.ErrInvalidCurrency
+	}
+
+	// Суммы хранятся в минимальных единицах: смена точности у используемой валюты пересчитала бы их все в 10^n раз
+	minorUnits, found, err := repository.GetCurrencyMinorUnits(currency.Code)
+	if err != nil {
+		return err
+	}
+	if found && minorUnits != currency.MinorUnits {
+		inUse, err := repository.IsCurrencyInUse(currency.Code)
+		if err != nil {
+			return err
+		}
+		if inUse {
+			return errs.ErrCurrencyInUse
+		}
+	}
+
+	if err = repository.UpsertCurrency(currency); err != nil {
+		return err
+	}
+	return LoadCurrencies()
+}
+
+// Пересчитать сумму из одной валюты в другую с учётом точности каждой из них
+func ConvertMoney(amount models.Money, from, to string, rate float64) (models.Money, error) {
+	fromCurrency, err := GetCurrency(from)
+	if err != nil {
+		return 0, err
+	}
+	toCurrency, err := GetCurrency(to)
+	if err != nil {
+		return 0, err
+	}
+	return amount.Convert(rate, fromCurrency.MinorUnits, toCurrency.MinorUnits), nil
+}
+
+// Отформатировать сумму для показа клиенту, например "12.50 USD"
+func FormatMoney(amount models.Money, code string) string {
+	currency, err := GetCurrency(code)
+	if err != nil {
+		return amount.Format(0) + " " + code
+	}
+	return amount.Format(currency.MinorUnits) + " " + currency.Code
+}
@@ -5,6 +5,7 @@ import (
 	"SB/internal/errs"
 	"SB/internal/models"
 	"SB/internal/repository"
+	"github.com/jmoiron/sqlx"
 	"time"
 )
 
@@ -19,15 +20,46 @@ func CreateDeposit(deposit *models.Deposit, fromAccountID int) (int, error) {
 	if deposit.Amount <= 0 {
 		return 0, errs.ErrInvalidAmount
 	}
-	if deposit.InterestRate < 0 {
-		return 0, errs.ErrInvalidInterestRate
-	}
 	if deposit.DurationMonths <= 0 {
 		return 0, errs.ErrInvalidDuration
 	}
-	if !IsValidCurrency(deposit.Currency) {
+	if deposit.MaturityInstruction == "" {
+		deposit.MaturityInstruction = models.MaturityPayout
+	}
+	if !isValidMaturityInstruction(deposit.MaturityInstruction) {
+		return 0, errs.ErrInvalidMaturityAction
+	}
+
+	// Валюта и ставка берутся из продукта, клиент выбирает только сумму и срок
+	if deposit.ProductID == nil {
+		return 0, errs.ErrNotFound
+	}
+	product, err := GetDepositProductByID(*deposit.ProductID)
+	if err != nil {
+		return 0, err
+	}
+	if deposit.Currency != "" && deposit.Currency != product.Currency {
 		return 0, errs.ErrInvalidCurrency
 	}
+	deposit.Currency = product.Currency
+	deposit.Compounding = product.Compounding
+	deposit.DayCount = product.DayCount
+	deposit.EarlyWithdrawal = product.EarlyWithdrawal
+	deposit.EarlyWithdrawalRate = product.EarlyWithdrawalRate
+
+	deposit.InterestRate, err = depositProductRate(product, deposit.DurationMonths, deposit.Amount)
+	if err != nil {
+		return 0, err
+	}
+
+	// Если счёт не указан - списываем с текущего счёта в валюте депозита
+	if fromAccountID == 0 {
+		found, err := FindUserAccount(deposit.UserID, deposit.Currency)
+		if err != nil {
+			return 0, err
+		}
+		fromAccountID = found.ID
+	}
 
 	acc, err := repository.GetAccountByID(fromAccountID)
 	if err != nil {
@@ -43,6 +75,20 @@ func CreateDeposit(deposit *models.Deposit, fromAccountID int) (int, error) {
 		return 0, errs.ErrInsufficientFunds
 	}
 
+	// Проценты по окончании периодов можно получать на свой счёт в той же валюте вместо капитализации
+	if deposit.PayoutAccountID != nil {
+		payoutAcc, err := repository.GetAccountByID(*deposit.PayoutAccountID)
+		if err != nil {
+			return 0, errs.ErrNotFound
+		}
+		if payoutAcc.UserID != deposit.UserID || !payoutAcc.Active {
+			return 0, errs.ErrAccountNotActive
+		}
+		if payoutAcc.Currency != deposit.Currency {
+			return 0, errs.ErrInvalidCurrency
+		}
+	}
+
 	tx, err := db.GetDBConn().Beginx()
 	if err != nil {
 		return 0, err
@@ -54,27 +100,25 @@ func CreateDeposit(deposit *models.Deposit, fromAccountID int) (int, error) {
 	}()
 
 	deposit.Active = true
-	deposit.CreatedAt = time.Now()
+	deposit.CreatedAt = time.Now().UTC()
 	deposit.ExpiresAt = deposit.CreatedAt.AddDate(0, deposit.DurationMonths, 0)
+	opened := calendarDay(deposit.CreatedAt)
+	deposit.InterestPeriodStart, deposit.AccruedUntil = &opened, &opened
 
-	newBalance := acc.Balance - deposit.Amount
-	_, err = tx.Exec(`UPDATE accounts SET balance = $1, updated_at = now() WHERE id = $2`, newBalance, acc.ID)
+	depositID, err := repository.CreateDepositTx(tx, deposit)
 	if err != nil {
 		return 0, err
 	}
+	deposit.ID = depositID
 
-	var depositID int
-	err = tx.QueryRow(`
-		INSERT INTO deposits (user_id, amount, currency, interest_rate, duration_months, expires_at, active, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, true, now())
-		RETURNING id`,
-		deposit.UserID, deposit.Amount, deposit.Currency, deposit.InterestRate, deposit.DurationMonths, deposit.ExpiresAt,
-	).Scan(&depositID)
+	_, _, err = repository.PostJournal(tx, models.OperationDepositOpen, &depositID,
+		depositOpenPostings(acc.ID, deposit.Currency, deposit.Amount))
 	if err != nil {
 		return 0, err
 	}
 
-	return depositID, tx.Commit()
+	err = tx.Commit()
+	return depositID, err
 }
 
 func UpdateDepositStatus(depositID int, active bool) error {
@@ -99,30 +143,42 @@ func GetDepositByID(id int) (*models.Deposit, error) {
 	return &dep, nil
 }
 
-func GetDepositsByUserID(userID int) ([]models.Deposit, error) {
+// Депозит с проверкой владельца, как у счетов: чужой депозит доступен только с правом canAccessAny
+func GetUserDeposit(depositID int, userID int, canAccessAny bool) (*models.Deposit, error) {
+	dep, err := GetDepositByID(depositID)
+	if err != nil {
+		return nil, err
+	}
+	if dep.UserID != userID && !canAccessAny {
+		return nil, errs.ErrFraud
+	}
+	return dep, nil
+}
+
+func GetDepositsByUserID(userID int, page models.PageParams) (models.Page[models.Deposit], error) {
 	user, err := repository.GetUserByID(userID)
 	if err != nil || !user.Active {
-		return nil, errs.ErrUserNotActive
+		return models.Page[models.Deposit]{}, errs.ErrUserNotActive
 	}
-	return repository.GetDepositsByUserID(userID)
+	return repository.GetDepositsPageByUserID(userID, pageParams(page))
 }
 
-func GetActiveDeposits() ([]models.Deposit, error) {
-	return repository.GetActiveDeposits()
+func GetActiveDeposits(page models.PageParams) (models.Page[models.Deposit], error) {
+	return repository.GetActiveDeposits(pageParams(page))
 }
 
-func GetInactiveDeposits() ([]models.Deposit, error) {
-	return repository.GetInactiveDeposits()
+func GetInactiveDeposits(page models.PageParams) (models.Page[models.Deposit], error) {
+	return repository.GetInactiveDeposits(pageParams(page))
 }
 
-func GetDepositsByCurrency(currency string) ([]models.Deposit, error) {
+func GetDepositsByCurrency(currency string, page models.PageParams) (models.Page[models.Deposit], error) {
 	if !IsValidCurrency(currency) {
-		return nil, errs.ErrInvalidCurrency
+		return models.Page[models.Deposit]{}, errs.ErrInvalidCurrency
 	}
-	return repository.GetDepositsByCurrency(currency)
+	return repository.GetDepositsByCurrency(currency, pageParams(page))
 }
 
-func CloseDeposit(depositID int, toAccountID int) error {
+func CloseDeposit(depositID int, toAccountID int, userID int, canManage bool) error {
 	deposit, err := repository.GetDepositByID(depositID)
 	if err != nil {
 		return errs.ErrNotFound
@@ -130,20 +186,17 @@ func CloseDeposit(depositID int, toAccountID int) error {
 	if !deposit.Active {
 		return errs.ErrDepositNotActive
 	}
-	if time.Now().Before(deposit.ExpiresAt) {
-		return errs.ErrEarlyCloseNotAllowed
+	if deposit.UserID != userID && !canManage {
+		return errs.ErrFraud
 	}
-
-	acc, err := repository.GetAccountByID(toAccountID)
-	if err != nil || !acc.Active {
-		return errs.ErrAccountNotActive
-	}
-	if acc.Currency != deposit.Currency {
-		return errs.ErrInvalidCurrency
+	if time.Now().UTC().Before(deposit.ExpiresAt) {
+		return errs.ErrDepositNotMatured
 	}
 
-	interest := CalculateDepositInterest(deposit.Amount, deposit.InterestRate, deposit.DurationMonths)
-	total := deposit.Amount + interest
+	acc, err := depositPayoutAccount(&deposit, toAccountID)
+	if err != nil {
+		return err
+	}
 
 	tx, err := db.GetDBConn().Beginx()
 	if err != nil {
@@ -155,20 +208,99 @@ func CloseDeposit(depositID int, toAccountID int) error {
 		}
 	}()
 
-	_, err = tx.Exec(`UPDATE accounts SET balance = balance + $1, updated_at = now() WHERE id = $2`, total, acc.ID)
+	// Проценты доначисляются по дату окончания срока, к выплате - тело с капитализацией и начисленные проценты
+	deposit, err = repository.GetDepositByIDForUpdate(tx, depositID)
+	if err != nil {
+		return err
+	}
+	if err = accrueDeposit(tx, &deposit, deposit.ExpiresAt); err != nil {
+		return err
+	}
+
+	if err = payOutDeposit(tx, &deposit, acc); err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+// Выплатить тело с капитализацией и начисленные проценты на счёт и закрыть депозит.
+// Проценты должны быть уже доначислены по дату окончания срока
+func payOutDeposit(tx *sqlx.Tx, deposit *models.Deposit, acc *models.Account) error {
+	// Депозит закрывается до выплаты, чтобы параллельный запрос не выплатил его второй раз
+	closed, err := repository.DeactivateDeposit(tx, deposit.ID)
 	if err != nil {
 		return err
 	}
+	if !closed {
+		return errs.ErrDepositNotActive
+	}
 
-	err = repository.UpdateDepositActiveStatus(depositID, false)
+	_, _, err = repository.PostJournal(tx, models.OperationDepositPayout, &deposit.ID,
+		depositPayoutPostings(acc.ID, deposit.Currency, deposit.Principal(), deposit.AccruedInterest))
 	if err != nil {
 		return err
 	}
 
-	return tx.Commit()
+	deposit.PaidInterest += deposit.AccruedInterest
+	deposit.AccruedInterest = 0
+	return repository.SaveDepositAccrual(tx, deposit)
+}
+
+// Счёт для выплаты депозита: указанный или текущий счёт владельца в валюте депозита.
+// Выплата возможна только на активный счёт владельца депозита
+func depositPayoutAccount(deposit *models.Deposit, toAccountID int) (*models.Account, error) {
+	if toAccountID == 0 {
+		found, err := FindUserAccount(deposit.UserID, deposit.Currency)
+		if err != nil {
+			return nil, err
+		}
+		toAccountID = found.ID
+	}
+
+	acc, err := repository.GetAccountByID(toAccountID)
+	if err != nil || !acc.Active {
+		return nil, errs.ErrAccountNotActive
+	}
+	if acc.UserID != deposit.UserID {
+		return nil, errs.ErrFraud
+	}
+	if acc.Currency != deposit.Currency {
+		return nil, errs.ErrInvalidCurrency
+	}
+	return &acc, nil
 }
 
-func CalculateDepositInterest(amount int64, rate float64, months int) int64 {
-	simpleInterest := float64(amount) * (rate / 100) * float64(months) / 12
-	return int64(simpleInterest)
+// Предварительный расчёт процентов по депозиту продукта без его открытия, с капитализацией по условиям продукта.
+// Возвращает проценты и применённую ставку
+func PreviewDepositInterest(productID int, amount models.Money, months int) (models.Money, float64, *models.DepositProduct, error) {
+	if amount <= 0 {
+		return 0, 0, nil, errs.ErrInvalidAmount
+	}
+	if months <= 0 {
+		return 0, 0, nil, errs.ErrInvalidDuration
+	}
+
+	product, err := GetDepositProductByID(productID)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	rate, err := depositProductRate(product, months, amount)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	now := time.Now().UTC()
+	interest := CalculateDepositInterest(models.Deposit{
+		Amount:         amount,
+		InterestRate:   rate,
+		DurationMonths: months,
+		CreatedAt:      now,
+		ExpiresAt:      now.AddDate(0, months, 0),
+		Compounding:    product.Compounding,
+		DayCount:       product.DayCount,
+	})
+	return interest, rate, product, nil
 }
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"SB/internal/db"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"SB/logger"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// Календарная дата без времени. Даты депозита хранятся без часового пояса, поэтому сравниваются в UTC
+func calendarDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Доля года между датами по правилу подсчёта дней: ACT/365 - фактические дни, 30/360 - месяц по 30 дней
+func yearFraction(dayCount string, from, to time.Time) float64 {
+	if dayCount == models.DayCount30360 {
+		d1, d2 := min(from.Day(), 30), to.Day()
+		if d1 == 30 && d2 == 31 {
+			d2 = 30
+		}
+		days := 360*(to.Year()-from.Year()) + 30*int(to.Month()-from.Month()) + d2 - d1
+		return float64(days) / 360
+	}
+	return float64(daysBetween(from, to)) / 365
+}
+
+// Длина периода капитализации в месяцах, 0 - проценты выплачиваются в конце срока
+func compoundingMonths(compounding string) int {
+	switch compounding {
+	case models.CompoundingMonthly:
+		return 1
+	case models.CompoundingQuarterly:
+		return 3
+	}
+	return 0
+}
+
+// Ближайшая дата капитализации после from. Периоды отсчитываются от даты открытия,
+// в дату окончания срока капитализации нет - проценты выплачиваются вместе с телом
+func nextCapitalizationDate(deposit *models.Deposit, from time.Time) (time.Time, bool) {
+	step := compoundingMonths(deposit.Compounding)
+	if step == 0 {
+		return time.Time{}, false
+	}
+
+	opened := calendarDay(deposit.CreatedAt)
+	maturity := calendarDay(deposit.ExpiresAt)
+	for k := step; ; k += step {
+		date := addMonths(opened, k)
+		if !date.Before(maturity) {
+			return time.Time{}, false
+		}
+		if date.After(from) {
+			return date, true
+		}
+	}
+}
+
+// Один шаг начисления: до ближайшей даты капитализации или до target.
+// Проценты периода считаются целиком от его начала и округляются один раз, поэтому ежедневное начисление
+// не накапливает ошибку округления. Возвращает доначисленную сумму и признак окончания периода
+func accrualStep(deposit *models.Deposit, target time.Time) (models.Money, bool) {
+	if deposit.InterestPeriodStart == nil || deposit.AccruedUntil == nil {
+		opened := calendarDay(deposit.CreatedAt)
+		deposit.InterestPeriodStart, deposit.AccruedUntil = &opened, &opened
+	}
+
+	periodStart := calendarDay(*deposit.InterestPeriodStart)
+	step := target
+	capitalization, ok := nextCapitalizationDate(deposit, periodStart)
+	periodEnd := ok && !capitalization.After(target)
+	if periodEnd {
+		step = capitalization
+	}
+
+	total := deposit.Principal().MulRound(deposit.InterestRate / 100 * yearFraction(deposit.DayCount, periodStart, step))
+	delta := max(total-deposit.AccruedInterest, 0)
+	deposit.AccruedInterest += delta
+	deposit.AccruedUntil = &step
+	return delta, periodEnd
+}
+
+// Начислить проценты по депозиту по дату through (не дальше окончания срока),
+// капитализировать или выплатить на привязанный счёт проценты закончившихся периодов
+func accrueDeposit(tx *sqlx.Tx, deposit *models.Deposit, through time.Time) error {
+	target := calendarDay(through)
+	if maturity := calendarDay(deposit.ExpiresAt); target.After(maturity) {
+		target = maturity
+	}
+
+	for deposit.AccruedUntil == nil || calendarDay(*deposit.AccruedUntil).Before(target) {
+		delta, periodEnd := accrualStep(deposit, target)
+		if delta > 0 {
+			_, _, err := repository.PostJournal(tx, models.OperationDepositAccrual, &deposit.ID,
+				depositAccrualPostings(deposit.Currency, delta))
+			if err != nil {
+				return err
+			}
+		}
+		if periodEnd {
+			if err := settleDepositInterest(tx, deposit); err != nil {
+				return err
+			}
+		}
+	}
+
+	return repository.SaveDepositAccrual(tx, deposit)
+}
+
+// Закрыть период: выплатить проценты на привязанный счёт или присоединить их к телу депозита.
+// Если привязанный счёт закрыт, проценты капитализируются
+func settleDepositInterest(tx *sqlx.Tx, deposit *models.Deposit) error {
+	interest := deposit.AccruedInterest
+	periodEnd := *deposit.AccruedUntil
+	deposit.InterestPeriodStart = &periodEnd
+	deposit.AccruedInterest = 0
+	if interest == 0 {
+		return nil
+	}
+
+	if deposit.PayoutAccountID != nil {
+		acc, err := repository.GetAccountByID(*deposit.PayoutAccountID)
+		if err == nil && acc.Active && acc.Currency == deposit.Currency {
+			_, _, err = repository.PostJournal(tx, models.OperationDepositInterest, &deposit.ID,
+				depositInterestPayoutPostings(acc.ID, deposit.Currency, interest))
+			if err != nil {
+				return err
+			}
+			deposit.PaidInterest += interest
+			return nil
+		}
+		logger.Error.Printf("[service] settleDepositInterest(): deposit %d: payout account %d is not available, interest is capitalized",
+			deposit.ID, *deposit.PayoutAccountID)
+	}
+
+	_, _, err := repository.PostJournal(tx, models.OperationDepositCapitalize, &deposit.ID,
+		depositCapitalizationPostings(deposit.Currency, interest))
+	if err != nil {
+		return err
+	}
+	deposit.CapitalizedInterest += interest
+	return nil
+}
+
+// Начислить проценты по одному депозиту в отдельной транзакции
+func processDepositAccrual(depositID int, now time.Time) (err error) {
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	deposit, err := repository.GetDepositByIDForUpdate(tx, depositID)
+	if err != nil {
+		return err
+	}
+	if !deposit.Active {
+		return tx.Commit()
+	}
+
+	if err = accrueDeposit(tx, &deposit, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Фоновая задача: ежедневное начисление процентов по активным депозитам с капитализацией
+// или выплатой по окончании периодов. Ошибка по одному депозиту не останавливает остальные
+func RunDepositAccrualJob(now time.Time) error {
+	ids, err := repository.GetDepositIDsForAccrual(calendarDay(now))
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, id := range ids {
+		err = processDepositAccrual(id, now)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			logger.Error.Printf("[service] RunDepositAccrualJob(): deposit %d: %v", id, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("interest accrual failed for %d of %d deposits", failed, len(ids))
+	}
+	return nil
+}
+
+// Начислить проценты по дату through только в памяти, без проводок: для расчётов и предпросмотра
+func simulateAccrual(deposit *models.Deposit, through time.Time) {
+	target := calendarDay(through)
+	if maturity := calendarDay(deposit.ExpiresAt); target.After(maturity) {
+		target = maturity
+	}
+
+	for deposit.AccruedUntil == nil || calendarDay(*deposit.AccruedUntil).Before(target) {
+		_, periodEnd := accrualStep(deposit, target)
+		if !periodEnd {
+			continue
+		}
+		if deposit.PayoutAccountID != nil {
+			deposit.PaidInterest += deposit.AccruedInterest
+		} else {
+			deposit.CapitalizedInterest += deposit.AccruedInterest
+		}
+		periodStart := *deposit.AccruedUntil
+		deposit.InterestPeriodStart = &periodStart
+		deposit.AccruedInterest = 0
+	}
+}
+
+// Проценты по депозиту за весь срок с учётом капитализации и правила подсчёта дней, без проводок
+func CalculateDepositInterest(deposit models.Deposit) models.Money {
+	simulateAccrual(&deposit, deposit.ExpiresAt)
+	return deposit.CapitalizedInterest + deposit.PaidInterest + deposit.AccruedInterest
+}
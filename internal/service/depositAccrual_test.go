@@ -0,0 +1,153 @@
+package service
+
+import (
+	"SB/internal/models"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestYearFraction(t *testing.T) {
+	tests := []struct {
+		dayCount string
+		from, to time.Time
+		want     float64
+	}{
+		{dayCount: models.DayCountAct365, from: day(2023, time.January, 1), to: day(2024, time.January, 1), want: 1},
+		{dayCount: models.DayCountAct365, from: day(2024, time.January, 1), to: day(2025, time.January, 1), want: 366.0 / 365},
+		{dayCount: models.DayCountAct365, from: day(2024, time.February, 1), to: day(2024, time.March, 1), want: 29.0 / 365},
+		{dayCount: models.DayCount30360, from: day(2024, time.February, 1), to: day(2024, time.March, 1), want: 30.0 / 360},
+		{dayCount: models.DayCount30360, from: day(2024, time.January, 15), to: day(2025, time.January, 15), want: 1},
+		{dayCount: models.DayCount30360, from: day(2024, time.January, 31), to: day(2024, time.March, 31), want: 60.0 / 360},
+		{dayCount: models.DayCount30360, from: day(2024, time.January, 30), to: day(2024, time.January, 31), want: 0},
+	}
+
+	for _, tt := range tests {
+		got := yearFraction(tt.dayCount, tt.from, tt.to)
+		if math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("yearFraction(%s, %s, %s) = %v, want %v", tt.dayCount,
+				tt.from.Format(time.DateOnly), tt.to.Format(time.DateOnly), got, tt.want)
+		}
+	}
+}
+
+func TestNextCapitalizationDate(t *testing.T) {
+	deposit := &models.Deposit{
+		CreatedAt:   day(2024, time.January, 31).Add(14 * time.Hour),
+		ExpiresAt:   day(2024, time.July, 31),
+		Compounding: models.CompoundingMonthly,
+	}
+
+	tests := []struct {
+		compounding string
+		from        time.Time
+		want        time.Time
+		wantOK      bool
+	}{
+		{compounding: models.CompoundingMonthly, from: day(2024, time.January, 31), want: day(2024, time.February, 29), wantOK: true},
+		{compounding: models.CompoundingMonthly, from: day(2024, time.February, 29), want: day(2024, time.March, 31), wantOK: true},
+		{compounding: models.CompoundingMonthly, from: day(2024, time.April, 10), want: day(2024, time.April, 30), wantOK: true},
+		{compounding: models.CompoundingMonthly, from: day(2024, time.June, 30), wantOK: false},
+		{compounding: models.CompoundingQuarterly, from: day(2024, time.January, 31), want: day(2024, time.April, 30), wantOK: true},
+		{compounding: models.CompoundingQuarterly, from: day(2024, time.April, 30), wantOK: false},
+		{compounding: models.CompoundingNone, from: day(2024, time.January, 31), wantOK: false},
+	}
+
+	for _, tt := range tests {
+		deposit.Compounding = tt.compounding
+		got, ok := nextCapitalizationDate(deposit, tt.from)
+		if ok != tt.wantOK || !got.Equal(tt.want) {
+			t.Errorf("nextCapitalizationDate(%s, %s) = %s, %v, want %s, %v", tt.compounding, tt.from.Format(time.DateOnly),
+				got.Format(time.DateOnly), ok, tt.want.Format(time.DateOnly), tt.wantOK)
+		}
+	}
+}
+
+func TestAccrualStepDailyMatchesOneStep(t *testing.T) {
+	newDeposit := func() *models.Deposit {
+		return &models.Deposit{
+			Amount:       1234567,
+			InterestRate: 7.3,
+			CreatedAt:    day(2024, time.January, 10),
+			ExpiresAt:    day(2025, time.January, 10),
+			Compounding:  models.CompoundingMonthly,
+			DayCount:     models.DayCountAct365,
+		}
+	}
+
+	daily := newDeposit()
+	var accrued models.Money
+	for d := day(2024, time.January, 11); !d.After(day(2024, time.February, 5)); d = d.AddDate(0, 0, 1) {
+		delta, periodEnd := accrualStep(daily, d)
+		if periodEnd {
+			t.Fatalf("accrualStep() ended the period on %s", d.Format(time.DateOnly))
+		}
+		accrued += delta
+	}
+
+	once := newDeposit()
+	delta, _ := accrualStep(once, day(2024, time.February, 5))
+	if accrued != delta || daily.AccruedInterest != once.AccruedInterest {
+		t.Errorf("daily accrual = %d, one step = %d", accrued, delta)
+	}
+
+	// Шаг не заходит за дату капитализации
+	delta, periodEnd := accrualStep(daily, day(2024, time.February, 20))
+	if !periodEnd || !daily.AccruedUntil.Equal(day(2024, time.February, 10)) {
+		t.Errorf("accrualStep() across the capitalization date stopped at %s, period end %v",
+			daily.AccruedUntil.Format(time.DateOnly), periodEnd)
+	}
+	if want := models.Money(1234567).MulRound(0.073 * 31 / 365); daily.AccruedInterest != want || accrued+delta != want {
+		t.Errorf("interest for the first period = %d, want %d", daily.AccruedInterest, want)
+	}
+}
+
+func TestCalculateDepositInterest(t *testing.T) {
+	payoutAccountID := 5
+
+	tests := []struct {
+		name    string
+		deposit models.Deposit
+		want    models.Money
+	}{
+		{
+			name: "no compounding, leap year ACT/365",
+			deposit: models.Deposit{Amount: 1000000, InterestRate: 12, CreatedAt: day(2024, time.January, 1),
+				ExpiresAt: day(2025, time.January, 1), Compounding: models.CompoundingNone, DayCount: models.DayCountAct365},
+			want: 120329,
+		},
+		{
+			name: "monthly compounding 30/360",
+			deposit: models.Deposit{Amount: 1000000, InterestRate: 12, CreatedAt: day(2024, time.January, 15),
+				ExpiresAt: day(2025, time.January, 15), Compounding: models.CompoundingMonthly, DayCount: models.DayCount30360},
+			want: 126825,
+		},
+		{
+			name: "quarterly compounding 30/360",
+			deposit: models.Deposit{Amount: 1000000, InterestRate: 12, CreatedAt: day(2024, time.January, 15),
+				ExpiresAt: day(2025, time.January, 15), Compounding: models.CompoundingQuarterly, DayCount: models.DayCount30360},
+			want: 125509,
+		},
+		{
+			name: "monthly payout is not compounded",
+			deposit: models.Deposit{Amount: 1000000, InterestRate: 12, CreatedAt: day(2024, time.January, 15),
+				ExpiresAt: day(2025, time.January, 15), Compounding: models.CompoundingMonthly, DayCount: models.DayCount30360,
+				PayoutAccountID: &payoutAccountID},
+			want: 120000,
+		},
+		{
+			name: "zero rate",
+			deposit: models.Deposit{Amount: 1000000, CreatedAt: day(2024, time.January, 15),
+				ExpiresAt: day(2025, time.January, 15), Compounding: models.CompoundingMonthly, DayCount: models.DayCountAct365},
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CalculateDepositInterest(tt.deposit); got != tt.want {
+				t.Errorf("CalculateDepositInterest() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
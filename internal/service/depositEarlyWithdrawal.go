@@ -0,0 +1,132 @@
+package service
+
+import (
+	"SB/internal/db"
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Расчёт досрочного расторжения по депозиту, проценты которого начислены по дату now.
+// on_demand_rate - проценты пересчитываются на тело по ставке до востребования без капитализации,
+// penalty - из начисленных процентов удерживается early_withdrawal_rate процентов.
+// Уже выплаченные на привязанный счёт проценты засчитываются в пересчитанные
+func earlyWithdrawalQuote(deposit *models.Deposit, now time.Time) (*models.EarlyWithdrawalQuote, error) {
+	today := calendarDay(now)
+	if !today.Before(calendarDay(deposit.ExpiresAt)) {
+		return nil, errs.ErrDepositMatured
+	}
+
+	earned := deposit.CapitalizedInterest + deposit.PaidInterest + deposit.AccruedInterest
+
+	var interest models.Money
+	switch deposit.EarlyWithdrawal {
+	case models.EarlyWithdrawalOnDemandRate:
+		opened := calendarDay(deposit.CreatedAt)
+		interest = deposit.Amount.MulRound(deposit.EarlyWithdrawalRate / 100 * yearFraction(deposit.DayCount, opened, today))
+		interest = min(interest, earned)
+	case models.EarlyWithdrawalPenalty:
+		interest = earned - earned.MulRound(deposit.EarlyWithdrawalRate/100)
+	default:
+		return nil, errs.ErrEarlyCloseNotAllowed
+	}
+
+	return &models.EarlyWithdrawalQuote{
+		DepositID:      deposit.ID,
+		AsOf:           today,
+		Currency:       deposit.Currency,
+		Policy:         deposit.EarlyWithdrawal,
+		PolicyRate:     deposit.EarlyWithdrawalRate,
+		Principal:      deposit.Amount,
+		InterestEarned: earned,
+		InterestPaid:   deposit.PaidInterest,
+		Interest:       interest,
+		Penalty:        earned - interest,
+		Payout:         max(deposit.Amount+interest-deposit.PaidInterest, 0),
+	}, nil
+}
+
+// Расчёт досрочного расторжения на сегодня без закрытия депозита
+func GetEarlyWithdrawalQuote(depositID int, userID int, canReadAny bool) (*models.EarlyWithdrawalQuote, error) {
+	deposit, err := GetUserDeposit(depositID, userID, canReadAny)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	simulateAccrual(deposit, now)
+	return earlyWithdrawalQuote(deposit, now)
+}
+
+// Досрочно расторгнуть депозит: проценты доначисляются по сегодня и пересчитываются по политике продукта,
+// сумма к выплате зачисляется на счёт владельца в одной транзакции с закрытием депозита
+func WithdrawDepositEarly(depositID int, toAccountID int, userID int, canManage bool) (quote *models.EarlyWithdrawalQuote, err error) {
+	deposit, err := GetUserDeposit(depositID, userID, canManage)
+	if err != nil {
+		return nil, err
+	}
+
+	acc, err := depositPayoutAccount(deposit, toAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	locked, err := repository.GetDepositByIDForUpdate(tx, depositID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errs.ErrNotFound
+		}
+		return nil, err
+	}
+	if !locked.Active {
+		return nil, errs.ErrDepositNotActive
+	}
+
+	now := time.Now().UTC()
+	if err = accrueDeposit(tx, &locked, now); err != nil {
+		return nil, err
+	}
+
+	quote, err = earlyWithdrawalQuote(&locked, now)
+	if err != nil {
+		return nil, err
+	}
+
+	closed, err := repository.DeactivateDeposit(tx, depositID)
+	if err != nil {
+		return nil, err
+	}
+	if !closed {
+		err = errs.ErrDepositNotActive
+		return nil, err
+	}
+
+	_, _, err = repository.PostJournal(tx, models.OperationDepositEarlyClose, &locked.ID,
+		depositEarlyWithdrawalPostings(acc.ID, locked.Currency, locked.Principal(), locked.AccruedInterest, quote.Payout))
+	if err != nil {
+		return nil, err
+	}
+
+	locked.AccruedInterest = 0
+	if err = repository.SaveDepositAccrual(tx, &locked); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return quote, nil
+}
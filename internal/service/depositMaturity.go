@@ -0,0 +1,200 @@
+package service
+
+import (
+	"SB/internal/db"
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"SB/logger"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+func isValidMaturityInstruction(instruction string) bool {
+	switch instruction {
+	case models.MaturityPayout, models.MaturityRolloverWithInterest, models.MaturityRolloverPrincipal:
+		return true
+	}
+	return false
+}
+
+// Изменить инструкцию на дату окончания срока. Менять может владелец депозита или пользователь с правом canManage
+func UpdateDepositMaturityInstruction(depositID int, userID int, instruction string, canManage bool) error {
+	if !isValidMaturityInstruction(instruction) {
+		return errs.ErrInvalidMaturityAction
+	}
+
+	if _, err := GetUserDeposit(depositID, userID, canManage); err != nil {
+		return err
+	}
+
+	updated, err := repository.UpdateDepositMaturityInstruction(depositID, instruction)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return errs.ErrDepositNotActive
+	}
+	return nil
+}
+
+// Пролонгировать депозит на тот же срок по текущей ставке продукта. Новый срок начинается в дату окончания старого,
+// тело переходит на новый депозит с процентами (rollover_with_interest) или без них - тогда проценты выплачиваются на счёт.
+// Возвращает ID нового депозита
+func rolloverDeposit(tx *sqlx.Tx, deposit *models.Deposit, acc *models.Account) (int, error) {
+	if deposit.ProductID == nil {
+		return 0, errs.ErrNotFound
+	}
+	product, err := GetDepositProductByID(*deposit.ProductID)
+	if err != nil {
+		return 0, err
+	}
+
+	amount := deposit.Principal()
+	if deposit.MaturityInstruction == models.MaturityRolloverWithInterest {
+		amount += deposit.AccruedInterest
+	}
+	rate, err := depositProductRate(product, deposit.DurationMonths, amount)
+	if err != nil {
+		return 0, err
+	}
+
+	start := deposit.ExpiresAt
+	opened := calendarDay(start)
+	renewed := &models.Deposit{
+		UserID:              deposit.UserID,
+		ProductID:           deposit.ProductID,
+		Amount:              amount,
+		Currency:            deposit.Currency,
+		InterestRate:        rate,
+		DurationMonths:      deposit.DurationMonths,
+		CreatedAt:           start,
+		ExpiresAt:           start.AddDate(0, deposit.DurationMonths, 0),
+		Active:              true,
+		Compounding:         product.Compounding,
+		DayCount:            product.DayCount,
+		PayoutAccountID:     deposit.PayoutAccountID,
+		EarlyWithdrawal:     product.EarlyWithdrawal,
+		EarlyWithdrawalRate: product.EarlyWithdrawalRate,
+		MaturityInstruction: deposit.MaturityInstruction,
+		RolledOverFrom:      &deposit.ID,
+		InterestPeriodStart: &opened,
+		AccruedUntil:        &opened,
+	}
+
+	closed, err := repository.DeactivateDeposit(tx, deposit.ID)
+	if err != nil {
+		return 0, err
+	}
+	if !closed {
+		return 0, errs.ErrDepositNotActive
+	}
+
+	renewed.ID, err = repository.CreateDepositTx(tx, renewed)
+	if err != nil {
+		return 0, err
+	}
+
+	_, _, err = repository.PostJournal(tx, models.OperationDepositRollover, &renewed.ID,
+		depositRolloverPostings(acc.ID, deposit.Currency, deposit.Principal(), deposit.AccruedInterest, amount))
+	if err != nil {
+		return 0, err
+	}
+
+	if deposit.MaturityInstruction != models.MaturityRolloverWithInterest {
+		deposit.PaidInterest += deposit.AccruedInterest
+	}
+	deposit.AccruedInterest = 0
+	if err = repository.SaveDepositAccrual(tx, deposit); err != nil {
+		return 0, err
+	}
+	return renewed.ID, nil
+}
+
+// Обработать один депозит с закончившимся сроком в отдельной транзакции: доначислить проценты
+// и выплатить или пролонгировать по инструкции. Если пролонгация невозможна (продукт закрыт,
+// срок или сумма больше не предлагаются), депозит выплачивается
+func processDepositMaturity(depositID int, now time.Time) (err error) {
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	deposit, err := repository.GetDepositByIDForUpdate(tx, depositID)
+	if err != nil {
+		return err
+	}
+	if !deposit.Active || now.Before(deposit.ExpiresAt) {
+		return tx.Commit()
+	}
+
+	// Проценты и тело по умолчанию уходят на привязанный счёт, иначе на текущий счёт владельца
+	toAccountID := 0
+	if deposit.PayoutAccountID != nil {
+		toAccountID = *deposit.PayoutAccountID
+	}
+	acc, err := depositPayoutAccount(&deposit, toAccountID)
+	if err != nil && toAccountID != 0 {
+		acc, err = depositPayoutAccount(&deposit, 0)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = accrueDeposit(tx, &deposit, deposit.ExpiresAt); err != nil {
+		return err
+	}
+
+	if deposit.MaturityInstruction == models.MaturityRolloverWithInterest ||
+		deposit.MaturityInstruction == models.MaturityRolloverPrincipal {
+		renewedID, rollErr := rolloverDeposit(tx, &deposit, acc)
+		switch {
+		case rollErr == nil:
+			logger.Info.Printf("[service] processDepositMaturity(): deposit %d rolled over into %d", deposit.ID, renewedID)
+			return tx.Commit()
+		case errors.Is(rollErr, errs.ErrNotFound), errors.Is(rollErr, errs.ErrDepositProductNotActive),
+			errors.Is(rollErr, errs.ErrInvalidDepositTerm), errors.Is(rollErr, errs.ErrDepositAmountOutOfRange),
+			errors.Is(rollErr, errs.ErrNoDepositRate):
+			logger.Error.Printf("[service] processDepositMaturity(): deposit %d cannot be rolled over, paying out: %v", deposit.ID, rollErr)
+		default:
+			err = rollErr
+			return err
+		}
+	}
+
+	if err = payOutDeposit(tx, &deposit, acc); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Фоновая задача: выплата или пролонгация депозитов, срок которых закончился.
+// Ошибка по одному депозиту не останавливает остальные
+func RunDepositMaturityJob(now time.Time) error {
+	ids, err := repository.GetMaturedDepositIDs(now)
+	if err != nil {
+		return err
+	}
+
+	var failed int
+	for _, id := range ids {
+		err = processDepositMaturity(id, now)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			logger.Error.Printf("[service] RunDepositMaturityJob(): deposit %d: %v", id, err)
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("maturity processing failed for %d of %d deposits", failed, len(ids))
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+func validateDepositProduct(product *models.DepositProduct) error {
+	product.Name = strings.TrimSpace(product.Name)
+	product.Currency = strings.ToUpper(strings.TrimSpace(product.Currency))
+
+	if product.Name == "" {
+		return fmt.Errorf("%w: name is required", errs.ErrInvalidDepositProduct)
+	}
+	if !IsValidCurrency(product.Currency) {
+		return errs.ErrInvalidCurrency
+	}
+	if product.MinAmount <= 0 || product.MaxAmount < product.MinAmount {
+		return fmt.Errorf("%w: min_amount must be > 0 and <= max_amount", errs.ErrInvalidDepositProduct)
+	}
+	if len(product.AllowedTerms) == 0 {
+		return fmt.Errorf("%w: allowed_terms is required", errs.ErrInvalidDepositProduct)
+	}
+	for _, term := range product.AllowedTerms {
+		if term <= 0 {
+			return fmt.Errorf("%w: terms must be positive", errs.ErrInvalidDepositProduct)
+		}
+	}
+
+	if product.EarlyWithdrawal == "" {
+		product.EarlyWithdrawal = models.EarlyWithdrawalNotAllowed
+	}
+	switch product.EarlyWithdrawal {
+	case models.EarlyWithdrawalNotAllowed, models.EarlyWithdrawalOnDemandRate, models.EarlyWithdrawalPenalty:
+	default:
+		return fmt.Errorf("%w: unknown early_withdrawal policy", errs.ErrInvalidDepositProduct)
+	}
+	if product.EarlyWithdrawalRate < MinInterestRate || product.EarlyWithdrawalRate > MaxInterestRate {
+		return fmt.Errorf("%w: early_withdrawal_rate must be between 0 and 100", errs.ErrInvalidDepositProduct)
+	}
+
+	if product.Compounding == "" {
+		product.Compounding = models.CompoundingNone
+	}
+	switch product.Compounding {
+	case models.CompoundingNone, models.CompoundingMonthly, models.CompoundingQuarterly:
+	default:
+		return fmt.Errorf("%w: unknown compounding frequency", errs.ErrInvalidDepositProduct)
+	}
+
+	if product.DayCount == "" {
+		product.DayCount = models.DayCountAct365
+	}
+	switch product.DayCount {
+	case models.DayCountAct365, models.DayCount30360:
+	default:
+		return fmt.Errorf("%w: unknown day_count convention", errs.ErrInvalidDepositProduct)
+	}
+
+	// Для каждого разрешённого срока должна быть ставка хотя бы от минимальной суммы
+	for _, term := range product.AllowedTerms {
+		covered := false
+		for _, rate := range product.Rates {
+			if int64(rate.TermMonths) == term && rate.MinAmount <= product.MinAmount {
+				covered = true
+			}
+		}
+		if !covered {
+			return fmt.Errorf("%w: no rate for %d months from min_amount", errs.ErrInvalidDepositProduct, term)
+		}
+	}
+	for _, rate := range product.Rates {
+		if !slices.Contains(product.AllowedTerms, int64(rate.TermMonths)) {
+			return fmt.Errorf("%w: rate for %d months is not in allowed_terms", errs.ErrInvalidDepositProduct, rate.TermMonths)
+		}
+		if rate.Rate < MinInterestRate || rate.Rate > MaxInterestRate || rate.MinAmount < 0 {
+			return errs.ErrInvalidInterestRate
+		}
+	}
+
+	return nil
+}
+
+// Создать депозитный продукт (право products.manage)
+func CreateDepositProduct(product *models.DepositProduct) error {
+	if err := validateDepositProduct(product); err != nil {
+		return err
+	}
+	product.Active = true
+	return repository.CreateDepositProduct(product)
+}
+
+// Изменить условия депозитного продукта (право products.manage)
+func UpdateDepositProduct(product *models.DepositProduct) error {
+	if err := validateDepositProduct(product); err != nil {
+		return err
+	}
+
+	err := repository.UpdateDepositProduct(product)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errs.ErrNotFound
+	}
+	return err
+}
+
+// Получить депозитный продукт по ID
+func GetDepositProductByID(id int) (*models.DepositProduct, error) {
+	product, err := repository.GetDepositProductByID(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errs.ErrNotFound
+		}
+		return nil, err
+	}
+	return &product, nil
+}
+
+// Получить каталог депозитных продуктов. Клиенты видят только активные
+func GetDepositProducts(activeOnly bool) ([]models.DepositProduct, error) {
+	return repository.GetDepositProducts(activeOnly)
+}
+
+// Ставка продукта для срока и суммы: берётся ступень с наибольшей минимальной суммой, не превышающей сумму депозита
+func depositProductRate(product *models.DepositProduct, termMonths int, amount models.Money) (float64, error) {
+	if !product.Active {
+		return 0, errs.ErrDepositProductNotActive
+	}
+	if !slices.Contains(product.AllowedTerms, int64(termMonths)) {
+		return 0, errs.ErrInvalidDepositTerm
+	}
+	if amount < product.MinAmount || amount > product.MaxAmount {
+		return 0, errs.ErrDepositAmountOutOfRange
+	}
+
+	var best *models.DepositRateTier
+	for i := range product.Rates {
+		tier := &product.Rates[i]
+		if tier.TermMonths != termMonths || tier.MinAmount > amount {
+			continue
+		}
+		if best == nil || tier.MinAmount > best.MinAmount {
+			best = tier
+		}
+	}
+	if best == nil {
+		return 0, errs.ErrNoDepositRate
+	}
+	return best.Rate, nil
+}
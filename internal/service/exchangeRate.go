@@ -0,0 +1,108 @@
+package service
+
+import (
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func validateExchangeRate(rate *models.ExchangeRate) error {
+	rate.BaseCurrency = strings.ToUpper(strings.TrimSpace(rate.BaseCurrency))
+	rate.QuoteCurrency = strings.ToUpper(strings.TrimSpace(rate.QuoteCurrency))
+
+	if !IsValidCurrency(rate.BaseCurrency) || !IsValidCurrency(rate.QuoteCurrency) {
+		return errs.ErrInvalidCurrency
+	}
+	if rate.BaseCurrency == rate.QuoteCurrency || rate.Rate <= 0 {
+		return errs.ErrInvalidExchangeRate
+	}
+	if rate.EffectiveAt.IsZero() {
+		rate.EffectiveAt = time.Now()
+	}
+	// Колонка без часового пояса: время со смещением хранится в UTC, иначе смещение потеряется
+	rate.EffectiveAt = rate.EffectiveAt.UTC()
+	return nil
+}
+
+// Добавить курс валют (право currencies.manage)
+func CreateExchangeRate(rate *models.ExchangeRate, userID int) error {
+	if err := validateExchangeRate(rate); err != nil {
+		return err
+	}
+
+	rate.CreatedBy = userID
+	return repository.CreateExchangeRate(rate)
+}
+
+// Загрузить курсы из CSV (право currencies.manage).
+// Формат строки: base_currency,quote_currency,rate[,effective_at в RFC3339], строка заголовка допускается.
+// Загружается либо весь файл, либо ничего
+func ImportExchangeRatesCSV(r io.Reader, userID int) (int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rates []models.ExchangeRate
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", errs.ErrInvalidExchangeRate, err)
+		}
+
+		if line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "base_currency") {
+			continue
+		}
+		if len(record) < 3 || len(record) > 4 {
+			return 0, fmt.Errorf("%w: line %d: expected 3 or 4 fields", errs.ErrInvalidExchangeRate, line)
+		}
+
+		rate := models.ExchangeRate{
+			BaseCurrency:  record[0],
+			QuoteCurrency: record[1],
+			CreatedBy:     userID,
+		}
+
+		rate.Rate, err = strconv.ParseFloat(strings.TrimSpace(record[2]), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: line %d: bad rate %q", errs.ErrInvalidExchangeRate, line, record[2])
+		}
+
+		if len(record) == 4 && strings.TrimSpace(record[3]) != "" {
+			rate.EffectiveAt, err = time.Parse(time.RFC3339, strings.TrimSpace(record[3]))
+			if err != nil {
+				return 0, fmt.Errorf("%w: line %d: bad effective_at %q", errs.ErrInvalidExchangeRate, line, record[3])
+			}
+		}
+
+		if err = validateExchangeRate(&rate); err != nil {
+			return 0, fmt.Errorf("%w: line %d", err, line)
+		}
+		rates = append(rates, rate)
+	}
+
+	if len(rates) == 0 {
+		return 0, fmt.Errorf("%w: no rates in file", errs.ErrInvalidExchangeRate)
+	}
+
+	return len(rates), repository.CreateExchangeRates(rates)
+}
+
+// История курсов пары валют
+func GetExchangeRateHistory(base, quote string) ([]models.ExchangeRate, error) {
+	base = strings.ToUpper(base)
+	quote = strings.ToUpper(quote)
+	if !IsValidCurrency(base) || !IsValidCurrency(quote) {
+		return nil, errs.ErrInvalidCurrency
+	}
+	return repository.GetExchangeRateHistory(base, quote)
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"SB/internal/configs"
+	"SB/internal/errs"
+	"SB/internal/repository"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RateProvider отдаёт курс обмена from -> to, действовавший в момент at
+type RateProvider interface {
+	Rate(from, to string, at time.Time) (float64, error)
+}
+
+var rateProvider RateProvider = dbRateProvider{}
+
+// Подменить источник курсов (например, в main или при тестировании)
+func SetRateProvider(provider RateProvider) {
+	rateProvider = provider
+}
+
+// Выбрать источник курсов согласно fx_params из конфига
+func InitRateProvider() {
+	params := configs.AppSettings.FxParams
+	switch params.Provider {
+	case "http":
+		SetRateProvider(newHTTPRateProvider(params.ApiURL, time.Duration(params.TimeoutSeconds)*time.Second))
+	default:
+		SetRateProvider(dbRateProvider{})
+	}
+}
+
+// Получить курс у текущего источника
+func GetExchangeRate(from, to string, at time.Time) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+
+	rate, err := rateProvider.Rate(from, to, at)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", errs.ErrExchangeRateNotFound, err)
+	}
+	if rate <= 0 {
+		return 0, errs.ErrExchangeRateNotFound
+	}
+	return rate, nil
+}
+
+// dbRateProvider берёт курс из таблицы exchange_rates, действовавший в момент операции.
+// Если прямой пары нет, используется обратная
+type dbRateProvider struct{}
+
+func (dbRateProvider) Rate(from, to string, at time.Time) (float64, error) {
+	rate, err := repository.GetExchangeRateAt(from, to, at)
+	if err == nil {
+		return rate.Rate, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, err
+	}
+
+	inverse, err := repository.GetExchangeRateAt(to, from, at)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, fmt.Errorf("no exchange rate for %s -> %s at %s", from, to, at.Format(time.RFC3339))
+		}
+		return 0, err
+	}
+	return 1 / inverse.Rate, nil
+}
+
+// httpRateProvider берёт курсы из внешнего API в формате frankfurter.app:
+// GET {api_url}/{YYYY-MM-DD}?from=USD&to=EUR -> {"rates": {"EUR": 0.93}}
+type httpRateProvider struct {
+	apiURL string
+	client *http.Client
+}
+
+func newHTTPRateProvider(apiURL string, timeout time.Duration) *httpRateProvider {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &httpRateProvider{
+		apiURL: strings.TrimRight(apiURL, "/"),
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (p *httpRateProvider) Rate(from, to string, at time.Time) (float64, error) {
+	query := url.Values{}
+	query.Set("from", from)
+	query.Set("to", to)
+
+	resp, err := p.client.Get(fmt.Sprintf("%s/%s?%s", p.apiURL, at.UTC().Format("2006-01-02"), query.Encode()))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("rate provider responded with status %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, err
+	}
+
+	rate, ok := body.Rates[to]
+	if !ok {
+		return 0, fmt.Errorf("no exchange rate for %s -> %s", from, to)
+	}
+	return rate, nil
+}
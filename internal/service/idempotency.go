@@ -0,0 +1,132 @@
+package service
+
+import (
+	"SB/internal/configs"
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"SB/logger"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const (
+	MaxIdempotencyKeyLength = 255
+	defaultIdempotencyTTL   = 24 * time.Hour
+	// Ключ без ответа дольше этого срока считается брошенным (например, процесс упал посреди запроса)
+	idempotencyPendingTimeout = 10 * time.Minute
+)
+
+// Отпечаток запроса: метод, путь и тело (JSON приводится к каноническому виду)
+func requestFingerprint(method, path string, body []byte) string {
+	canonical := body
+	var parsed interface{}
+	if err := json.Unmarshal(body, &parsed); err == nil {
+		if normalized, err := json.Marshal(parsed); err == nil {
+			canonical = normalized
+		}
+	}
+
+	hash := sha256.New()
+	hash.Write([]byte(method))
+	hash.Write([]byte{0})
+	hash.Write([]byte(path))
+	hash.Write([]byte{0})
+	hash.Write(bytes.TrimSpace(canonical))
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func idempotencyTTL() time.Duration {
+	hours := configs.AppSettings.IdempotencyParams.TtlHours
+	if hours <= 0 {
+		return defaultIdempotencyTTL
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// Начать идемпотентный запрос.
+// Если ключ новый - он резервируется и возвращается с replay = false.
+// Если по ключу уже есть сохранённый ответ с тем же телом запроса - он возвращается с replay = true.
+func BeginIdempotentRequest(userID int, key, method, path string, body []byte) (*models.IdempotencyKey, bool, error) {
+	if len(key) == 0 || len(key) > MaxIdempotencyKeyLength {
+		return nil, false, errs.ErrInvalidIdempotencyKey
+	}
+
+	err := repository.DeleteExpiredIdempotencyKey(userID, key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	idempotencyKey := &models.IdempotencyKey{
+		Key:         key,
+		UserID:      userID,
+		Method:      method,
+		Path:        path,
+		Fingerprint: requestFingerprint(method, path, body),
+		ExpiresAt:   time.Now().UTC().Add(idempotencyTTL()),
+	}
+
+	created, err := repository.CreateIdempotencyKey(idempotencyKey)
+	if err != nil {
+		return nil, false, err
+	}
+	if created {
+		return idempotencyKey, false, nil
+	}
+
+	existing, err := repository.GetIdempotencyKey(userID, key)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing.Fingerprint != idempotencyKey.Fingerprint {
+		return nil, false, errs.ErrIdempotencyKeyReused
+	}
+	if existing.StatusCode == nil {
+		return nil, false, errs.ErrIdempotencyKeyInProgress
+	}
+
+	return &existing, true, nil
+}
+
+// Завершить идемпотентный запрос: сохранить ответ для повторов.
+// Ответы с ошибкой сервера не сохраняются - ключ освобождается, чтобы клиент мог повторить запрос.
+// Так же с 401 и 403: после запроса второго фактора клиент повторяет запрос с тем же ключом и кодом,
+// и с 429: после блокировки неверных кодов запрос можно повторить позже
+func CompleteIdempotentRequest(id int, statusCode int, body []byte) error {
+	if statusCode >= 500 || statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden ||
+		statusCode == http.StatusTooManyRequests {
+		return repository.DeleteIdempotencyKey(id)
+	}
+
+	err := repository.SaveIdempotencyResponse(id, statusCode, body)
+	if err != nil {
+		// Ответ не сохранился: ключ освобождается, иначе он так и останется «в работе»
+		if deleteErr := repository.DeleteIdempotencyKey(id); deleteErr != nil {
+			return errors.Join(err, deleteErr)
+		}
+	}
+	return err
+}
+
+// Освободить ключ, если запрос оборвался без ответа
+func ReleaseIdempotentRequest(id int) error {
+	return repository.DeleteIdempotencyKey(id)
+}
+
+// Удалить истёкшие ключи идемпотентности и ключи, оставшиеся без ответа
+func RunIdempotencyCleanupJob(now time.Time) error {
+	now = now.UTC()
+	deleted, err := repository.DeleteExpiredIdempotencyKeys(now, now.Add(-idempotencyPendingTimeout))
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logger.Info.Printf("[service] RunIdempotencyCleanupJob(): %d idempotency keys deleted", deleted)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package service
+
+import "testing"
+
+func TestRequestFingerprint(t *testing.T) {
+	base := requestFingerprint("POST", "/transfers", []byte(`{"from_account_id":1,"to_account_id":2,"amount":500}`))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		same   bool
+	}{
+		{name: "same request", method: "POST", path: "/transfers",
+			body: `{"from_account_id":1,"to_account_id":2,"amount":500}`, same: true},
+		{name: "keys in another order", method: "POST", path: "/transfers",
+			body: `{"amount":500,"to_account_id":2,"from_account_id":1}`, same: true},
+		{name: "whitespace and line breaks", method: "POST", path: "/transfers",
+			body: "{\n  \"from_account_id\": 1,\n  \"to_account_id\": 2,\n  \"amount\": 500\n}\n", same: true},
+		{name: "another amount", method: "POST", path: "/transfers",
+			body: `{"from_account_id":1,"to_account_id":2,"amount":501}`},
+		{name: "another path", method: "POST", path: "/credits/1/repay",
+			body: `{"from_account_id":1,"to_account_id":2,"amount":500}`},
+		{name: "another method", method: "PUT", path: "/transfers",
+			body: `{"from_account_id":1,"to_account_id":2,"amount":500}`},
+		{name: "path and body do not run together", method: "POST", path: "/transfers{",
+			body: `"from_account_id":1,"to_account_id":2,"amount":500}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := requestFingerprint(tt.method, tt.path, []byte(tt.body))
+			if (got == base) != tt.same {
+				t.Errorf("requestFingerprint(%q, %q, %q) == base is %v, want %v", tt.method, tt.path, tt.body, got == base, tt.same)
+			}
+		})
+	}
+}
+
+func TestRequestFingerprintNonJSONBody(t *testing.T) {
+	if requestFingerprint("POST", "/credits/1/approve", nil) != requestFingerprint("POST", "/credits/1/approve", []byte("  ")) {
+		t.Error("empty and blank bodies should have the same fingerprint")
+	}
+	if requestFingerprint("POST", "/transfers", []byte("a=1")) == requestFingerprint("POST", "/transfers", []byte("a=2")) {
+		t.Error("different non-JSON bodies should have different fingerprints")
+	}
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"net/mail"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	// Имя пользователя начинается с буквы, поэтому его нельзя спутать с телефоном
+	usernamePattern = regexp.MustCompile(`^[a-z][a-z0-9._-]{2,31}$`)
+	// Телефон в формате E.164
+	phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
+	// Похоже на телефон: цифры и знаки, которыми их обычно разделяют
+	phoneLikePattern = regexp.MustCompile(`^\+?[0-9 ()\-.]+$`)
+	phoneSeparators  = strings.NewReplacer(" ", "", "-", "", "(", "", ")", "", ".", "")
+)
+
+func normalizeUsername(value string) (string, error) {
+	username := strings.ToLower(strings.TrimSpace(value))
+	if !usernamePattern.MatchString(username) {
+		return "", errs.ErrInvalidUsername
+	}
+	return username, nil
+}
+
+// Адрес приводится к нижнему регистру целиком: на практике почтовые сервисы регистр не различают
+func normalizeEmail(value string) (string, error) {
+	email := strings.ToLower(strings.TrimSpace(value))
+	if len(email) > 254 {
+		return "", errs.ErrInvalidEmail
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Name != "" || address.Address != email {
+		return "", errs.ErrInvalidEmail
+	}
+	domain := email[strings.LastIndex(email, "@")+1:]
+	if !strings.Contains(domain, ".") {
+		return "", errs.ErrInvalidEmail
+	}
+	return email, nil
+}
+
+func normalizePhone(value string) (string, error) {
+	phone := phoneSeparators.Replace(strings.TrimSpace(value))
+	if !phonePattern.MatchString(phone) {
+		return "", errs.ErrInvalidPhone
+	}
+	return phone, nil
+}
+
+// Привести идентификатор к виду, в котором он хранится
+func NormalizeIdentifier(kind, value string) (string, error) {
+	switch kind {
+	case models.IdentifierUsername:
+		return normalizeUsername(value)
+	case models.IdentifierEmail:
+		return normalizeEmail(value)
+	case models.IdentifierPhone:
+		return normalizePhone(value)
+	default:
+		return "", errs.ErrInvalidIdentifierKind
+	}
+}
+
+// Вид идентификатора, введённого при входе
+func identifierKindOf(login string) string {
+	login = strings.TrimSpace(login)
+	switch {
+	case strings.Contains(login, "@"):
+		return models.IdentifierEmail
+	case phoneLikePattern.MatchString(login):
+		return models.IdentifierPhone
+	default:
+		return models.IdentifierUsername
+	}
+}
+
+// Новый идентификатор пользователя: имя пользователя подтверждено сразу, почту и телефон нужно подтвердить
+func newUserIdentifier(userID int, kind, value string) (*models.UserIdentifier, error) {
+	normalized, err := NormalizeIdentifier(kind, value)
+	if err != nil {
+		return nil, err
+	}
+
+	identifier := &models.UserIdentifier{UserID: userID, Kind: kind, Value: normalized}
+	if kind == models.IdentifierUsername {
+		now := time.Now().UTC()
+		identifier.VerifiedAt = &now
+	}
+	return identifier, nil
+}
+
+// Идентификаторы пользователя
+func GetUserIdentifiers(userID int) ([]models.UserIdentifier, error) {
+	return repository.GetUserIdentifiers(userID)
+}
+
+// Задать или заменить идентификатор пользователя
+func SetUserIdentifier(userID int, kind, value string) (*models.UserIdentifier, error) {
+	identifier, err := newUserIdentifier(userID, kind, value)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = repository.SaveUserIdentifier(identifier); err != nil {
+		return nil, err
+	}
+
+	saved, err := repository.GetUserIdentifier(userID, kind)
+	if err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// Удалить почту или телефон. Имя пользователя удалить нельзя, его можно только заменить
+func DeleteUserIdentifier(userID int, kind string) error {
+	if kind == models.IdentifierUsername {
+		return errs.ErrIdentifierRequired
+	}
+	if kind != models.IdentifierEmail && kind != models.IdentifierPhone {
+		return errs.ErrInvalidIdentifierKind
+	}
+
+	deleted, err := repository.DeleteUserIdentifier(userID, kind)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return errs.ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"SB/internal/models"
+	"SB/internal/repository"
+	"github.com/jmoiron/sqlx"
+)
+
+// Проводки открытия депозита: сумма списывается со счёта клиента на счёт удерживаемых депозитов
+func depositOpenPostings(accountID int, currency string, amount models.Money) []models.Posting {
+	return []models.Posting{
+		{AccountID: accountID, Amount: -amount, Currency: currency},
+		{SystemAccount: models.SystemAccountDepositsHeld, Amount: amount, Currency: currency},
+	}
+}
+
+// Проводки выплаты депозита: тело возвращается с удерживаемых депозитов, начисленные проценты - с процентов к выплате
+func depositPayoutPostings(accountID int, currency string, principal, interest models.Money) []models.Posting {
+	postings := []models.Posting{
+		{AccountID: accountID, Amount: principal + interest, Currency: currency},
+		{SystemAccount: models.SystemAccountDepositsHeld, Amount: -principal, Currency: currency},
+	}
+	if interest != 0 {
+		postings = append(postings, models.Posting{
+			SystemAccount: models.SystemAccountInterestPayable, Amount: -interest, Currency: currency,
+		})
+	}
+	return postings
+}
+
+// Проводки досрочного расторжения: клиенту выплачивается payout, всё, что удерживалось по депозиту сверх этого
+// (пересчитанные проценты или штраф), сторнирует процентные расходы банка
+func depositEarlyWithdrawalPostings(accountID int, currency string, held, accrued, payout models.Money) []models.Posting {
+	postings := []models.Posting{
+		{SystemAccount: models.SystemAccountDepositsHeld, Amount: -held, Currency: currency},
+	}
+	if payout != 0 {
+		postings = append(postings, models.Posting{AccountID: accountID, Amount: payout, Currency: currency})
+	}
+	if accrued != 0 {
+		postings = append(postings, models.Posting{
+			SystemAccount: models.SystemAccountInterestPayable, Amount: -accrued, Currency: currency,
+		})
+	}
+	if forfeited := held + accrued - payout; forfeited != 0 {
+		postings = append(postings, models.Posting{
+			SystemAccount: models.SystemAccountInterestExpense, Amount: forfeited, Currency: currency,
+		})
+	}
+	return postings
+}
+
+// Проводки пролонгации: удерживаемое тело переходит на новый депозит вместе с процентами
+// или без них - тогда проценты выплачиваются на счёт клиента
+func depositRolloverPostings(accountID int, currency string, held, accrued, newAmount models.Money) []models.Posting {
+	postings := []models.Posting{
+		{SystemAccount: models.SystemAccountDepositsHeld, Amount: -held, Currency: currency},
+		{SystemAccount: models.SystemAccountDepositsHeld, Amount: newAmount, Currency: currency},
+	}
+	if accrued != 0 {
+		postings = append(postings, models.Posting{
+			SystemAccount: models.SystemAccountInterestPayable, Amount: -accrued, Currency: currency,
+		})
+	}
+	if paid := held + accrued - newAmount; paid != 0 {
+		postings = append(postings, models.Posting{AccountID: accountID, Amount: paid, Currency: currency})
+	}
+	return postings
+}
+
+// Проводки ежедневного начисления процентов по депозиту: расход банка, долг перед клиентом по процентам
+func depositAccrualPostings(currency string, interest models.Money) []models.Posting {
+	return []models.Posting{
+		{SystemAccount: models.SystemAccountInterestExpense, Amount: -interest, Currency: currency},
+		{SystemAccount: models.SystemAccountInterestPayable, Amount: interest, Currency: currency},
+	}
+}
+
+// Проводки капитализации: начисленные проценты присоединяются к телу депозита
+func depositCapitalizationPostings(currency string, interest models.Money) []models.Posting {
+	return []models.Posting{
+		{SystemAccount: models.SystemAccountInterestPayable, Amount: -interest, Currency: currency},
+		{SystemAccount: models.SystemAccountDepositsHeld, Amount: interest, Currency: currency},
+	}
+}
+
+// Проводки выплаты начисленных процентов на привязанный счёт клиента
+func depositInterestPayoutPostings(accountID int, currency string, interest models.Money) []models.Posting {
+	return []models.Posting{
+		{SystemAccount: models.SystemAccountInterestPayable, Amount: -interest, Currency: currency},
+		{AccountID: accountID, Amount: interest, Currency: currency},
+	}
+}
+
+// Проводки выдачи кредита: деньги из кредитного портфеля зачисляются на счёт клиента
+func creditDisbursementPostings(accountID int, currency string, amount models.Money) []models.Posting {
+	return []models.Posting{
+		{SystemAccount: models.SystemAccountLoanBook, Amount: -amount, Currency: currency},
+		{AccountID: accountID, Amount: amount, Currency: currency},
+	}
+}
+
+// Проводки погашения кредита: тело возвращается в кредитный портфель, проценты и неустойка относятся на доходы банка
+func creditRepaymentPostings(accountID int, currency string, principal, interest, penalty models.Money) []models.Posting {
+	postings := []models.Posting{
+		{AccountID: accountID, Amount: -(principal + interest + penalty), Currency: currency},
+	}
+	if principal != 0 {
+		postings = append(postings, models.Posting{
+			SystemAccount: models.SystemAccountLoanBook, Amount: principal, Currency: currency,
+		})
+	}
+	if interest != 0 {
+		postings = append(postings, models.Posting{
+			SystemAccount: models.SystemAccountInterestIncome, Amount: interest, Currency: currency,
+		})
+	}
+	if penalty != 0 {
+		postings = append(postings, models.Posting{
+			SystemAccount: models.SystemAccountPenaltyIncome, Amount: penalty, Currency: currency,
+		})
+	}
+	return postings
+}
+
+// Проводки ручной корректировки баланса: разница отражается через кассу банка
+func balanceAdjustmentPostings(accountID int, currency string, delta models.Money) []models.Posting {
+	return []models.Posting{
+		{SystemAccount: models.SystemAccountBankCash, Amount: -delta, Currency: currency},
+		{AccountID: accountID, Amount: delta, Currency: currency},
+	}
+}
+
+// Корректировка баланса счёта отдельной проводкой в рамках транзакции
+func adjustBalance(tx *sqlx.Tx, accountID int, currency string, delta models.Money) error {
+	_, _, err := repository.PostJournal(tx, models.OperationBalanceAdjustment, &accountID,
+		balanceAdjustmentPostings(accountID, currency, delta))
+	return err
+}
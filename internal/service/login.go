@@ -0,0 +1,257 @@
+package service
+
+import (
+	"SB/internal/configs"
+	"SB/internal/db"
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"SB/logger"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultLoginMaxFailures   = 5
+	defaultLoginIPMaxFailures = 20
+	defaultLoginFailureWindow = 15 * time.Minute
+	defaultLoginLockout       = 15 * time.Minute
+	defaultLoginBaseDelay     = time.Second
+	defaultLoginMaxDelay      = 30 * time.Second
+)
+
+func loginMaxFailures(scope string) int {
+	params := configs.AppSettings.LoginParams
+	if scope == models.LoginScopeIP {
+		if params.IPMaxFailures > 0 {
+			return params.IPMaxFailures
+		}
+		return defaultLoginIPMaxFailures
+	}
+	if params.MaxFailures > 0 {
+		return params.MaxFailures
+	}
+	return defaultLoginMaxFailures
+}
+
+func loginFailureWindow() time.Duration {
+	minutes := configs.AppSettings.LoginParams.FailureWindowMinutes
+	if minutes <= 0 {
+		return defaultLoginFailureWindow
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+func loginLockout() time.Duration {
+	minutes := configs.AppSettings.LoginParams.LockoutMinutes
+	if minutes <= 0 {
+		return defaultLoginLockout
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Пауза после failures неудачных попыток: каждая следующая вдвое длиннее, но не больше max_delay_seconds
+func loginDelay(failures int) time.Duration {
+	params := configs.AppSettings.LoginParams
+	base, maxDelay := defaultLoginBaseDelay, defaultLoginMaxDelay
+	if params.BaseDelaySeconds > 0 {
+		base = time.Duration(params.BaseDelaySeconds) * time.Second
+	}
+	if params.MaxDelaySeconds > 0 {
+		maxDelay = time.Duration(params.MaxDelaySeconds) * time.Second
+	}
+
+	delay := base
+	for i := 1; i < failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxDelay)
+}
+
+// Блокирует ли счётчик попытку сейчас: действует блокировка или не прошла пауза после последней неудачи
+func loginBlock(failure models.LoginFailure, now time.Time) error {
+	if failure.LockedUntil != nil {
+		if now.Before(*failure.LockedUntil) {
+			return &errs.LoginBlockedError{Reason: errs.ErrLoginLocked, RetryAt: *failure.LockedUntil}
+		}
+		return nil
+	}
+	if failure.FailedCount == 0 || failure.LastFailedAt.Before(now.Add(-loginFailureWindow())) {
+		return nil
+	}
+
+	retryAt := failure.LastFailedAt.Add(loginDelay(failure.FailedCount))
+	if now.Before(retryAt) {
+		return &errs.LoginBlockedError{Reason: errs.ErrLoginThrottled, RetryAt: retryAt}
+	}
+	return nil
+}
+
+// Занять попытку входа: проверить, что пробовать можно, и сразу засчитать попытку неудачной.
+// Проверка и учёт идут в одной транзакции под блокировкой строки счётчика, поэтому параллельные попытки
+// не проходят проверку все разом. Удачную попытку затем возвращает refundLoginAttempt,
+// неудачную завершает failLoginAttempt
+func claimLoginAttempt(scope, subject string, now time.Time) (err error) {
+	if subject == "" {
+		return nil
+	}
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	failure, err := repository.GetLoginFailureForUpdate(tx, scope, subject, now)
+	if err != nil {
+		return err
+	}
+	if err = loginBlock(failure, now); err != nil {
+		return err
+	}
+	if _, err = repository.RegisterLoginFailure(tx, scope, subject, now, now.Add(-loginFailureWindow())); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Попытка оказалась удачной: вернуть засчитанную заранее неудачу
+func refundLoginAttempt(scope, subject string) {
+	if subject == "" {
+		return
+	}
+	if err := repository.RefundLoginFailure(scope, subject); err != nil {
+		logger.Error.Printf("[service] refundLoginAttempt(): %s %s: %v", scope, subject, err)
+	}
+}
+
+// Попытка оказалась неудачной (она уже засчитана): заблокировать вход, если набралось max_failures попыток за окно
+func failLoginAttempt(scope, subject string, userID int, clientIP string, now time.Time) error {
+	if subject == "" {
+		return nil
+	}
+
+	failure, err := repository.GetLoginFailure(scope, subject)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if failure.FailedCount < loginMaxFailures(scope) {
+		return nil
+	}
+
+	lockedUntil := now.Add(loginLockout())
+	locked, err := repository.LockLogin(scope, subject, lockedUntil, now)
+	if err != nil || !locked {
+		return err
+	}
+
+	logger.Warn.Printf("[service] failLoginAttempt(): sign-in locked for %s %s until %s after %d failed attempts",
+		scope, subject, lockedUntil.Format(time.RFC3339), failure.FailedCount)
+
+	details := fmt.Sprintf("%d failed sign-in attempts, last from %s, locked until %s",
+		failure.FailedCount, clientIP, lockedUntil.Format(time.RFC3339))
+	if scope == models.LoginScopeIP {
+		details = fmt.Sprintf("ip %s: %d failed sign-in attempts, locked until %s",
+			subject, failure.FailedCount, lockedUntil.Format(time.RFC3339))
+	}
+	if err := repository.WriteAuditLogDetails("lock_login", scope, userID, 0, details); err != nil {
+		logger.Error.Printf("[service] failLoginAttempt(): audit log: %v", err)
+	}
+	return nil
+}
+
+// Занять попытку входа для адреса клиента и пользователя. Если пользователю пробовать рано,
+// попытка адреса возвращается
+func claimSignIn(user *models.User, clientIP string, now time.Time) error {
+	if err := claimLoginAttempt(models.LoginScopeIP, clientIP, now); err != nil {
+		return err
+	}
+	if err := claimLoginAttempt(models.LoginScopeUser, strconv.Itoa(user.ID), now); err != nil {
+		refundLoginAttempt(models.LoginScopeIP, clientIP)
+		return err
+	}
+	return nil
+}
+
+// Неудачный вход: считается и для пользователя (если он найден), и для адреса клиента
+func registerFailedSignIn(user *models.User, clientIP string, now time.Time) error {
+	if user != nil {
+		if err := failLoginAttempt(models.LoginScopeUser, strconv.Itoa(user.ID), user.ID, clientIP, now); err != nil {
+			return err
+		}
+	}
+	return failLoginAttempt(models.LoginScopeIP, clientIP, 0, clientIP, now)
+}
+
+// Удачная проверка пароля или кода: попытки пользователя и адреса возвращаются
+func refundSignIn(user *models.User, clientIP string) {
+	refundLoginAttempt(models.LoginScopeUser, strconv.Itoa(user.ID))
+	refundLoginAttempt(models.LoginScopeIP, clientIP)
+}
+
+// Действующие блокировки входа
+func GetLoginLocks() ([]models.LoginFailure, error) {
+	return repository.GetActiveLoginLocks(time.Now().UTC())
+}
+
+// Снять блокировку входа пользователя и сбросить его счётчик попыток
+func UnlockUserLogin(userID, unlockedBy int) error {
+	reset, err := repository.ResetLoginFailures(models.LoginScopeUser, strconv.Itoa(userID))
+	if err != nil {
+		return err
+	}
+	if !reset {
+		return errs.ErrNotFound
+	}
+
+	if err := repository.WriteAuditLog("unlock_login", models.LoginScopeUser, userID, unlockedBy); err != nil {
+		logger.Error.Printf("[service] UnlockUserLogin(): audit log: %v", err)
+	}
+	return nil
+}
+
+// Снять блокировку входа с адреса клиента
+func UnlockIPLogin(ip string, unlockedBy int) error {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return errs.ErrInvalidIPAddress
+	}
+	ip = parsed.String()
+
+	reset, err := repository.ResetLoginFailures(models.LoginScopeIP, ip)
+	if err != nil {
+		return err
+	}
+	if !reset {
+		return errs.ErrNotFound
+	}
+
+	if err := repository.WriteAuditLogDetails("unlock_login", models.LoginScopeIP, 0, unlockedBy, "ip "+ip); err != nil {
+		logger.Error.Printf("[service] UnlockIPLogin(): audit log: %v", err)
+	}
+	return nil
+}
+
+// Удалить счётчики попыток, по которым давно не было неудач и нет блокировки
+func RunLoginFailureCleanupJob(now time.Time) error {
+	now = now.UTC()
+	deleted, err := repository.DeleteStaleLoginFailures(now.Add(-loginFailureWindow()), now)
+	if err != nil {
+		return err
+	}
+	if deleted > 0 {
+		logger.Info.Printf("[service] RunLoginFailureCleanupJob(): %d stale sign-in counters deleted", deleted)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"SB/internal/configs"
+	"SB/logger"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const defaultNotificationsFile = "logs/notifications.log"
+
+// Notifier доставляет сообщение пользователю по каналу (email или phone) на адрес to
+type Notifier interface {
+	Notify(channel, to, subject, message string) error
+}
+
+var notifier Notifier = stdoutNotifier{}
+
+// Подменить способ доставки (например, в main или при тестировании)
+func SetNotifier(n Notifier) {
+	notifier = n
+}
+
+// Выбрать способ доставки согласно notifier_params из конфига
+func InitNotifier() {
+	params := configs.AppSettings.NotifierParams
+	switch params.Provider {
+	case "file":
+		path := params.FilePath
+		if path == "" {
+			path = defaultNotificationsFile
+		}
+		SetNotifier(&fileNotifier{path: path})
+	default:
+		SetNotifier(stdoutNotifier{})
+	}
+}
+
+func formatNotification(channel, to, subject, message string) string {
+	return fmt.Sprintf("%s [%s] to=%s subject=%q %s\n", time.Now().UTC().Format(time.RFC3339), channel, to, subject, message)
+}
+
+// stdoutNotifier печатает сообщения в stdout, для локальной разработки
+type stdoutNotifier struct{}
+
+func (stdoutNotifier) Notify(channel, to, subject, message string) error {
+	_, err := fmt.Print(formatNotification(channel, to, subject, message))
+	return err
+}
+
+// fileNotifier дописывает сообщения в файл, для локального тестирования
+type fileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+func (n *fileNotifier) Notify(channel, to, subject, message string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(n.path), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err = file.WriteString(formatNotification(channel, to, subject, message)); err != nil {
+		logger.Error.Printf("[service] fileNotifier.Notify(): %v", err)
+		return err
+	}
+	return nil
+}
+
+// Отправить сообщение текущим способом доставки
+func sendNotification(channel, to, subject, message string) error {
+	return notifier.Notify(channel, to, subject, message)
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"SB/internal/configs"
+	"SB/internal/models"
+)
+
+const (
+	defaultPageLimit = 20
+	defaultMaxLimit  = 100
+)
+
+// Размер страницы: без limit - значение по умолчанию из конфига, больше max_limit - max_limit
+func pageParams(page models.PageParams) models.PageParams {
+	params := configs.AppSettings.PaginationParams
+	maxLimit := params.MaxLimit
+	if maxLimit <= 0 {
+		maxLimit = defaultMaxLimit
+	}
+	if page.Limit <= 0 {
+		page.Limit = params.DefaultLimit
+		if page.Limit <= 0 {
+			page.Limit = defaultPageLimit
+		}
+	}
+	if page.Limit > maxLimit {
+		page.Limit = maxLimit
+	}
+	return page
+}
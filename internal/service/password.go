@@ -0,0 +1,355 @@
+package service
+
+import (
+	"SB/internal/configs"
+	"SB/internal/db"
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"SB/logger"
+	"SB/utils"
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/crypto/bcrypt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultPasswordMinLength = 8
+	// bcrypt учитывает только первые 72 байта
+	passwordMaxBytes           = 72
+	defaultPasswordHistorySize = 5
+	defaultPasswordResetTTL    = 30 * time.Minute
+)
+
+var (
+	breachedPasswords     map[string]struct{}
+	breachedPasswordsOnce sync.Once
+)
+
+func passwordMinLength() int {
+	if length := configs.AppSettings.PasswordParams.MinLength; length > 0 {
+		return length
+	}
+	return defaultPasswordMinLength
+}
+
+func passwordHistorySize() int {
+	if size := configs.AppSettings.PasswordParams.HistorySize; size > 0 {
+		return size
+	}
+	return defaultPasswordHistorySize
+}
+
+func bcryptCost() int {
+	cost := configs.AppSettings.PasswordParams.BcryptCost
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return bcrypt.DefaultCost
+	}
+	return cost
+}
+
+func passwordResetTTL() time.Duration {
+	minutes := configs.AppSettings.PasswordParams.ResetTtlMinutes
+	if minutes <= 0 {
+		return defaultPasswordResetTTL
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Список паролей из утечек читается из файла один раз. Без файла проверка по списку не делается
+func isBreachedPassword(password string) bool {
+	breachedPasswordsOnce.Do(func() {
+		breachedPasswords = map[string]struct{}{}
+		path := configs.AppSettings.PasswordParams.DenylistFile
+		if path == "" {
+			return
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			logger.Warn.Printf("[service] isBreachedPassword(): denylist not loaded: %v", err)
+			return
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			breachedPasswords[strings.ToLower(line)] = struct{}{}
+		}
+		if err = scanner.Err(); err != nil {
+			logger.Warn.Printf("[service] isBreachedPassword(): reading denylist: %v", err)
+		}
+	})
+
+	_, found := breachedPasswords[strings.ToLower(password)]
+	return found
+}
+
+// Проверить пароль по политике из password_params: длина, классы символов, список утечек
+func ValidatePassword(password string) error {
+	if len([]rune(password)) < passwordMinLength() {
+		return errs.ErrPasswordTooShort
+	}
+	if len(password) > passwordMaxBytes {
+		return errs.ErrPasswordTooLong
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+
+	params := configs.AppSettings.PasswordParams
+	if (params.RequireUpper && !upper) || (params.RequireLower && !lower) ||
+		(params.RequireDigit && !digit) || (params.RequireSymbol && !symbol) {
+		return errs.ErrPasswordTooWeak
+	}
+
+	if isBreachedPassword(password) {
+		return errs.ErrPasswordBreached
+	}
+	return nil
+}
+
+// Хеш нового пароля после проверки политики. Пароль не должен совпадать с текущим
+// и с history_size - 1 прежними
+func newPasswordHash(userID int, currentHash, password string) (string, error) {
+	if err := ValidatePassword(password); err != nil {
+		return "", err
+	}
+
+	if checkPasswordHash(password, currentHash) {
+		return "", errs.ErrPasswordReused
+	}
+	if previous := passwordHistorySize() - 1; previous > 0 {
+		history, err := repository.GetPasswordHistory(userID, previous)
+		if err != nil {
+			return "", err
+		}
+		for _, hash := range history {
+			if checkPasswordHash(password, hash) {
+				return "", errs.ErrPasswordReused
+			}
+		}
+	}
+
+	hashed, err := hashPassword(password)
+	if err != nil {
+		return "", errs.ErrCreateHash
+	}
+	return hashed, nil
+}
+
+// Сменить пароль, прежний хеш уходит в историю. Все refresh-токены пользователя отзываются,
+// чтобы сессии, открытые со старым паролем, не продолжались
+func changePassword(tx *sqlx.Tx, userID int, currentHash, newHash string) error {
+	if err := repository.AddPasswordHistory(tx, userID, currentHash, passwordHistorySize()-1); err != nil {
+		return err
+	}
+	if err := repository.UpdateUserPassword(tx, userID, newHash); err != nil {
+		return err
+	}
+	return repository.RevokeUserRefreshTokens(tx, userID)
+}
+
+// Перехешировать пароль при входе, если bcrypt_cost в конфиге изменился
+func rehashPasswordIfNeeded(user *models.User, password string) {
+	cost, err := bcrypt.Cost([]byte(user.Password))
+	if err != nil || cost == bcryptCost() {
+		return
+	}
+
+	hashed, err := hashPassword(password)
+	if err != nil {
+		logger.Error.Printf("[service] rehashPasswordIfNeeded(): %v", err)
+		return
+	}
+	if err = repository.RehashUserPassword(user.ID, user.Password, hashed); err != nil {
+		logger.Error.Printf("[service] rehashPasswordIfNeeded(): %v", err)
+		return
+	}
+	user.Password = hashed
+}
+
+// Куда отправить ссылку для сброса: подтверждённая почта, иначе подтверждённый телефон
+func passwordResetDestination(userID int) (*models.UserIdentifier, error) {
+	identifiers, err := repository.GetUserIdentifiers(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var phone *models.UserIdentifier
+	for i := range identifiers {
+		if identifiers[i].VerifiedAt == nil {
+			continue
+		}
+		switch identifiers[i].Kind {
+		case models.IdentifierEmail:
+			return &identifiers[i], nil
+		case models.IdentifierPhone:
+			phone = &identifiers[i]
+		}
+	}
+	return phone, nil
+}
+
+// Запросить сброс пароля по любому подтверждённому идентификатору. Токен уходит на почту или телефон.
+// Результат для вызывающего всегда один и тот же, чтобы по ответу нельзя было узнать, есть ли такой пользователь
+func RequestPasswordReset(login string) (err error) {
+	kind := identifierKindOf(login)
+	value, err := NormalizeIdentifier(kind, login)
+	if err != nil {
+		return nil
+	}
+
+	user, err := repository.GetUserByIdentifier(kind, value)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	destination, err := passwordResetDestination(user.ID)
+	if err != nil {
+		return err
+	}
+	if destination == nil {
+		logger.Warn.Printf("[service] RequestPasswordReset(): user %d has no verified email or phone", user.ID)
+		return nil
+	}
+
+	now := time.Now().UTC()
+	last, err := repository.GetLatestPasswordReset(user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && now.Before(last.CreatedAt.Add(verificationResendInterval())) {
+		return nil
+	}
+
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return errs.ErrGenerateToken
+	}
+	reset := &models.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: hashRefreshToken(token),
+		ExpiresAt: now.Add(passwordResetTTL()),
+		CreatedAt: now,
+	}
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = repository.ReplacePasswordReset(tx, reset); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	// Отправляем только сохранённый токен. Если отправить не удалось, токен удаляется,
+	// чтобы новый можно было запросить сразу
+	message := fmt.Sprintf("Use this token to reset your %s password: %s. It expires in %d minutes. If you did not ask for it, ignore this message.",
+		configs.AppSettings.AppParams.ServerName, token, int(passwordResetTTL().Minutes()))
+	if err = sendNotification(destination.Kind, destination.Value, "Password reset", message); err != nil {
+		if deleteErr := repository.DeletePasswordReset(reset.ID); deleteErr != nil {
+			logger.Error.Printf("[service] RequestPasswordReset(): repository.DeletePasswordReset: %v", deleteErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Установить новый пароль по токену сброса. Все сессии пользователя завершаются,
+// блокировка входа снимается. Со вторым фактором нужен ещё код из приложения или код восстановления
+func ResetPassword(token, password, otpCode string) (err error) {
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	reset, err := repository.GetPasswordResetForUpdate(tx, hashRefreshToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errs.ErrInvalidResetToken
+		}
+		return err
+	}
+
+	now := time.Now().UTC()
+	if reset.UsedAt != nil || !now.Before(reset.ExpiresAt) {
+		err = errs.ErrInvalidResetToken
+		return err
+	}
+
+	user, err := repository.GetUserByID(reset.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errs.ErrInvalidResetToken
+		}
+		return err
+	}
+
+	if err = requireStepUp(user.ID, otpCode); err != nil {
+		return err
+	}
+
+	hashed, err := newPasswordHash(user.ID, user.Password, password)
+	if err != nil {
+		return err
+	}
+
+	if err = changePassword(tx, user.ID, user.Password, hashed); err != nil {
+		return err
+	}
+	if err = repository.UsePasswordReset(tx, reset.ID, now); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	if _, err := repository.ResetLoginFailures(models.LoginScopeUser, strconv.Itoa(user.ID)); err != nil {
+		logger.Error.Printf("[service] ResetPassword(): reset login failures: %v", err)
+	}
+	if err := repository.WriteAuditLog("reset_password", "user", user.ID, user.ID); err != nil {
+		logger.Error.Printf("[service] ResetPassword(): audit log: %v", err)
+	}
+	return nil
+}
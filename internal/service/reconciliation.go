@@ -0,0 +1,46 @@
+package service
+
+import (
+	"SB/internal/models"
+	"SB/internal/repository"
+	"time"
+)
+
+// Сверка: пересчитать баланс каждого счёта по журналу и сравнить с accounts.balance
+func Reconcile() (*models.ReconciliationReport, error) {
+	lines, err := repository.GetLedgerBalances()
+	if err != nil {
+		return nil, err
+	}
+
+	unbalanced, err := repository.GetUnbalancedJournalIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.ReconciliationReport{
+		GeneratedAt:        time.Now().UTC(),
+		Drifts:             []models.ReconciliationLine{},
+		DriftByCurrency:    make(map[string]models.Money),
+		UnbalancedJournals: unbalanced,
+	}
+	if report.UnbalancedJournals == nil {
+		report.UnbalancedJournals = []int64{}
+	}
+
+	checked := make(map[int]struct{})
+	for _, line := range lines {
+		checked[line.AccountID] = struct{}{}
+
+		line.Drift = line.Balance - line.LedgerBalance
+		if line.Drift == 0 {
+			continue
+		}
+		report.Drifts = append(report.Drifts, line)
+		report.DriftByCurrency[line.Currency] += line.Drift
+	}
+
+	report.AccountsChecked = len(checked)
+	report.Balanced = len(report.Drifts) == 0 && len(report.UnbalancedJournals) == 0
+	return report, nil
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"SB/internal/db"
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"database/sql"
+	"errors"
+	"slices"
+)
+
+// Получить роли вместе с разрешениями
+func GetRoles() ([]models.Role, error) {
+	return repository.GetRoles()
+}
+
+// Получить роли пользователя
+func GetUserRoles(userID int) ([]models.UserRole, error) {
+	if _, err := GetUserByID(userID); err != nil {
+		return nil, err
+	}
+	return repository.GetUserRoles(userID)
+}
+
+func checkRole(userID int, role string) error {
+	exists, err := repository.RoleExists(role)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errs.ErrInvalidRole
+	}
+	_, err = GetUserByID(userID)
+	return err
+}
+
+// Выдать роль пользователю. Повторная выдача ничего не меняет.
+// Новые разрешения попадают в токен при следующем входе или обновлении токена
+func GrantRole(userID int, role string, grantedBy int) (err error) {
+	if err = checkRole(userID, role); err != nil {
+		return err
+	}
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = repository.GrantRole(tx, userID, role, &grantedBy); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Выдать роль admin пользователю по логину (username, email или телефон) без участия другого администратора.
+// Вызывается из командной строки (флаг -grant-admin): так назначается первый администратор
+func BootstrapAdmin(login string) (userID int, err error) {
+	kind := identifierKindOf(login)
+	value, err := NormalizeIdentifier(kind, login)
+	if err != nil {
+		return 0, errs.ErrNotFound
+	}
+
+	user, err := repository.GetUserByIdentifier(kind, value)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errs.ErrNotFound
+		}
+		return 0, err
+	}
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = repository.GrantRole(tx, user.ID, models.RoleAdmin, nil); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// Отозвать роль у пользователя. Последнего администратора оставить без роли нельзя
+func RevokeRole(userID int, role string, revokedBy int) (err error) {
+	if err = checkRole(userID, role); err != nil {
+		return err
+	}
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if role == models.RoleAdmin {
+		var admins []int
+		admins, err = repository.GetRoleHoldersForUpdate(tx, models.RoleAdmin)
+		if err != nil {
+			return err
+		}
+		if len(admins) == 1 && slices.Contains(admins, userID) {
+			err = errs.ErrLastAdmin
+			return err
+		}
+	}
+
+	revoked, err := repository.RevokeRole(tx, userID, role, revokedBy)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		err = errs.ErrRoleNotGranted
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"SB/internal/configs"
+	"SB/logger"
+	"time"
+)
+
+type scheduledJob struct {
+	name string
+	run  func(now time.Time) error
+}
+
+// Фоновые задачи в порядке запуска
+var scheduledJobs = []scheduledJob{
+	{name: "credit_delinquency", run: RunCreditDelinquencyJob},
+	{name: "deposit_accrual", run: RunDepositAccrualJob},
+	{name: "deposit_maturity", run: RunDepositMaturityJob},
+	{name: "token_cleanup", run: RunTokenCleanupJob},
+	{name: "login_failure_cleanup", run: RunLoginFailureCleanupJob},
+	{name: "idempotency_cleanup", run: RunIdempotencyCleanupJob},
+	{name: "signing_key_rotation", run: RunSigningKeyRotationJob},
+}
+
+// Выполнить все фоновые задачи один раз. Ошибка одной задачи не мешает остальным
+func RunScheduledJobs(now time.Time) {
+	now = now.UTC()
+	for _, job := range scheduledJobs {
+		if err := job.run(now); err != nil {
+			logger.Error.Printf("[service] RunScheduledJobs(): job %s failed: %v", job.name, err)
+		}
+	}
+}
+
+func schedulerInterval() time.Duration {
+	interval := time.Duration(configs.AppSettings.SchedulerParams.IntervalMinutes) * time.Minute
+	if interval <= 0 {
+		return time.Hour
+	}
+	return interval
+}
+
+// Запустить планировщик фоновых задач: сразу при старте и дальше с интервалом из конфига
+func StartScheduler() {
+	interval := schedulerInterval()
+
+	go func() {
+		RunScheduledJobs(time.Now())
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			RunScheduledJobs(now)
+		}
+	}()
+}
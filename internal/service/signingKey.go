@@ -0,0 +1,459 @@
+package service
+
+import (
+	"SB/internal/configs"
+	"SB/internal/db"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"SB/logger"
+	"SB/utils"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jmoiron/sqlx"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultKeyRotation = 30 * 24 * time.Hour
+	rsaKeyBits         = 2048
+	// Сколько клиенты могут держать JWKS в кеше. Новый ключ публикуется за это время до того, как начнёт подписывать
+	JWKSMaxAge = 5 * time.Minute
+	// Запас к сроку жизни access-токена, в течение которого выведенный ключ ещё проверяет подписи
+	retiredKeyLeeway = 5 * time.Minute
+	// Не чаще этого перечитывать ключи из БД, если пришёл токен с неизвестным kid
+	signingKeysReloadInterval = 10 * time.Second
+	// Ключ для подписи перечитывается из БД не реже этого, чтобы все экземпляры переходили на новый ключ вовремя
+	signingKeysRefreshInterval = time.Minute
+	// Переменная окружения с секретом, которым шифруются закрытые ключи в БД
+	signingKeySecretEnv = "SIGNING_KEY_SECRET"
+)
+
+var (
+	errUnknownSigningKey       = errors.New("unknown signing key")
+	errSigningKeySecretMissing = errors.New(signingKeySecretEnv + " is not set")
+)
+
+// Ключ, которым можно подписывать с activatesAt
+type signingCandidate struct {
+	key         *utils.SigningKey
+	activatesAt time.Time
+}
+
+// Ключи подписи загружаются из таблицы signing_keys и держатся в памяти
+var (
+	signingKeysMu       sync.RWMutex
+	signingKeys         map[string]*utils.SigningKey
+	signingCandidates   []signingCandidate
+	signingKeysLoadedAt time.Time
+)
+
+func keyRotationPeriod() time.Duration {
+	days := configs.AppSettings.AuthParams.KeyRotationDays
+	if days <= 0 {
+		return defaultKeyRotation
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func configuredSigningAlgorithm() string {
+	if configs.AppSettings.AuthParams.SigningAlgorithm == models.SigningAlgorithmRS256 {
+		return models.SigningAlgorithmRS256
+	}
+	return models.SigningAlgorithmEdDSA
+}
+
+// Выведенный ключ проверяет подписи, пока не истекут подписанные им токены. Экземпляр, ещё не узнавший
+// о новом ключе, может подписывать старым до следующего запуска планировщика, поэтому интервал тоже учитывается
+func retiredKeyTTL() time.Duration {
+	return schedulerInterval() + utils.AccessTokenTTL() + retiredKeyLeeway
+}
+
+// Шифр для закрытых ключей: AES-256-GCM с ключом из SIGNING_KEY_SECRET
+func signingKeyCipher() (cipher.AEAD, error) {
+	secret := os.Getenv(signingKeySecretEnv)
+	if secret == "" {
+		return nil, errSigningKeySecretMissing
+	}
+	sum := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Зашифровать закрытый ключ. kid входит в проверяемые данные, поэтому шифртекст нельзя подставить другому ключу
+func sealPrivateKey(kid string, privateDER []byte) ([]byte, error) {
+	aead, err := signingKeyCipher()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, privateDER, []byte(kid)), nil
+}
+
+// Расшифровать закрытый ключ. Ключи, созданные до шифрования, возвращаются как есть
+func openPrivateKey(stored models.SigningKey) ([]byte, error) {
+	if !stored.Encrypted {
+		return stored.PrivateKey, nil
+	}
+	aead, err := signingKeyCipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(stored.PrivateKey) < aead.NonceSize() {
+		return nil, fmt.Errorf("signing key %s: encrypted private key is too short", stored.KID)
+	}
+	nonce, sealed := stored.PrivateKey[:aead.NonceSize()], stored.PrivateKey[aead.NonceSize():]
+	privateDER, err := aead.Open(nil, nonce, sealed, []byte(stored.KID))
+	if err != nil {
+		return nil, fmt.Errorf("signing key %s: cannot decrypt private key, check %s", stored.KID, signingKeySecretEnv)
+	}
+	return privateDER, nil
+}
+
+// Сгенерировать новую пару ключей
+func newSigningKey(algorithm string, now time.Time) (*models.SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch algorithm {
+	case models.SigningAlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	default:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := utils.RandomToken(12)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := sealPrivateKey(kid, privateDER)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SigningKey{
+		KID:         kid,
+		Algorithm:   algorithm,
+		PrivateKey:  sealed,
+		PublicKey:   publicDER,
+		Encrypted:   true,
+		CreatedAt:   now,
+		ActivatesAt: now,
+	}, nil
+}
+
+// Разобрать сохранённый ключ
+func decodeSigningKey(stored models.SigningKey) (*utils.SigningKey, error) {
+	privateDER, err := openPrivateKey(stored)
+	if err != nil {
+		return nil, err
+	}
+	private, err := x509.ParsePKCS8PrivateKey(privateDER)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s: unsupported private key type", stored.KID)
+	}
+
+	var method jwt.SigningMethod
+	switch stored.Algorithm {
+	case models.SigningAlgorithmEdDSA:
+		method = jwt.SigningMethodEdDSA
+	case models.SigningAlgorithmRS256:
+		method = jwt.SigningMethodRS256
+	default:
+		return nil, fmt.Errorf("signing key %s: unsupported algorithm %s", stored.KID, stored.Algorithm)
+	}
+
+	return &utils.SigningKey{
+		ID:      stored.KID,
+		Method:  method,
+		Private: signer,
+		Public:  signer.Public(),
+	}, nil
+}
+
+// Выпустить новый ключ подписи, если его нет, последний старше периода ротации или алгоритм в конфиге изменился.
+// Новый ключ сразу попадает в JWKS, а подписывать начинает через JWKSMaxAge, когда клиенты обновят кеш.
+// Пока все экземпляры не перешли на новый ключ, действуют оба; прежние выводятся из подписи при следующем запуске
+// после активации нового и проверяют токены, пока те не истекут
+func RotateSigningKeys(now time.Time) (err error) {
+	now = now.UTC()
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = repository.LockSigningKeys(tx); err != nil {
+		return err
+	}
+	if err = encryptPlaintextSigningKeys(tx); err != nil {
+		return err
+	}
+
+	active, err := repository.GetActiveSigningKeys(tx)
+	if err != nil {
+		return err
+	}
+
+	algorithm := configuredSigningAlgorithm()
+	if len(active) == 0 || active[0].Algorithm != algorithm ||
+		(!active[0].ActivatesAt.After(now) && now.Sub(active[0].ActivatesAt) >= keyRotationPeriod()) {
+		key, err := newSigningKey(algorithm, now)
+		if err != nil {
+			return err
+		}
+		// Если подписывать нечем, новый ключ действует сразу
+		if slices.ContainsFunc(active, func(k models.SigningKey) bool { return !k.ActivatesAt.After(now) }) {
+			key.ActivatesAt = now.Add(JWKSMaxAge)
+		}
+		if err = repository.CreateSigningKey(tx, key); err != nil {
+			return err
+		}
+		active = append([]models.SigningKey{*key}, active...)
+		logger.Info.Printf("[service] RotateSigningKeys(): new %s signing key %s, signs from %s",
+			algorithm, key.KID, key.ActivatesAt.Format(time.RFC3339))
+	}
+
+	// Ключи старше самого нового из уже подписывающих больше не нужны для подписи
+	for _, key := range active {
+		if !key.ActivatesAt.After(now) {
+			if err = repository.RetireSigningKeys(tx, key.ActivatesAt, now, now.Add(retiredKeyTTL())); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Зашифровать закрытые ключи, сохранённые до появления шифрования
+func encryptPlaintextSigningKeys(tx *sqlx.Tx) error {
+	plaintext, err := repository.GetPlaintextSigningKeys(tx)
+	if err != nil {
+		return err
+	}
+	for _, key := range plaintext {
+		sealed, err := sealPrivateKey(key.KID, key.PrivateKey)
+		if err != nil {
+			return err
+		}
+		if err = repository.SaveEncryptedSigningKey(tx, key.KID, sealed); err != nil {
+			return err
+		}
+		logger.Info.Printf("[service] RotateSigningKeys(): private key of signing key %s encrypted", key.KID)
+	}
+	return nil
+}
+
+// Перечитать ключи из БД. Если ключа для подписи ещё нет, он создаётся
+func LoadSigningKeys() error {
+	return loadSigningKeys(true)
+}
+
+func loadSigningKeys(rotate bool) error {
+	now := time.Now().UTC()
+	list, err := repository.GetSigningKeys(now)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]*utils.SigningKey, len(list))
+	var candidates []signingCandidate
+	for _, stored := range list {
+		key, err := decodeSigningKey(stored)
+		if err != nil {
+			logger.Error.Printf("[service] LoadSigningKeys(): %v", err)
+			continue
+		}
+		keys[key.ID] = key
+		// Список отсортирован от новых к старым
+		if stored.RetiredAt == nil {
+			candidates = append(candidates, signingCandidate{key: key, activatesAt: stored.ActivatesAt})
+		}
+	}
+
+	if !slices.ContainsFunc(candidates, func(c signingCandidate) bool { return !c.activatesAt.After(now) }) {
+		if !rotate {
+			return errors.New("no active signing key")
+		}
+		if err = RotateSigningKeys(now); err != nil {
+			return err
+		}
+		return loadSigningKeys(false)
+	}
+
+	signingKeysMu.Lock()
+	signingKeys = keys
+	signingCandidates = candidates
+	signingKeysLoadedAt = time.Now()
+	signingKeysMu.Unlock()
+	return nil
+}
+
+// Ключ для подписи новых токенов: самый новый из уже начавших подписывать.
+// Ключи перечитываются не реже signingKeysRefreshInterval, чтобы не подписывать выведенным ключом
+func getCurrentSigningKey() (*utils.SigningKey, error) {
+	now := time.Now().UTC()
+
+	signingKeysMu.RLock()
+	stale := time.Since(signingKeysLoadedAt) > signingKeysRefreshInterval
+	key := currentSigningCandidate(signingCandidates, now)
+	signingKeysMu.RUnlock()
+	if key != nil && !stale {
+		return key, nil
+	}
+
+	if err := LoadSigningKeys(); err != nil {
+		if key != nil {
+			logger.Error.Printf("[service] getCurrentSigningKey(): %v", err)
+			return key, nil
+		}
+		return nil, err
+	}
+
+	signingKeysMu.RLock()
+	key = currentSigningCandidate(signingCandidates, now)
+	signingKeysMu.RUnlock()
+	if key == nil {
+		return nil, errors.New("no active signing key")
+	}
+	return key, nil
+}
+
+// Самый новый ключ, начавший подписывать к now. Кандидаты отсортированы от новых к старым
+func currentSigningCandidate(candidates []signingCandidate, now time.Time) *utils.SigningKey {
+	for _, candidate := range candidates {
+		if !candidate.activatesAt.After(now) {
+			return candidate.key
+		}
+	}
+	return nil
+}
+
+// Ключ для проверки подписи по kid. Неизвестный kid может означать, что ключ выпустил другой экземпляр,
+// поэтому ключи перечитываются из БД, но не чаще signingKeysReloadInterval
+func lookupSigningKey(kid string) (*utils.SigningKey, error) {
+	signingKeysMu.RLock()
+	key, ok := signingKeys[kid]
+	stale := time.Since(signingKeysLoadedAt) > signingKeysReloadInterval
+	signingKeysMu.RUnlock()
+	if ok {
+		return key, nil
+	}
+	if !stale {
+		return nil, errUnknownSigningKey
+	}
+
+	if err := LoadSigningKeys(); err != nil {
+		return nil, err
+	}
+
+	signingKeysMu.RLock()
+	key, ok = signingKeys[kid]
+	signingKeysMu.RUnlock()
+	if !ok {
+		return nil, errUnknownSigningKey
+	}
+	return key, nil
+}
+
+// Проверить access-токен
+func ParseAccessToken(token string) (*utils.CustomClaims, error) {
+	return utils.ParseToken(token, lookupSigningKey)
+}
+
+// Открытый ключ в формате JWK
+func publicJWK(key *utils.SigningKey) (models.JWK, error) {
+	jwk := models.JWK{Use: "sig", Alg: key.Method.Alg(), Kid: key.ID}
+	switch public := key.Public.(type) {
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	default:
+		return models.JWK{}, fmt.Errorf("signing key %s: unsupported public key type", key.ID)
+	}
+	return jwk, nil
+}
+
+// Открытые ключи, которыми можно проверить действующие токены
+func GetJWKS() (*models.JWKS, error) {
+	if _, err := getCurrentSigningKey(); err != nil {
+		return nil, err
+	}
+
+	signingKeysMu.RLock()
+	keys := make([]*utils.SigningKey, 0, len(signingKeys))
+	for _, key := range signingKeys {
+		keys = append(keys, key)
+	}
+	signingKeysMu.RUnlock()
+	slices.SortFunc(keys, func(a, b *utils.SigningKey) int { return strings.Compare(a.ID, b.ID) })
+
+	jwks := &models.JWKS{Keys: make([]models.JWK, 0, len(keys))}
+	for _, key := range keys {
+		jwk, err := publicJWK(key)
+		if err != nil {
+			return nil, err
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks, nil
+}
+
+// Фоновая задача: ротация ключей подписи по расписанию и удаление ключей, которые больше ничего не проверяют
+func RunSigningKeyRotationJob(now time.Time) error {
+	if err := RotateSigningKeys(now); err != nil {
+		return err
+	}
+	if err := repository.DeleteExpiredSigningKeys(now.UTC()); err != nil {
+		return err
+	}
+	return LoadSigningKeys()
+}
@@ -0,0 +1,491 @@
+package service
+
+import (
+	"SB/internal/configs"
+	"SB/internal/db"
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"SB/logger"
+	"SB/utils"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTOTPIssuer      = "SimpleBank"
+	defaultMFAChallengeTTL = 5 * time.Minute
+	defaultMFAMaxAttempts  = 5
+	defaultRecoveryCodes   = 10
+	defaultMFAMaxFailures  = 5
+	defaultMFALockout      = 15 * time.Minute
+	// Алфавит кодов восстановления без похожих символов (0/o, 1/l)
+	recoveryCodeAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+	recoveryCodeLength   = 10
+)
+
+func totpIssuer() string {
+	if issuer := configs.AppSettings.MFAParams.Issuer; issuer != "" {
+		return issuer
+	}
+	return defaultTOTPIssuer
+}
+
+func mfaChallengeTTL() time.Duration {
+	minutes := configs.AppSettings.MFAParams.ChallengeTtlMinutes
+	if minutes <= 0 {
+		return defaultMFAChallengeTTL
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+func mfaMaxAttempts() int {
+	if attempts := configs.AppSettings.MFAParams.MaxAttempts; attempts > 0 {
+		return attempts
+	}
+	return defaultMFAMaxAttempts
+}
+
+func mfaMaxFailures() int {
+	if failures := configs.AppSettings.MFAParams.MaxFailures; failures > 0 {
+		return failures
+	}
+	return defaultMFAMaxFailures
+}
+
+func mfaLockout() time.Duration {
+	minutes := configs.AppSettings.MFAParams.LockoutMinutes
+	if minutes <= 0 {
+		return defaultMFALockout
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+func recoveryCodesCount() int {
+	if count := configs.AppSettings.MFAParams.RecoveryCodes; count > 0 {
+		return count
+	}
+	return defaultRecoveryCodes
+}
+
+// Код восстановления сравнивается без учёта регистра и дефиса
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// Новые одноразовые коды восстановления вида xxxxx-xxxxx и их хеши для БД
+func newRecoveryCodes() ([]string, []string, error) {
+	count := recoveryCodesCount()
+	codes := make([]string, 0, count)
+	hashes := make([]string, 0, count)
+	buf := make([]byte, recoveryCodeLength)
+	for range count {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := make([]byte, 0, recoveryCodeLength+1)
+		for i, b := range buf {
+			if i == recoveryCodeLength/2 {
+				code = append(code, '-')
+			}
+			code = append(code, recoveryCodeAlphabet[int(b)%len(recoveryCodeAlphabet)])
+		}
+		codes = append(codes, string(code))
+		hashes = append(hashes, hashRecoveryCode(string(code)))
+	}
+	return codes, hashes, nil
+}
+
+// Интервал, которому соответствует код, с допуском в один интервал в обе стороны.
+// Интервалы не позже lastStep уже использованы и не подходят
+func matchTOTPStep(secret string, lastStep int64, code string, now time.Time) (int64, bool, error) {
+	code = strings.TrimSpace(code)
+	if len(code) != utils.TOTPDigits {
+		return 0, false, nil
+	}
+
+	current := utils.TOTPStep(now)
+	for step := current - 1; step <= current+1; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := utils.TOTPCode(secret, step)
+		if err != nil {
+			return 0, false, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// Проверить код TOTP. Принятый интервал запоминается, поэтому повторно тот же код не сработает
+func verifyTOTP(totp *models.UserTOTP, code string) (bool, error) {
+	step, ok, err := matchTOTPStep(totp.Secret, totp.LastStep, code, time.Now())
+	if err != nil || !ok {
+		return false, err
+	}
+
+	accepted, err := repository.UseTOTPStep(totp.UserID, step)
+	if err == nil && accepted {
+		totp.LastStep = step
+	}
+	return accepted, err
+}
+
+// Подтверждённый второй фактор пользователя
+func getEnabledTOTP(userID int) (*models.UserTOTP, error) {
+	totp, err := repository.GetUserTOTP(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errs.ErrTOTPNotEnabled
+		}
+		return nil, err
+	}
+	if totp.ConfirmedAt == nil {
+		return nil, errs.ErrTOTPNotEnabled
+	}
+	return &totp, nil
+}
+
+// Проверить второй фактор: код из приложения или неиспользованный код восстановления.
+// Неверные коды считаются по пользователю, где бы их ни вводили (вход, переводы, смена пароля, управление 2FA):
+// после mfa_params.max_failures ошибок подряд проверка блокируется на mfa_params.lockout_minutes
+func verifySecondFactor(userID int, code string) error {
+	totp, err := getEnabledTOTP(userID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if totp.LockedUntil != nil && now.Before(*totp.LockedUntil) {
+		return &errs.LoginBlockedError{Reason: errs.ErrTOTPLocked, RetryAt: *totp.LockedUntil}
+	}
+
+	ok, err := verifyTOTP(totp, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		ok, err = repository.UseRecoveryCode(userID, hashRecoveryCode(code))
+		if err != nil {
+			return err
+		}
+		if ok {
+			logger.Warn.Printf("[service] verifySecondFactor(): user %d signed with a recovery code", userID)
+		}
+	}
+
+	if ok {
+		if totp.FailedAttempts > 0 {
+			if err = repository.ResetTOTPFailures(userID); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	lockUntil := now.Add(mfaLockout())
+	locked, err := repository.RegisterTOTPFailure(userID, mfaMaxFailures(), lockUntil)
+	if err != nil {
+		return err
+	}
+	if locked {
+		logger.Warn.Printf("[service] verifySecondFactor(): one-time codes of user %d locked until %s", userID, lockUntil.Format(time.RFC3339))
+		if err = repository.WriteAuditLog("lock_totp", "user", userID, userID); err != nil {
+			logger.Error.Printf("[service] verifySecondFactor(): audit log: %v", err)
+		}
+		return &errs.LoginBlockedError{Reason: errs.ErrTOTPLocked, RetryAt: lockUntil}
+	}
+	return errs.ErrInvalidTOTPCode
+}
+
+// Подключён ли второй фактор
+func IsTOTPEnabled(userID int) (bool, error) {
+	_, err := getEnabledTOTP(userID)
+	if errors.Is(err, errs.ErrTOTPNotEnabled) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Начать подключение второго фактора: новый секрет и URI для QR-кода.
+// Повторный вызов до подтверждения заменяет секрет
+func StartTOTPEnrollment(userID int) (*models.TOTPEnrollment, error) {
+	user, err := GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := utils.NewTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	saved, err := repository.SaveTOTPSecret(userID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if !saved {
+		return nil, errs.ErrTOTPAlreadyEnabled
+	}
+
+	return &models.TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(totpIssuer(), user.Username, secret),
+	}, nil
+}
+
+// Завершить подключение кодом из приложения. Возвращает коды восстановления, они показываются один раз
+func ConfirmTOTPEnrollment(userID int, code string) (codes []string, err error) {
+	totp, err := repository.GetUserTOTP(userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errs.ErrTOTPNotEnabled
+		}
+		return nil, err
+	}
+	if totp.ConfirmedAt != nil {
+		return nil, errs.ErrTOTPAlreadyEnabled
+	}
+
+	ok, err := verifyTOTP(&totp, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errs.ErrInvalidTOTPCode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = repository.ConfirmTOTP(tx, userID); err != nil {
+		return nil, err
+	}
+	if err = repository.ReplaceRecoveryCodes(tx, userID, hashes); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if err := repository.WriteAuditLog("enable_totp", "user", userID, userID); err != nil {
+		logger.Error.Printf("[service] ConfirmTOTPEnrollment(): audit log: %v", err)
+	}
+	return codes, nil
+}
+
+// Выпустить новые коды восстановления, старые перестают действовать
+func RegenerateRecoveryCodes(userID int, code string) (codes []string, err error) {
+	if err = verifySecondFactor(userID, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = repository.ReplaceRecoveryCodes(tx, userID, hashes); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Отключить второй фактор, подтвердив его кодом
+func DisableTOTP(userID int, code string) (err error) {
+	if err = verifySecondFactor(userID, code); err != nil {
+		return err
+	}
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = repository.DeleteUserTOTP(tx, userID); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	if err := repository.WriteAuditLog("disable_totp", "user", userID, userID); err != nil {
+		logger.Error.Printf("[service] DisableTOTP(): audit log: %v", err)
+	}
+	return nil
+}
+
+// Подтверждение операции вторым фактором. Нужно только пользователям, которые его подключили
+func requireStepUp(userID int, code string) error {
+	enabled, err := IsTOTPEnabled(userID)
+	if err != nil || !enabled {
+		return err
+	}
+	if strings.TrimSpace(code) == "" {
+		return errs.ErrStepUpRequired
+	}
+	return verifySecondFactor(userID, code)
+}
+
+// Перевод выше порога из конфига требует второй фактор. Порог задан в одной валюте,
+// сумма в другой валюте пересчитывается по текущему курсу; без курса подтверждение требуется всегда
+func transferNeedsStepUp(amount models.Money, currency string) bool {
+	params := configs.AppSettings.MFAParams
+	if params.StepUpThreshold <= 0 {
+		return false
+	}
+	if params.StepUpCurrency == "" || params.StepUpCurrency == currency {
+		return amount > params.StepUpThreshold
+	}
+
+	rate, err := GetExchangeRate(currency, params.StepUpCurrency, time.Now().UTC())
+	if err != nil {
+		return true
+	}
+	converted, err := ConvertMoney(amount, currency, params.StepUpCurrency, rate)
+	if err != nil {
+		return true
+	}
+	return converted > params.StepUpThreshold
+}
+
+// Первый шаг входа для пользователя со вторым фактором: токен, по которому вход завершается кодом
+func startMFAChallenge(user *models.User) (*models.SignInResult, error) {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return nil, errs.ErrGenerateToken
+	}
+
+	challenge := &models.MFAChallenge{
+		UserID:    user.ID,
+		TokenHash: hashRefreshToken(token),
+		ExpiresAt: time.Now().UTC().Add(mfaChallengeTTL()),
+	}
+	if err = repository.CreateMFAChallenge(challenge); err != nil {
+		return nil, err
+	}
+
+	return &models.SignInResult{
+		User:         user,
+		MFARequired:  true,
+		MFAToken:     token,
+		MFAExpiresAt: &challenge.ExpiresAt,
+	}, nil
+}
+
+// Второй шаг входа: проверить код и начать сессию. После max_attempts неверных кодов нужно заново ввести пароль.
+// Неверный код считается неудачным входом так же, как неверный пароль
+func CompleteMFASignIn(mfaToken, code, clientIP string) (result *models.SignInResult, err error) {
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	challenge, err := repository.GetMFAChallengeForUpdate(tx, hashRefreshToken(mfaToken))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errs.ErrInvalidMFAToken
+		}
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	if challenge.UsedAt != nil || !now.Before(challenge.ExpiresAt) || challenge.Attempts >= mfaMaxAttempts() {
+		err = errs.ErrInvalidMFAToken
+		return nil, err
+	}
+
+	user, err := GetUserByID(challenge.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = claimSignIn(user, clientIP, now); err != nil {
+		return nil, err
+	}
+
+	verifyErr := verifySecondFactor(challenge.UserID, code)
+	if verifyErr == nil || !errors.Is(verifyErr, errs.ErrInvalidTOTPCode) {
+		// Код верный или проверить его не удалось: неудачной попытки не было
+		refundSignIn(user, clientIP)
+	}
+	if verifyErr != nil && !errors.Is(verifyErr, errs.ErrInvalidTOTPCode) {
+		err = verifyErr
+		return nil, err
+	}
+
+	if verifyErr != nil {
+		challenge.Attempts++
+	} else {
+		challenge.UsedAt = &now
+	}
+	if err = repository.SaveMFAChallenge(tx, &challenge); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	if verifyErr != nil {
+		if err = registerFailedSignIn(user, clientIP, now); err != nil {
+			return nil, err
+		}
+		return nil, verifyErr
+	}
+
+	// Вход завершён: теперь можно сбросить счётчик пользователя (счётчик адреса не сбрасываем)
+	if _, err = repository.ResetLoginFailures(models.LoginScopeUser, strconv.Itoa(user.ID)); err != nil {
+		return nil, err
+	}
+	tokens, err := startSession(user)
+	if err != nil {
+		return nil, err
+	}
+	return &models.SignInResult{User: user, Tokens: tokens}, nil
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"SB/utils"
+	"testing"
+	"time"
+)
+
+func TestMatchTOTPStep(t *testing.T) {
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	now := time.Unix(1111111111, 0)
+	current := utils.TOTPStep(now)
+
+	codeAt := func(step int64) string {
+		code, err := utils.TOTPCode(secret, step)
+		if err != nil {
+			t.Fatalf("utils.TOTPCode(): %v", err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current interval", code: codeAt(current), wantStep: current, wantOK: true},
+		{name: "previous interval", code: codeAt(current - 1), wantStep: current - 1, wantOK: true},
+		{name: "next interval", code: codeAt(current + 1), wantStep: current + 1, wantOK: true},
+		{name: "surrounding whitespace", code: " " + codeAt(current) + "\n", wantStep: current, wantOK: true},
+		{name: "two intervals ago", code: codeAt(current - 2)},
+		{name: "two intervals ahead", code: codeAt(current + 2)},
+		{name: "already used interval", code: codeAt(current), lastStep: current},
+		{name: "earlier code after a later one was used", code: codeAt(current - 1), lastStep: current},
+		{name: "later code after an earlier one was used", code: codeAt(current + 1), lastStep: current,
+			wantStep: current + 1, wantOK: true},
+		{name: "wrong code", code: "000000"},
+		{name: "too short", code: codeAt(current)[:5]},
+		{name: "too long", code: codeAt(current) + "0"},
+		{name: "empty", code: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok, err := matchTOTPStep(secret, tt.lastStep, tt.code, now)
+			if err != nil {
+				t.Fatalf("matchTOTPStep(): %v", err)
+			}
+			if ok != tt.wantOK || step != tt.wantStep {
+				t.Errorf("matchTOTPStep(%q) = %d, %v, want %d, %v", tt.code, step, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
@@ -6,10 +6,16 @@ import (
 	"SB/internal/repository"
 	"database/sql"
 	"errors"
+	"time"
 )
 
 // Создать транзакцию (перевод денег)
-func CreateTransfer(tx *models.Transfer, userID int) (*models.TransferTxResult, error) {
+// Если валюты счетов различаются, сумма конвертируется через RateProvider
+func CreateTransfer(tx *models.Transfer, userID int, otpCode string) (*models.TransferTxResult, error) {
+	if tx.Amount <= 0 {
+		return nil, errs.ErrInvalidAmount
+	}
+
 	fromAccount, err := repository.GetAccountByID(tx.FromAccountID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -30,17 +36,35 @@ func CreateTransfer(tx *models.Transfer, userID int) (*models.TransferTxResult,
 		return nil, err
 	}
 
-	if toAccount.Currency != tx.Currency {
-		return nil, errs.ErrInvalidCurrency
-	}
-
 	if fromAccount.UserID != userID {
 		return nil, errs.ErrFraud
 	}
 
-	if fromAccount.Balance < int64(tx.Amount) {
+	if fromAccount.Balance < tx.Amount {
 		return nil, errs.ErrInsufficientBalance
 	}
 
+	if transferNeedsStepUp(tx.Amount, tx.Currency) {
+		if err = requireStepUp(userID, otpCode); err != nil {
+			return nil, err
+		}
+	}
+
+	// Перевод в валюту получателя по курсу на момент операции
+	rate, err := GetExchangeRate(fromAccount.Currency, toAccount.Currency, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	tx.ToCurrency = toAccount.Currency
+	tx.ExchangeRate = rate
+	tx.ToAmount, err = ConvertMoney(tx.Amount, fromAccount.Currency, toAccount.Currency, rate)
+	if err != nil {
+		return nil, err
+	}
+	if tx.ToAmount <= 0 {
+		return nil, errs.ErrInvalidAmount
+	}
+
 	return repository.CreateTransaction(tx)
 }
@@ -1,21 +1,29 @@
 package service
 
 import (
+	"SB/internal/db"
 	"SB/internal/errs"
 	"SB/internal/models"
 	"SB/internal/repository"
-	"SB/utils"
 	"database/sql"
 	"errors"
 	"golang.org/x/crypto/bcrypt"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-const AdminID = 1
+// Хеш для проверки пароля, когда пользователь не найден: ответ занимает столько же времени, сколько при неверном пароле
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := hashPassword("dummy password for unknown logins")
+	return hash
+})
 
 // Хеширование пароля
 func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost())
 	return string(bytes), err
 }
 
@@ -25,39 +33,76 @@ func checkPasswordHash(password, hash string) bool {
 }
 
 // Создать пользователя
-func CreateUser(user *models.User) error {
+func CreateUser(user *models.User, username, email, phone string) (identifiers []models.UserIdentifier, err error) {
+	user.FullName = strings.TrimSpace(user.FullName)
 	if len(user.FullName) < 3 || len(user.FullName) > 50 {
-		return errs.ErrInvalidFullName
+		return nil, errs.ErrInvalidFullName
 	}
 
-	user.FullName = strings.TrimSpace(user.FullName)
-	if len(user.Password) < 6 {
-		return errs.ErrPasswordTooShort
+	if err = ValidatePassword(user.Password); err != nil {
+		return nil, err
 	}
 
-	// Уникальность имени
-	userFromDB, err := repository.GetUserByFullName(user.FullName)
-	if userFromDB.ID > 0 {
-		return errs.ErrUserAlreadyExists
+	// Имя пользователя обязательно, почта и телефон - по желанию. Полное имя может повторяться
+	values := map[string]string{
+		models.IdentifierUsername: username,
+		models.IdentifierEmail:    email,
+		models.IdentifierPhone:    phone,
 	}
-
-	if !errors.Is(err, sql.ErrNoRows) && err != nil {
-		return errs.ErrDBUnavailable
+	for _, kind := range []string{models.IdentifierUsername, models.IdentifierEmail, models.IdentifierPhone} {
+		if kind != models.IdentifierUsername && strings.TrimSpace(values[kind]) == "" {
+			continue
+		}
+		identifier, err := newUserIdentifier(0, kind, values[kind])
+		if err != nil {
+			return nil, err
+		}
+		identifiers = append(identifiers, *identifier)
 	}
 
 	hashed, err := hashPassword(user.Password)
 	if err != nil {
-		return errs.ErrCreateHash
+		return nil, errs.ErrCreateHash
 	}
 
 	user.Password = hashed
 
-	user.ID, err = repository.CreateUser(user)
-	return err
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	user.ID, err = repository.CreateUser(tx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range identifiers {
+		identifiers[i].UserID = user.ID
+		if err = repository.CreateUserIdentifier(tx, &identifiers[i]); err != nil {
+			return nil, err
+		}
+	}
+	user.Username = identifiers[0].Value
+
+	// Каждый новый пользователь получает роль клиента
+	_, err = repository.GrantRole(tx, user.ID, models.RoleCustomer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	return identifiers, err
 }
 
-// Обновить пользователя
-func UpdateUser(updateUser *models.UpdateUser) error {
+// Обновить пользователя. Для смены пароля нужен текущий пароль, а при включённом втором факторе - ещё и код.
+// Неверный текущий пароль считается неудачным входом
+func UpdateUser(updateUser *models.UpdateUser, otpCode, clientIP string) (err error) {
 	user, err := repository.GetUserByID(updateUser.ID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -67,38 +112,71 @@ func UpdateUser(updateUser *models.UpdateUser) error {
 	}
 
 	if updateUser.FullName != nil {
-		if len(user.FullName) < 3 || len(user.FullName) > 50 {
+		fullName := strings.TrimSpace(*updateUser.FullName)
+		if len(fullName) < 3 || len(fullName) > 50 {
 			return errs.ErrInvalidFullName
 		}
 
-		user.FullName = *updateUser.FullName
+		user.FullName = fullName
 	}
 
+	var newHash string
 	if updateUser.Password != nil {
-		if len(user.Password) < 6 {
-			return errs.ErrPasswordTooShort
+		now := time.Now().UTC()
+		if err = claimSignIn(&user, clientIP, now); err != nil {
+			return err
+		}
+		if updateUser.CurrentPassword == nil || !checkPasswordHash(*updateUser.CurrentPassword, user.Password) {
+			if err = registerFailedSignIn(&user, clientIP, now); err != nil {
+				return err
+			}
+			return errs.ErrInvalidPassword
 		}
+		refundSignIn(&user, clientIP)
 
-		hashed, err := hashPassword(user.Password)
+		// Смена пароля подтверждается вторым фактором
+		if err = requireStepUp(user.ID, otpCode); err != nil {
+			return err
+		}
+
+		newHash, err = newPasswordHash(user.ID, user.Password, *updateUser.Password)
 		if err != nil {
-			return errs.ErrCreateHash
+			return err
 		}
+	}
 
-		user.Password = hashed
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
 	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
 
-	return repository.UpdateUser(&user)
+	if newHash != "" {
+		if err = changePassword(tx, user.ID, user.Password, newHash); err != nil {
+			return err
+		}
+		user.Password = newHash
+	}
+	if err = repository.UpdateUser(tx, &user); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-// Удалить пользователя
-func DeleteUser(userID int) error {
+// Удалить пользователя. Последнего администратора удалить нельзя
+func DeleteUser(userID int) (err error) {
 
-	account, err := repository.GetAccountsByUserID(userID)
-	if !errors.Is(err, sql.ErrNoRows) && err != nil {
+	accounts, err := repository.GetAccountsByUserID(userID)
+	if err != nil {
 		return err
 	}
 
-	if account.ID > 0 {
+	if len(accounts) > 0 {
 		return errs.ErrAccountExists
 	}
 
@@ -107,8 +185,11 @@ func DeleteUser(userID int) error {
 		return err
 	}
 
-	if credits != nil {
-		return errs.ErrCreditsExists
+	// Закрытые и отклонённые кредиты удалению не мешают
+	for _, credit := range credits {
+		if credit.Active {
+			return errs.ErrCreditsExists
+		}
 	}
 
 	deposits, err := repository.GetDepositsByUserID(userID)
@@ -116,11 +197,36 @@ func DeleteUser(userID int) error {
 		return err
 	}
 
-	if deposits != nil {
-		return errs.ErrDepositsExists
+	// Закрытые вклады удалению не мешают
+	for _, deposit := range deposits {
+		if deposit.Active {
+			return errs.ErrDepositsExists
+		}
+	}
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	admins, err := repository.GetRoleHoldersForUpdate(tx, models.RoleAdmin)
+	if err != nil {
+		return err
+	}
+	if len(admins) == 1 && slices.Contains(admins, userID) {
+		err = errs.ErrLastAdmin
+		return err
 	}
 
-	return repository.DeleteUser(userID)
+	if err = repository.DeleteUser(tx, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 // Получить пользователя по ID
@@ -136,62 +242,97 @@ func GetUserByID(userID int) (*models.User, error) {
 	return &user, nil
 }
 
-// Получить неактивных пользователей
-func GetInactiveUsers() ([]models.User, error) {
-	return repository.GetInactiveUsers()
+// Получить страницу неактивных пользователей
+func GetInactiveUsers(page models.PageParams) (models.Page[models.User], error) {
+	return repository.GetInactiveUsers(pageParams(page))
 }
 
-// Аутентификация
-func AuthenticateUser(fullName, password string) (string, *models.User, error) {
-	user, err := repository.GetUserByFullName(fullName)
+// Аутентификация: проверить пароль и начать новую сессию.
+// Неизвестный логин и неверный пароль неразличимы: оба дают ErrInvalidCredentials
+func AuthenticateUser(login, password, clientIP string) (*models.SignInResult, error) {
+	now := time.Now().UTC()
+	// Попытка сразу засчитывается адресу, а после поиска - пользователю; удачная возвращается
+	if err := claimLoginAttempt(models.LoginScopeIP, clientIP, now); err != nil {
+		return nil, err
+	}
+
+	// Войти можно по любому подтверждённому идентификатору, вид определяется по введённому значению
+	kind := identifierKindOf(login)
+	value, err := NormalizeIdentifier(kind, login)
+	if err != nil {
+		checkPasswordHash(password, dummyPasswordHash())
+		if err = registerFailedSignIn(nil, clientIP, now); err != nil {
+			return nil, err
+		}
+		return nil, errs.ErrInvalidCredentials
+	}
+
+	user, err := repository.GetUserByIdentifier(kind, value)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return "", nil, errs.ErrNotFound
+			checkPasswordHash(password, dummyPasswordHash())
+			if err = registerFailedSignIn(nil, clientIP, now); err != nil {
+				return nil, err
+			}
+			return nil, errs.ErrInvalidCredentials
 		}
-		return "", nil, err
+		return nil, err
+	}
+
+	if err = claimLoginAttempt(models.LoginScopeUser, strconv.Itoa(user.ID), now); err != nil {
+		refundLoginAttempt(models.LoginScopeIP, clientIP)
+		return nil, err
 	}
 
 	if !checkPasswordHash(password, user.Password) {
-		return "", nil, errs.ErrInvalidPassword
+		if err = registerFailedSignIn(user, clientIP, now); err != nil {
+			return nil, err
+		}
+		return nil, errs.ErrInvalidCredentials
 	}
+	refundSignIn(user, clientIP)
+
+	rehashPasswordIfNeeded(user, password)
 
-	token, err := utils.GenerateToken(user.ID, user.FullName)
+	// Со вторым фактором токены выдаются только после проверки кода,
+	// и счётчик неудачных входов сбрасывается тоже только после него
+	totpEnabled, err := IsTOTPEnabled(user.ID)
 	if err != nil {
-		return "", nil, errs.ErrGenerateToken
+		return nil, err
+	}
+	if totpEnabled {
+		return startMFAChallenge(user)
 	}
-	return token, user, nil
-}
 
-// Восстановить пользователя
-func RestoreUser(fullName string) error {
-	if len(fullName) < 3 || len(fullName) > 50 {
-		return errs.ErrInvalidFullName
+	// Счётчик адреса не сбрасываем: иначе перебор можно чередовать со входом в свой аккаунт
+	if _, err = repository.ResetLoginFailures(models.LoginScopeUser, strconv.Itoa(user.ID)); err != nil {
+		return nil, err
 	}
 
-	user, err := repository.GetUserByNameForRestore(fullName)
+	tokens, err := startSession(user)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return errs.ErrNotFound
-		}
-		return err
+		return nil, err
 	}
+	return &models.SignInResult{User: user, Tokens: tokens}, nil
+}
 
-	return repository.RestoreUser(user.ID)
+// Восстановить пользователя
+func RestoreUser(userID int) error {
+	restored, err := repository.RestoreUser(userID)
+	if err != nil {
+		return err
+	}
+	if !restored {
+		return errs.ErrNotFound
+	}
+	return nil
 }
 
 // Поиск по имени
-func FindUserByName(name string) ([]models.User, error) {
+func FindUserByName(name string, page models.PageParams) (models.Page[models.User], error) {
 	if len(name) < 3 || len(name) > 50 {
-		return nil, errs.ErrInvalidFullName
-	}
-
-	users, err := repository.GetUserByNameFilter(name)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, errs.ErrNotFound
-		}
-		return nil, err
+		return models.Page[models.User]{}, errs.ErrInvalidFullName
 	}
 
-	return users, nil
+	return repository.GetUserByNameFilter(name, pageParams(page))
 }
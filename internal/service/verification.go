@@ -0,0 +1,251 @@
+package service
+
+import (
+	"SB/internal/configs"
+	"SB/internal/db"
+	"SB/internal/errs"
+	"SB/internal/models"
+	"SB/internal/repository"
+	"SB/logger"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultVerificationCodeTTL  = 10 * time.Minute
+	defaultVerificationAttempts = 5
+	defaultVerificationResend   = time.Minute
+	verificationCodeDigits      = 6
+)
+
+func verificationCodeTTL() time.Duration {
+	minutes := configs.AppSettings.VerificationParams.CodeTtlMinutes
+	if minutes <= 0 {
+		return defaultVerificationCodeTTL
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+func verificationMaxAttempts() int {
+	if attempts := configs.AppSettings.VerificationParams.MaxAttempts; attempts > 0 {
+		return attempts
+	}
+	return defaultVerificationAttempts
+}
+
+func verificationResendInterval() time.Duration {
+	seconds := configs.AppSettings.VerificationParams.ResendSeconds
+	if seconds <= 0 {
+		return defaultVerificationResend
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// Случайный числовой код из verificationCodeDigits цифр
+func newVerificationCode() (string, error) {
+	limit := big.NewInt(1)
+	for range verificationCodeDigits {
+		limit.Mul(limit, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", verificationCodeDigits, n), nil
+}
+
+// Хеш кода привязан к записи, чтобы одинаковые коды разных пользователей не совпадали по хешу
+func hashVerificationCode(userID int, target, code string) string {
+	sum := sha256.Sum256([]byte(strconv.Itoa(userID) + ":" + target + ":" + strings.TrimSpace(code)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Отправить код подтверждения почты или телефона. Новый код отменяет прежний.
+// Возвращает время, до которого код действует
+func SendVerificationCode(userID int, kind string) (expiresAt time.Time, err error) {
+	if kind != models.IdentifierEmail && kind != models.IdentifierPhone {
+		return time.Time{}, errs.ErrInvalidIdentifierKind
+	}
+
+	identifier, err := repository.GetUserIdentifier(userID, kind)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return time.Time{}, errs.ErrNotFound
+		}
+		return time.Time{}, err
+	}
+	if identifier.VerifiedAt != nil {
+		return time.Time{}, errs.ErrIdentifierVerified
+	}
+
+	// Значение, уже подтверждённое другим пользователем, подтвердить нельзя - код не отправляем
+	taken, err := repository.IsIdentifierTaken(userID, kind, identifier.Value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if taken {
+		return time.Time{}, errs.ErrIdentifierTaken
+	}
+
+	now := time.Now().UTC()
+	last, err := repository.GetLatestVerificationCode(userID, kind)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, err
+	}
+	if err == nil && now.Before(last.CreatedAt.Add(verificationResendInterval())) {
+		return time.Time{}, errs.ErrVerificationTooSoon
+	}
+
+	plain, err := newVerificationCode()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	code := &models.VerificationCode{
+		UserID:    userID,
+		Kind:      kind,
+		Target:    identifier.Value,
+		CodeHash:  hashVerificationCode(userID, identifier.Value, plain),
+		ExpiresAt: now.Add(verificationCodeTTL()),
+		CreatedAt: now,
+	}
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = repository.ReplaceVerificationCode(tx, code); err != nil {
+		return time.Time{}, err
+	}
+	if err = tx.Commit(); err != nil {
+		return time.Time{}, err
+	}
+
+	// Отправляем только сохранённый код. Если отправить не удалось, код удаляется,
+	// чтобы новый можно было запросить сразу, не дожидаясь resend_seconds
+	message := fmt.Sprintf("Your %s verification code is %s. It expires in %d minutes.",
+		configs.AppSettings.AppParams.ServerName, plain, int(verificationCodeTTL().Minutes()))
+	if err = sendNotification(kind, identifier.Value, "Verification code", message); err != nil {
+		if deleteErr := repository.DeleteVerificationCode(code.ID); deleteErr != nil {
+			logger.Error.Printf("[service] SendVerificationCode(): repository.DeleteVerificationCode: %v", deleteErr)
+		}
+		return time.Time{}, err
+	}
+	return code.ExpiresAt, nil
+}
+
+// Подтвердить почту или телефон кодом. После max_attempts неверных кодов нужно запросить новый
+func ConfirmVerificationCode(userID int, kind, plain string) (err error) {
+	if kind != models.IdentifierEmail && kind != models.IdentifierPhone {
+		return errs.ErrInvalidIdentifierKind
+	}
+
+	tx, err := db.GetDBConn().Beginx()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	code, err := repository.GetLatestVerificationCodeForUpdate(tx, userID, kind)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errs.ErrVerificationCodeExpired
+		}
+		return err
+	}
+
+	now := time.Now().UTC()
+	if code.UsedAt != nil || !now.Before(code.ExpiresAt) || code.Attempts >= verificationMaxAttempts() {
+		err = errs.ErrVerificationCodeExpired
+		return err
+	}
+
+	expected := hashVerificationCode(userID, code.Target, plain)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(code.CodeHash)) != 1 {
+		code.Attempts++
+		if err = repository.SaveVerificationCode(tx, &code); err != nil {
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+		return errs.ErrInvalidVerificationCode
+	}
+
+	code.UsedAt = &now
+	if err = repository.SaveVerificationCode(tx, &code); err != nil {
+		return err
+	}
+
+	// Если после отправки кода пользователь сменил значение, подтверждать нечего
+	verified, err := repository.VerifyUserIdentifier(tx, userID, kind, code.Target, now)
+	if err != nil {
+		return err
+	}
+	if !verified {
+		err = errs.ErrVerificationCodeExpired
+		return err
+	}
+
+	// Значение досталось этому пользователю: неподтверждённые заявки других на него снимаются
+	released, err := repository.DeleteCompetingIdentifiers(tx, userID, kind, code.Target)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	for _, otherID := range released {
+		logger.Warn.Printf("[service] ConfirmVerificationCode(): unverified %s of user %d released, verified by user %d", kind, otherID, userID)
+		if err := repository.WriteAuditLog("release_"+kind, "user", otherID, userID); err != nil {
+			logger.Error.Printf("[service] ConfirmVerificationCode(): audit log: %v", err)
+		}
+	}
+
+	if err := repository.WriteAuditLog("verify_"+kind, "user", userID, userID); err != nil {
+		logger.Error.Printf("[service] ConfirmVerificationCode(): audit log: %v", err)
+	}
+	return nil
+}
+
+// Подтверждены ли контакты пользователя: есть хотя бы почта или телефон и всё указанное подтверждено.
+// Без этого операции с деньгами запрещены
+func HasVerifiedContacts(userID int) (bool, error) {
+	identifiers, err := repository.GetUserIdentifiers(userID)
+	if err != nil {
+		return false, err
+	}
+
+	verified := false
+	for _, identifier := range identifiers {
+		if identifier.Kind != models.IdentifierEmail && identifier.Kind != models.IdentifierPhone {
+			continue
+		}
+		if identifier.VerifiedAt == nil {
+			return false, nil
+		}
+		verified = true
+	}
+	return verified, nil
+}
@@ -4,11 +4,19 @@ import (
 	"SB/internal/configs"
 	"SB/internal/controller"
 	"SB/internal/db"
+	"SB/internal/service"
 	"SB/logger"
+	"encoding/json"
+	"flag"
 	"log"
+	"os"
 )
 
 func main() {
+	reconcile := flag.Bool("reconcile", false, "run ledger reconciliation, print the report and exit")
+	grantAdmin := flag.String("grant-admin", "", "grant the admin role to the user with this username, email or phone and exit")
+	flag.Parse()
+
 	// Reading configs
 	if err := configs.ReadSettings(); err != nil {
 		log.Fatalf("Ошибка чтения настроек: %v", err)
@@ -32,9 +40,69 @@ func main() {
 	}
 	logger.Info.Println("Migrations initialized successfully!")
 
+	// Loading currency registry
+	if err := service.LoadCurrencies(); err != nil {
+		log.Fatalf("Ошибка загрузки справочника валют: %v", err)
+	}
+
+	// Loading token signing keys, the first key is created on the first start
+	if err := service.LoadSigningKeys(); err != nil {
+		log.Fatalf("Ошибка загрузки ключей подписи: %v", err)
+	}
+
+	// Initializing exchange rate provider
+	service.InitRateProvider()
+
+	// Initializing notifier for verification codes
+	service.InitNotifier()
+
+	// Reconciliation mode: no http-server, exit code 1 on drift
+	if *reconcile {
+		os.Exit(runReconciliation())
+	}
+
+	// Bootstrapping an admin: no http-server
+	if *grantAdmin != "" {
+		os.Exit(runGrantAdmin(*grantAdmin))
+	}
+
+	// Running background jobs (overdue credits etc.)
+	service.StartScheduler()
+
 	// Running http-server
 	if err := controller.RunServer(); err != nil {
 		return
 	}
 
 }
+
+func runReconciliation() int {
+	report, err := service.Reconcile()
+	if err != nil {
+		log.Printf("Ошибка сверки журнала: %v", err)
+		return 2
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err = encoder.Encode(report); err != nil {
+		log.Printf("Ошибка вывода отчёта сверки: %v", err)
+		return 2
+	}
+
+	if !report.Balanced {
+		return 1
+	}
+	return 0
+}
+
+func runGrantAdmin(login string) int {
+	userID, err := service.BootstrapAdmin(login)
+	if err != nil {
+		log.Printf("Ошибка назначения администратора: %v", err)
+		return 1
+	}
+
+	log.Printf("Пользователь %d получил роль admin", userID)
+	return 0
+}
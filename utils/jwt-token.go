@@ -2,41 +2,102 @@ package utils
 
 import (
 	"SB/internal/configs"
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
 	"fmt"
 	"github.com/golang-jwt/jwt/v5"
-	"os"
 	"time"
 )
 
+const defaultAccessTTL = 15 * time.Minute
+
 type CustomClaims struct {
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
+	UserID      int      `json:"user_id"`
+	Username    string   `json:"username"`
+	SessionID   string   `json:"sid"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID int, username string) (string, error) {
+// Ключ подписи токенов. ID попадает в заголовок kid, по нему проверяющая сторона находит открытый ключ
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// Случайная строка из size байт в URL-safe base64
+func RandomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Время жизни access-токена из конфига
+func AccessTokenTTL() time.Duration {
+	minutes := configs.AppSettings.AuthParams.JwtTtlMinutes
+	if minutes <= 0 {
+		return defaultAccessTTL
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Короткоживущий access-токен. Уникальный jti позволяет отозвать токен до истечения срока
+func GenerateToken(key *SigningKey, userID int, username, sessionID string, roles, permissions []string) (string, time.Time, error) {
+	tokenID, err := RandomToken(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(AccessTokenTTL())
 	claims := CustomClaims{
-		UserID:   userID,
-		Username: username,
+		UserID:      userID,
+		Username:    username,
+		SessionID:   sessionID,
+		Roles:       roles,
+		Permissions: permissions,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(configs.AppSettings.AuthParams.JwtTtlMinutes) * time.Minute)),
+			ID:        tokenID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(os.Getenv("JWT_SECRET")))
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	signed, err := token.SignedString(key.Private)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
 }
 
-func ParseToken(tokenString string) (*CustomClaims, error) {
+// Проверить подпись и срок токена. Открытый ключ ищется по kid из заголовка,
+// алгоритм токена должен совпадать с алгоритмом ключа
+func ParseToken(tokenString string, lookup func(kid string) (*SigningKey, error)) (*CustomClaims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, fmt.Errorf("token has no key id")
+		}
+		key, err := lookup(kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+		return key.Public, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg(), jwt.SigningMethodRS256.Alg()}))
 	if err != nil {
 		return nil, err
 	}
-	if claims, ok := token.Claims.(*CustomClaims); ok && token.Valid {
+	if claims, ok := token.Claims.(*CustomClaims); ok && token.Valid && claims.ID != "" && claims.ExpiresAt != nil {
 		return claims, nil
 	}
 	return nil, fmt.Errorf("invalid token")